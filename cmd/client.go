@@ -1,31 +1,32 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
-	"fmt"
-	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/outbound"
 	"github.com/nimaaskarian/goje/timer"
 	"github.com/nimaaskarian/goje/utils"
-	"github.com/r3labs/sse/v2"
 	"github.com/spf13/cobra"
 )
 
 var (
 	outbound_address string
 	insecure_tls     bool
+	participant_name string
 )
 
 func init() {
 	rootCmd.AddCommand(clientCmd)
 	clientCmd.Flags().AddFlagSet(rootFlags())
-	clientCmd.Flags().StringVarP(&outbound_address, "outbound-address", "o", "", "address to outbound server to connect to")
+	clientCmd.Flags().StringVarP(&outbound_address, "outbound-address", "o", "", "address to outbound server to connect to. auto connects to the first goje instance found on the local network")
+	clientCmd.Flags().StringVar(&participant_name, "name", "", "display name to join the outbound server's session as a participant with")
 	clientCmd.Flags().BoolVar(&insecure_tls, "insecure-tls", false, "don't verify ssl the certificate")
 }
 
@@ -36,6 +37,13 @@ var clientCmd = &cobra.Command{
 		return setupConfigForCmd(cmd)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if outbound_address == "auto" {
+			address, err := discoverOutbound(2 * time.Second)
+			if err != nil {
+				return err
+			}
+			outbound_address = address
+		}
 		outbound_address = utils.FixHttpAddress(outbound_address)
 		t := timer.PomodoroTimer{
 			Config: &config.Timer,
@@ -74,41 +82,14 @@ var clientCmd = &cobra.Command{
 				Transport: tr,
 			}
 		}
-		client := sse.NewClient(outbound_address + "/api/timer/stream")
-		client.Connection = httpClient
-		config.Timer.Hooks.OnSet.Append(func(t *timer.PomodoroTimer) {
-			content, _ := json.Marshal(t)
-			req, err := http.NewRequest("POST", outbound_address+"/api/timer", bytes.NewBuffer(content))
-			if err != nil {
-				slog.Error("making a request to address failed", "err", err)
-				os.Exit(1)
-			}
-			resp, err := httpClient.Do(req)
-			if err != nil {
-				slog.Error("sending a request to address failed", "err", err)
+		outboundClient = outbound.NewClient(outbound_address, httpClient, &t)
+		outboundClient.Name = participant_name
+		outboundClient.OnStatus = func(status outbound.Status) {
+			if httpDaemon != nil {
+				httpDaemon.Hub.Broadcast(httpd.NewEvent(status, "outbound"))
 			}
-			resp.Body.Close()
-		})
-		go func() {
-			err := client.SubscribeRaw(func(msg *sse.Event) {
-				json.Unmarshal(msg.Data, &t)
-				fmt.Println(string(msg.Data))
-				switch string(msg.Event) {
-				case "change":
-					config.Timer.Hooks.OnChange.Run(&t)
-				case "end":
-					config.Timer.Hooks.OnModeEnd.Run(&t)
-				case "start":
-					config.Timer.Hooks.OnModeStart.Run(&t)
-				case "pause":
-					config.Timer.Hooks.OnPause.Run(&t)
-				}
-			})
-			if err != nil {
-				slog.Error("subscribing to SSE failed", "err", err)
-				os.Exit(1)
-			}
-		}()
+		}
+		go outboundClient.Run(context.Background())
 		return setupServerAndSignalWatcher(&t)
 	},
 }
@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/tcpd"
+	"github.com/r3labs/sse/v2"
+	"github.com/spf13/cobra"
+)
+
+// exit code of goje ctl when the daemon rejects the command
+const EXIT_ACK = 2
+
+const DEFAULT_CTL_FORMAT = "{{.ModeName}} {{.Remaining}}{{if .Paused}} (paused){{end}}"
+
+var (
+	ctl_format  string
+	ctl_http    bool
+	ctl_timeout time.Duration
+)
+
+// events of the stream that carry the timer
+var timerEvents = []string{"change", "start", "end", "pause", "goal"}
+
+func init() {
+	rootCmd.AddCommand(ctlCmd)
+	flags := ctlCmd.PersistentFlags()
+	flags.StringVarP(&ctl_format, "format", "f", DEFAULT_CTL_FORMAT, "format of status and watch. a go template of the timer (fields of /api/v1/timer, as .Mode, .Remaining, .Paused, .Task and .Event), or json")
+	flags.BoolVar(&ctl_http, "http", false, "send the commands to the http api, even if tcp-address is set")
+	flags.DurationVarP(&ctl_timeout, "timeout", "t", 5*time.Second, "timeout of connecting to the daemon, and of its responses")
+	ctlCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, to_complete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return []string{"json", DEFAULT_CTL_FORMAT}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	ctlCmd.AddCommand(
+		ctlActionCmd("pause [0|1]", "toggle pause of the timer, or pause (1) or resume (0) it", cobra.MaximumNArgs(1)),
+		ctlActionCmd("next", "skip to the next mode", cobra.NoArgs),
+		ctlActionCmd("prev", "go back to the previous mode", cobra.NoArgs),
+		ctlActionCmd("reset", "reset the current mode", cobra.NoArgs),
+		ctlActionCmd("seek <duration>", "set the remaining duration, or add to it (+5m) or subtract from it (-5m)", cobra.ExactArgs(1)),
+		ctlStatusCmd,
+		ctlWatchCmd,
+	)
+}
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "control the running goje",
+	Long: fmt.Sprintf(`control the running goje, over its tcp daemon (or its http api if tcp-address is empty, or with --http). status and watch always use the http api. addresses are read from the config of goje.
+exits with %d if goje rejects the command`, EXIT_ACK),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return setupConfigForCmd(rootCmd)
+	},
+}
+
+var ctlStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "print the timer. requires http-address",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := ctlTemplate()
+		if err != nil {
+			return err
+		}
+		if config.HttpAddress == "" {
+			return errors.New("status requires http-address")
+		}
+		var status ctlStatus
+		if err := ctlRequest(http.MethodGet, "/timer", nil, &status.TimerResponse); err != nil {
+			return err
+		}
+		return printStatus(format, status)
+	},
+}
+
+var ctlWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "print the timer on each of its events, until interrupted. requires http-address",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := ctlTemplate()
+		if err != nil {
+			return err
+		}
+		if config.HttpAddress == "" {
+			return errors.New("watch requires http-address")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		stream := sse.NewClient(httpUrl() + "/api/v1/timer/stream")
+		stream.ReconnectNotify = func(err error, next time.Duration) {
+			slog.Warn("goje isn't reachable. reconnecting", "err", err, "in", next)
+		}
+		var print_err error
+		err = stream.SubscribeRawWithContext(ctx, func(msg *sse.Event) {
+			if !slices.Contains(timerEvents, string(msg.Event)) {
+				return
+			}
+			status := ctlStatus{Event: string(msg.Event)}
+			if err := json.Unmarshal(msg.Data, &status.TimerResponse); err != nil {
+				slog.Warn("invalid event", "err", err)
+				return
+			}
+			if err := printStatus(format, status); err != nil && print_err == nil {
+				print_err = err
+				stop()
+			}
+		})
+		if ctx.Err() != nil {
+			return print_err
+		}
+		return err
+	},
+}
+
+// ctlStatus is what the format of goje ctl is applied on
+type ctlStatus struct {
+	httpd.TimerResponse
+	// name of the event ("change", "start", "end", "pause" or "goal"). only
+	// set by watch
+	Event string `json:"event,omitempty"`
+}
+
+// ctlTemplate returns the template of --format. nil for json
+func ctlTemplate() (*template.Template, error) {
+	if ctl_format == "json" {
+		return nil, nil
+	}
+	return template.New("format").Parse(ctl_format)
+}
+
+func printStatus(format *template.Template, status ctlStatus) error {
+	if format == nil {
+		return json.NewEncoder(os.Stdout).Encode(status)
+	}
+	var buf bytes.Buffer
+	if err := format.Execute(&buf, status); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(os.Stdout)
+	return err
+}
+
+// ctlActionCmd returns the command of a tcp command, that changes the timer
+func ctlActionCmd(use, short string, args cobra.PositionalArgs) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  args,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ctlAction(cmd.Name(), args)
+		},
+	}
+}
+
+// ctlAction runs the action over the tcp daemon, or the http api
+func ctlAction(action string, args []string) error {
+	if config.TcpAddress != "" && !ctl_http {
+		return ctlTcp(strings.Join(append([]string{action}, args...), " "))
+	}
+	return ctlHttp(action, args)
+}
+
+// ctlTcp runs the command on the tcp daemon, and prints its output
+func ctlTcp(command string) error {
+	client, err := tcpd.Dial(config.TcpAddress, ctl_timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	out, err := client.Command(command)
+	fmt.Print(out)
+	return err
+}
+
+// ctlHttp runs the action on the http api. proposals of the actions that need
+// consensus are printed like the tcp daemon prints them
+func ctlHttp(action string, args []string) error {
+	var body any
+	switch action {
+	case tcpd.Pause:
+		var req httpd.PauseRequest
+		if len(args) == 0 {
+			var current httpd.TimerResponse
+			if err := ctlRequest(http.MethodGet, "/timer", nil, &current); err != nil {
+				return err
+			}
+			paused := !current.Paused
+			req.Paused = &paused
+		} else if args[0] == "1" || args[0] == "0" {
+			paused := args[0] == "1"
+			req.Paused = &paused
+		} else {
+			return tcpd.AckError{Command: action, Message: fmt.Sprintf("boolean (0/1) expected: %q", args[0])}
+		}
+		body = req
+	case tcpd.Seek:
+		duration, err := time.ParseDuration(args[0])
+		if err != nil {
+			return tcpd.AckError{Command: action, Message: err.Error()}
+		}
+		relative := strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-")
+		body = httpd.SeekRequest{Duration: (*httpd.Duration)(&duration), Relative: relative}
+	}
+	var proposal httpd.ProposalResponse
+	err := ctlRequest(http.MethodPost, "/timer/"+action, body, &proposal)
+	if err != nil || proposal.Id == 0 {
+		return err
+	}
+	argument := "-"
+	switch {
+	case proposal.Duration != 0:
+		argument = proposal.Duration.String()
+	case proposal.Mode != "":
+		argument = proposal.Mode
+	}
+	fmt.Printf("proposal: %d %s %s %s %d/%d\n", proposal.Id, proposal.Action, argument, proposal.Status, len(proposal.Approvals), proposal.Needed)
+	return nil
+}
+
+// ctlRequest sends a request to the v1 api, and decodes its response into
+// res. error responses of the api are returned as tcpd.AckError, so they exit
+// the same
+func ctlRequest(method, route string, body, res any) error {
+	if config.HttpAddress == "" {
+		return errors.New("neither tcp-address nor http-address is set")
+	}
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, httpUrl()+"/api/v1"+route, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := http.Client{Timeout: ctl_timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var res httpd.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil || res.Error == "" {
+			res.Error = resp.Status
+		}
+		return tcpd.AckError{Command: path.Base(route), Message: res.Error}
+	}
+	if resp.StatusCode == http.StatusAccepted || method == http.MethodGet {
+		return json.NewDecoder(resp.Body).Decode(res)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/mdns"
+	"github.com/nimaaskarian/goje/timer"
+	"github.com/spf13/cobra"
+)
+
+// dns-sd service type that goje daemons are advertised as
+const GOJE_SERVICE = "_goje._tcp"
+
+var (
+	discover_timeout time.Duration
+	discover_json    bool
+)
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+	discoverCmd.Flags().DurationVarP(&discover_timeout, "timeout", "t", 2*time.Second, "duration to wait for goje instances to answer")
+	discoverCmd.Flags().BoolVar(&discover_json, "json", false, "print the instances as json")
+}
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "list goje instances on the local network",
+	Long:  "list goje instances on the local network, that advertise their daemons with mDNS (the mdns option)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		services, err := mdns.Browse(context.Background(), GOJE_SERVICE, discover_timeout)
+		if err != nil {
+			return err
+		}
+		if discover_json {
+			return json.NewEncoder(os.Stdout).Encode(services)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INSTANCE\tPROTO\tADDRESS\tVERSION")
+		for _, service := range services {
+			instance, _ := service.Value("instance")
+			proto, _ := service.Value("proto")
+			version, _ := service.Value("version")
+			path, _ := service.Value("path")
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", instance, proto, service.Address()+path, version)
+		}
+		return w.Flush()
+	},
+}
+
+// instanceName returns the name that goje is advertised with
+func instanceName() string {
+	if config.InstanceName != "" {
+		return config.InstanceName
+	}
+	hostname, _ := os.Hostname()
+	return "goje on " + hostname
+}
+
+// advertise advertises the http and tcp daemons with mDNS until ctx is done
+func advertise(ctx context.Context) error {
+	var services []mdns.Service
+	add := func(proto, address string) error {
+		service := mdns.Service{
+			Instance: instanceName() + " (" + proto + ")",
+			Service:  GOJE_SERVICE,
+			Txt:      []string{"version=" + timer.VERSION, "instance=" + instanceName(), "proto=" + proto},
+		}
+		if proto != "tcp" && httpd.CleanBasePath(config.BasePath) != "" {
+			// dns-sd's key of the path of http services
+			service.Txt = append(service.Txt, "path="+httpd.CleanBasePath(config.BasePath))
+		}
+		if err := service.Listen(address); err != nil {
+			return err
+		}
+		services = append(services, service)
+		return nil
+	}
+	if config.HttpAddress != "" {
+		if err := add(httpScheme(), config.HttpAddress); err != nil {
+			return err
+		}
+	}
+	if config.TcpAddress != "" {
+		if err := add("tcp", config.TcpAddress); err != nil {
+			return err
+		}
+	}
+	if len(services) == 0 {
+		return nil
+	}
+	responder, err := mdns.NewResponder(services...)
+	if err != nil {
+		return err
+	}
+	go responder.Run(ctx)
+	return nil
+}
+
+// discoverOutbound returns the http address of the first goje instance on the
+// local network
+func discoverOutbound(timeout time.Duration) (string, error) {
+	services, err := mdns.Browse(context.Background(), GOJE_SERVICE, timeout)
+	if err != nil {
+		return "", err
+	}
+	for _, service := range services {
+		proto, _ := service.Value("proto")
+		if (proto == "http" || proto == "https") && service.Address() != "" {
+			instance, _ := service.Value("instance")
+			path, _ := service.Value("path")
+			slog.Info("discovered outbound server", "instance", instance, "address", service.Address()+path)
+			return proto + "://" + service.Address() + path, nil
+		}
+	}
+	return "", errors.New("no goje instances are found on the local network")
+}
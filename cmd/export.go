@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nimaaskarian/goje/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	export_format string
+	export_output string
+	export_since  time.Duration
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&export_format, "format", "F", "ics", "format of the export (ics or json)")
+	exportCmd.Flags().StringVarP(&export_output, "output", "O", "", "path to write the export on. writes to stdout if empty")
+	exportCmd.Flags().DurationVar(&export_since, "since", 0, "only export sessions started in this duration before now (exports all the sessions if 0)")
+	exportCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, to_complete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return []string{"ics", "json"}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export history of finished modes",
+	Long:  "export history of finished modes, from the history-file. or from the running goje's http api if history-file isn't set",
+	PreRunE: func(cmd *cobra.Command, args []string) (errout error) {
+		return setupConfigForCmd(rootCmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessions, err := loadHistory()
+		if err != nil {
+			return err
+		}
+		if export_since != 0 {
+			sessions = history.Since(sessions, time.Now().Add(-export_since))
+		}
+		var w io.Writer = os.Stdout
+		if export_output != "" {
+			file, err := os.Create(export_output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		switch export_format {
+		case "ics":
+			return history.WriteICS(w, sessions)
+		case "json":
+			return json.NewEncoder(w).Encode(sessions)
+		default:
+			return fmt.Errorf("invalid export format %q", export_format)
+		}
+	},
+}
+
+func loadHistory() ([]history.Session, error) {
+	if config.HistoryFile != "" {
+		slog.Info("loading history from file", "path", config.HistoryFile)
+		return history.Load(config.HistoryFile)
+	}
+	if config.HttpAddress == "" {
+		return nil, errors.New("neither history-file nor http-address is set")
+	}
+	address := httpUrl() + "/api/history"
+	slog.Info("loading history from http api", "address", address)
+	resp, err := http.Get(address)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting history failed: %s", resp.Status)
+	}
+	var sessions []history.Session
+	err = json.NewDecoder(resp.Body).Decode(&sessions)
+	return sessions, err
+}
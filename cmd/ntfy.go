@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"encoding/base64"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -55,6 +56,14 @@ func ntfySetup(config *AppConfig) {
 			}
 		}
 	})
+	config.Timer.Hooks.OnGoalReached.Append(func(pt *timer.PomodoroTimer) {
+		msg := fmt.Sprintf("Daily goal reached! Streak: %d days", pt.State.Daily.Streak)
+		if req, err := ntfyRequest(config, msg, "trophy"); err == nil {
+			if _, err := http.DefaultClient.Do(req); err != nil {
+				slog.Error("Failed to send ntfy request", "err", err)
+			}
+		}
+	})
 	if config.Timer.Paused {
 		config.Timer.Hooks.OnModeEnd.Append((func(pt *timer.PomodoroTimer) {
 			if pt.State.Mode == 2 {
@@ -3,26 +3,38 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/nimaaskarian/goje/activitywatch"
+	"github.com/nimaaskarian/goje/consensus"
+	"github.com/nimaaskarian/goje/fifo"
+	"github.com/nimaaskarian/goje/history"
 	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/inhibit"
+	"github.com/nimaaskarian/goje/metrics"
 	"github.com/nimaaskarian/goje/mpris"
+	"github.com/nimaaskarian/goje/outbound"
+	"github.com/nimaaskarian/goje/peersync"
+	"github.com/nimaaskarian/goje/schedule"
 	"github.com/nimaaskarian/goje/tcpd"
 	"github.com/nimaaskarian/goje/timer"
 	"github.com/nimaaskarian/goje/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 var config_file string
@@ -32,40 +44,96 @@ var quitting = false
 
 type AppConfig struct {
 	Timer                timer.TimerConfig
-	CustomCss            string `mapstructure:"custom-css,omitempty"`
-	Activitywatch        bool   `mapstructure:"activitywatch,omitempty"`
-	NoWebgui             bool   `mapstructure:"no-webgui,omitempty"`
-	NoOpenBrowser        bool   `mapstructure:"no-open-browser,omitempty"`
-	ExecStart            string `mapstructure:"exec-start,omitempty"`
-	ExecEnd              string `mapstructure:"exec-end,omitempty"`
-	ExecPause            string `mapstructure:"exec-pause,omitempty"`
-	ExecQuit             string `mapstructure:"exec-quit,omitempty"`
-	SyncExec             bool   `mapstructure:"sync-exec,omitempty"`
-	HttpAddress          string `mapstructure:"http-address,omitempty"`
-	TcpAddress           string `mapstructure:"tcp-address,omitempty"`
-	Fifo                 string `mapstructure:"fifo,omitempty"`
-	Loglevel             string `mapstructure:"loglevel,omitempty"`
-	Certfile             string `mapstructure:"certfile,omitempty"`
-	Keyfile              string `mapstructure:"keyfile,omitempty"`
-	Statefile            string `mapstructure:"statefile,omitempty"`
-	NtfyAddress          string `mapstructure:"ntfy-address,omitempty"`
-	NtfyClickUrl         string `mapstructure:"ntfy-click-url,omitempty"`
-	NtfyAuth             string `mapstructure:"ntfy-auth,omitempty"`
-	StatefileKeepUpdated bool   `mapstructure:"statefile-keep-updated,omitempty"`
-	Version              bool   `mapstructure:"version,omitempty"`
-	Help                 bool   `mapstructure:"help,omitempty"`
-	Mpris                bool   `mapstructure:"mpris,omitempty"`
-	MprisNoInstance      bool   `mapstructure:"mpris-no-instance,omitempty"`
+	CustomCss            string                   `mapstructure:"custom-css,omitempty"`
+	Activitywatch        bool                     `mapstructure:"activitywatch,omitempty"`
+	NoWebgui             bool                     `mapstructure:"no-webgui,omitempty"`
+	NoOpenBrowser        bool                     `mapstructure:"no-open-browser,omitempty"`
+	ExecStart            string                   `mapstructure:"exec-start,omitempty"`
+	ExecEnd              string                   `mapstructure:"exec-end,omitempty"`
+	ExecPause            string                   `mapstructure:"exec-pause,omitempty"`
+	ExecQuit             string                   `mapstructure:"exec-quit,omitempty"`
+	SyncExec             bool                     `mapstructure:"sync-exec,omitempty"`
+	HttpAddress          string                   `mapstructure:"http-address,omitempty"`
+	BasePath             string                   `mapstructure:"base-path,omitempty"`
+	TcpAddress           string                   `mapstructure:"tcp-address,omitempty"`
+	Fifo                 string                   `mapstructure:"fifo,omitempty"`
+	FifoFormat           string                   `mapstructure:"fifo-format,omitempty"`
+	FifoEvents           []string                 `mapstructure:"fifo-events,omitempty"`
+	Fifos                []fifo.Fifo              `mapstructure:"fifos,omitempty"`
+	Loglevel             string                   `mapstructure:"loglevel,omitempty"`
+	Certfile             string                   `mapstructure:"certfile,omitempty"`
+	Keyfile              string                   `mapstructure:"keyfile,omitempty"`
+	Acme                 bool                     `mapstructure:"acme,omitempty"`
+	AcmeDomains          []string                 `mapstructure:"acme-domains,omitempty"`
+	AcmeDirectory        string                   `mapstructure:"acme-directory,omitempty"`
+	AcmeCacheDir         string                   `mapstructure:"acme-cache-dir,omitempty"`
+	AcmeEmail            string                   `mapstructure:"acme-email,omitempty"`
+	AcmeCaFile           string                   `mapstructure:"acme-ca-file,omitempty"`
+	AcmeHttpAddress      string                   `mapstructure:"acme-http-address,omitempty"`
+	ClientCa             string                   `mapstructure:"client-ca,omitempty"`
+	ClientPermissions    []httpd.ClientPermission `mapstructure:"client-permissions,omitempty"`
+	Statefile            string                   `mapstructure:"statefile,omitempty"`
+	NtfyAddress          string                   `mapstructure:"ntfy-address,omitempty"`
+	NtfyClickUrl         string                   `mapstructure:"ntfy-click-url,omitempty"`
+	NtfyAuth             string                   `mapstructure:"ntfy-auth,omitempty"`
+	StatefileKeepUpdated bool                     `mapstructure:"statefile-keep-updated,omitempty"`
+	Version              bool                     `mapstructure:"version,omitempty"`
+	Help                 bool                     `mapstructure:"help,omitempty"`
+	Mpris                bool                     `mapstructure:"mpris,omitempty"`
+	MprisNoInstance      bool                     `mapstructure:"mpris-no-instance,omitempty"`
+	MprisOnPomodoro      string                   `mapstructure:"mpris-on-pomodoro,omitempty"`
+	MprisOnBreak         string                   `mapstructure:"mpris-on-break,omitempty"`
+	MprisVolume          float64                  `mapstructure:"mpris-volume,omitempty"`
+	MprisInclude         []string                 `mapstructure:"mpris-include,omitempty"`
+	MprisExclude         []string                 `mapstructure:"mpris-exclude,omitempty"`
+	Inhibit              bool                     `mapstructure:"inhibit,omitempty"`
+	InhibitWhat          string                   `mapstructure:"inhibit-what,omitempty"`
+	Schedule             []schedule.Rule          `mapstructure:"schedule,omitempty"`
+	HistoryFile          string                   `mapstructure:"history-file,omitempty"`
+	Metrics              bool                     `mapstructure:"metrics,omitempty"`
+	SseKeepalive         time.Duration            `mapstructure:"sse-keepalive,omitempty"`
+	SseReplay            int                      `mapstructure:"sse-replay,omitempty"`
+	SyncGroup            string                   `mapstructure:"sync-group,omitempty"`
+	SyncPeers            []string                 `mapstructure:"sync-peers,omitempty"`
+	SyncMdns             bool                     `mapstructure:"sync-mdns,omitempty"`
+	SyncInterval         time.Duration            `mapstructure:"sync-interval,omitempty"`
+	Mdns                 bool                     `mapstructure:"mdns,omitempty"`
+	InstanceName         string                   `mapstructure:"instance-name,omitempty"`
+	SharesFile           string                   `mapstructure:"shares-file,omitempty"`
+	Consensus            bool                     `mapstructure:"consensus,omitempty"`
+	ConsensusQuorum      float64                  `mapstructure:"consensus-quorum,omitempty"`
+	ConsensusTimeout     time.Duration            `mapstructure:"consensus-timeout,omitempty"`
 }
 
 var (
 	httpDaemon    *httpd.Daemon
+	tcpDaemon     *tcpd.Daemon
 	webguiAddress string
+	// kept across restarts, so history in memory isn't lost
+	recorder *history.Recorder
+	// connection to the outbound server. nil unless running goje client
+	outboundClient *outbound.Client
+	// member of the sync group. kept across restarts, so its logical clock isn't
+	// lost
+	syncer *peersync.Syncer
+	// kept across restarts, so the open proposal isn't lost
+	voting *consensus.Voting
+	// kept across restarts, so share links stay valid even without a file
+	shares *httpd.Shares
+	// writers of the fifos. closed when the fifos change, and watch the timer
+	// again on every restart
+	fifoWriters []*fifo.Writer
+	// kept across restarts, so the lock isn't taken twice. released when
+	// inhibiting is disabled, or what it inhibits changes
+	inhibitor *inhibit.Inhibitor
+	// kept across restarts, so the players that it has paused or lowered are
+	// restored by the next modes
+	controller *mpris.Controller
 )
 
 // objects that define a path. later used for utils.ExpandUser to get applied on all paths
 var filename_fields = []string{
-	"fifo", "certfile", "keyfile", "statefile", "custom-css", "exec-start", "exec-end", "exec-pause", "exec-quit",
+	"fifo", "certfile", "keyfile", "statefile", "custom-css", "exec-start", "exec-end", "exec-pause", "exec-quit", "history-file", "shares-file", "acme-cache-dir", "acme-ca-file", "client-ca",
 }
 
 var ctx context.Context
@@ -86,6 +154,9 @@ func rootFlags() *pflag.FlagSet {
 	flagset.UintP("sessions", "s", timer.DefaultConfig.Sessions, "count of sessions in timer")
 	flagset.BoolP("paused", "p", false, "timer is paused by default")
 	flagset.DurationP("duration-per-tick", "d", time.Second, "duration per each tick, that determines the accuracy of timer")
+	flagset.Uint("goal-pomodoros", 0, "daily goal of finished pomodoros (0 means no goal)")
+	flagset.Duration("goal-focus", 0, "daily goal of time spent in pomodoros (0 means no goal)")
+	flagset.Duration("day-boundary", 0, "time after midnight that a new day starts at, for daily goals (4h means days start at 04:00)")
 	flagset.String("custom-css", "", "a custom css file to load on the website")
 	flagset.String("exec-start", "", "command to run when any timer mode starts (run's the script with json of timer as the first arguemnt)")
 	flagset.String("exec-end", "", "command to run when any timer mode ends (run's the script with json of timer as the first arguemnt)")
@@ -94,18 +165,50 @@ func rootFlags() *pflag.FlagSet {
 	flagset.Bool("sync-exec", false, "run exec-* hooks synchronously, pausing the timer instead of asynchronously (default)")
 	flagset.StringP("tcp-address", "a", "localhost:7800", "address:[port] for tcp pomodoro daemon (doesn't run when empty)")
 	flagset.StringP("http-address", "A", "localhost:7900", "address:[port] for http pomodoro api (doesn't run when empty)")
+	flagset.String("base-path", "", "path prefix that the http api and webgui are served under, for reverse proxies (\"/goje\" for example)")
+	flagset.Duration("sse-keepalive", 15*time.Second, "period of keepalive comments on the http event stream, so proxies don't drop idle connections (0 disables them)")
+	flagset.Int("sse-replay", httpd.DEFAULT_REPLAY_SIZE, "count of recent events kept for replaying to reconnecting clients of the http event stream")
+	flagset.Bool("mdns", false, "advertise the http and tcp daemons on the local network with mDNS, for goje discover")
+	flagset.String("instance-name", "", "name that goje is advertised with on the local network (default \"goje on <hostname>\")")
+	flagset.String("sync-group", "", "name of a group of goje daemons to keep their timers in sync, without a central server (requires http-address)")
+	flagset.StringSlice("sync-peers", nil, "http addresses of the other members of the sync group")
+	flagset.Bool("sync-mdns", false, "advertise and discover the members of the sync group on the local network with mDNS")
+	flagset.Duration("sync-interval", peersync.DEFAULT_INTERVAL, "period of exchanging the timer with the members of the sync group")
+	flagset.String("shares-file", "", "path to a file that read-only share links of the webgui are kept in (links are only kept in memory if empty)")
+	flagset.Bool("consensus", false, "turn skips, resets and extensions of the timer into proposals, that apply when enough participants approve them")
+	flagset.Float64("consensus-quorum", consensus.DEFAULT_QUORUM, "fraction of the participants that more than it should approve a proposal (0.5 means a majority)")
+	flagset.Duration("consensus-timeout", consensus.DEFAULT_TIMEOUT, "duration that proposals expire after, if not approved")
 	flagset.Bool("no-webgui", false, "don't run webgui. webgui can't be run without the json server")
 	flagset.Bool("no-open-browser", false, "don't open the browser when running webgui")
 	flagset.Bool("activitywatch", false, "daemon send's pomodoro data to activitywatch if is present")
 	flagset.StringP("fifo", "f", "", "write timer events in a fifo at given path")
+	flagset.String("fifo-format", fifo.Json, "format of the fifo. a go template, or one of "+strings.Join(fifo.Presets, ", "))
+	flagset.StringSlice("fifo-events", fifo.DefaultEvents, "events that the fifo is written on ("+strings.Join(fifo.Events, ", ")+")")
 	flagset.String("certfile", "", "path to ssl certificate's cert file")
 	flagset.String("keyfile", "", "path to ssl certificate's key file")
+	flagset.String("client-ca", "", "path to the CA certificates of clients. clients of the http daemon are required to have a certificate signed by them")
+	flagset.Bool("acme", false, "serve https with certificates of acme-domains from an ACME CA (Let's Encrypt by default), instead of certfile and keyfile")
+	flagset.StringSlice("acme-domains", nil, "domains to get certificates of with ACME")
+	flagset.String("acme-directory", autocert.DefaultACMEDirectory, "directory url of the ACME CA")
+	flagset.String("acme-cache-dir", "", "directory to cache ACME certificates and account key in (default \"<user cache dir>/goje/acme\")")
+	flagset.String("acme-email", "", "contact email of the ACME account")
+	flagset.String("acme-ca-file", "", "path to root certificates to trust the ACME CA with (of a test CA like pebble)")
+	flagset.String("acme-http-address", "", "address of a plain http server for ACME's http-01 challenge, that redirects other requests to https (\":80\" for example)")
+	flagset.String("history-file", "", "path to a file that goje appends finished modes to, as json lines (history is only kept in memory if empty)")
 	flagset.String("statefile", "", "path a file that goje writes its state on when quitting, and recovering it on startup")
 	flagset.String("ntfy-address", "", "address to ntfy topic")
 	flagset.String("ntfy-click-url", "", "address to open on notification click of subscribers")
 	flagset.String("ntfy-auth", "", "username:password to access ntfy topic")
+	flagset.Bool("metrics", false, "expose prometheus metrics at /metrics of the http daemon")
 	flagset.Bool("mpris", false, "run a MPRIS interface for goje")
 	flagset.Bool("mpris-no-instance", false, "don't append instance to MPRIS's name")
+	flagset.String("mpris-on-pomodoro", mpris.ActionNone, "action on the other MPRIS players when a pomodoro starts ("+strings.Join(mpris.Actions, ", ")+")")
+	flagset.String("mpris-on-break", mpris.ActionNone, "action on the other MPRIS players when a break starts ("+strings.Join(mpris.Actions, ", ")+")")
+	flagset.Float64("mpris-volume", mpris.DEFAULT_LOWERED_VOLUME, "fraction of the volume that the lower action lowers the other MPRIS players to")
+	flagset.StringSlice("mpris-include", nil, "bus names of the other MPRIS players that are controlled (all of them if empty)")
+	flagset.StringSlice("mpris-exclude", nil, "bus names of the other MPRIS players that aren't controlled")
+	flagset.Bool("inhibit", false, "take a systemd-logind inhibitor lock while a pomodoro is running (and not paused)")
+	flagset.String("inhibit-what", inhibit.DEFAULT_WHAT, "colon separated list of what the inhibitor lock inhibits (idle, sleep, shutdown, ...)")
 	flagset.Bool("statefile-keep-updated", false, "keep state file updated; updating it on every kind of change (don't recommend this on a file on a SSD)")
 	return flagset
 }
@@ -185,6 +288,8 @@ func setupServerAndSignalWatcher(t *timer.PomodoroTimer) error {
 		case <-restartSig:
 			old_config = config
 			slog.Info("restart signal (SIGHUP) caught. restarting...")
+			// stops the loop, before its hooks are added again
+			cancel()
 		case <-ctx.Done():
 		}
 	}
@@ -288,6 +393,8 @@ func setupDaemons(t *timer.PomodoroTimer) error {
 	slog.Info("setting up daemons...")
 
 	t.Config = &config.Timer
+	// hooks are kept on restarts by SIGHUP. they're all added again below
+	config.Timer.Hooks = timer.TimerConfigHooks{}
 
 	for _, script := range []struct {
 		command     string
@@ -316,40 +423,35 @@ func setupDaemons(t *timer.PomodoroTimer) error {
 		}
 	}
 
-	if config.Fifo != old_config.Fifo {
-		slog.Info("using fifo", "path", config.Fifo)
-		utils.Mkfifo(config.Fifo)
-		writeToFifo := func(t *timer.PomodoroTimer) {
-			if quitting {
-				return
-			}
-			content, _ := json.Marshal(t)
-			go func() {
-				if err := os.WriteFile(config.Fifo, append(content, '\n'), 0644); err != nil {
-					slog.Error("writing to fifo failed", "err", err)
+	if !reflect.DeepEqual(fifos(&config), fifos(&old_config)) {
+		for _, w := range fifoWriters {
+			w.Close()
+		}
+		fifoWriters = nil
+		var writers []*fifo.Writer
+		for _, f := range fifos(&config) {
+			slog.Info("using fifo", "path", f.Path, "format", f.Format)
+			w, err := fifo.New(f)
+			if err != nil {
+				for _, w := range writers {
+					w.Close()
 				}
-			}()
-			slog.Debug("writing to fifo finished")
-		}
-		slog.Debug("setting up fifo events")
-		config.Timer.Hooks.OnQuit.Append(func(*timer.PomodoroTimer) {
-			slog.Debug("removing fifo", "path", config.Fifo)
-			if err := os.Remove(config.Fifo); err != nil {
-				slog.Error("remove fifo failed", "err", err)
+				return err
 			}
-		})
-		// initially write to fifo. for times that timer is loaded from a state and
-		// Hooks.OnInit wouldn't fire
-		writeToFifo(t)
-		config.Timer.Hooks.OnInit.Append(writeToFifo)
-		config.Timer.Hooks.OnChange.Append(writeToFifo)
-		config.Timer.Hooks.OnModeEnd.Append(writeToFifo)
-		config.Timer.Hooks.OnModeStart.Append(writeToFifo)
-	}
-	if config.NtfyAddress != old_config.NtfyAddress {
+			// initially write to fifo. for times that timer is loaded from a state and
+			// Hooks.OnInit wouldn't fire
+			w.Write(fifo.Init, t)
+			writers = append(writers, w)
+		}
+		fifoWriters = writers
+	}
+	for _, w := range fifoWriters {
+		w.AddEventWatchers(&config.Timer)
+	}
+	if config.NtfyAddress != "" {
 		ntfySetup(&config)
 	}
-	if config.Statefile != old_config.Statefile {
+	if config.Statefile != "" {
 		slog.Debug("appending statefile")
 		write_to_state_file := func(pt *timer.PomodoroTimer) {
 			slog.Debug("writing in state file", "statefile", config.Statefile)
@@ -371,6 +473,67 @@ func setupDaemons(t *timer.PomodoroTimer) error {
 		aw.Init()
 		aw.AddEventWatchers(&config.Timer)
 	}
+	if inhibitor != nil && (!config.Inhibit || config.InhibitWhat != old_config.InhibitWhat) {
+		if err := inhibitor.Release(); err != nil {
+			slog.Error("releasing inhibitor lock failed", "err", err)
+		}
+		inhibitor = nil
+	}
+	if config.Inhibit {
+		if inhibitor == nil {
+			var err error
+			if inhibitor, err = inhibit.NewInhibitor(config.InhibitWhat); err != nil {
+				return err
+			}
+		}
+		// initially update the lock. for times that timer is loaded from a state
+		// and Hooks.OnModeStart wouldn't fire
+		inhibitor.Update(t)
+		inhibitor.AddEventWatchers(&config.Timer)
+	}
+	if config.MprisOnPomodoro != mpris.ActionNone || config.MprisOnBreak != mpris.ActionNone {
+		opts := mpris.ControllerOpts{
+			OnPomodoro:    config.MprisOnPomodoro,
+			OnBreak:       config.MprisOnBreak,
+			LoweredVolume: config.MprisVolume,
+			Include:       config.MprisInclude,
+			Exclude:       config.MprisExclude,
+		}
+		var err error
+		if controller == nil {
+			controller, err = mpris.NewController(opts)
+		} else {
+			err = controller.SetOpts(opts)
+		}
+		if err != nil {
+			return err
+		}
+		controller.AddEventWatchers(&config.Timer)
+	} else if controller != nil {
+		// restores the volumes that it has lowered
+		if err := controller.Apply(mpris.ActionNone); err != nil {
+			slog.Error("restoring volumes of mpris players failed", "err", err)
+		}
+	}
+	if recorder == nil || config.HistoryFile != old_config.HistoryFile {
+		var err error
+		if recorder, err = history.NewRecorder(config.HistoryFile); err != nil {
+			return err
+		}
+	}
+	recorder.AddEventWatchers(&config.Timer)
+	if outboundClient != nil {
+		outboundClient.AddEventWatchers(&config.Timer)
+	}
+	var scheduler *schedule.Scheduler
+	if len(config.Schedule) != 0 {
+		var err error
+		if scheduler, err = schedule.NewScheduler(t, config.Schedule); err != nil {
+			return err
+		}
+		scheduler.AddEventWatchers(&config.Timer)
+		go scheduler.Run(ctx)
+	}
 
 	slog.Info("checking tcp", "old", old_config.TcpAddress, "new", config.TcpAddress)
 	if config.TcpAddress != old_config.TcpAddress {
@@ -380,32 +543,76 @@ func setupDaemons(t *timer.PomodoroTimer) error {
 			tcp_cancel()
 		}
 		tcp_ctx, tcp_cancel = context.WithCancel(context.Background())
-		tcp_daemon := tcpd.Daemon{
+		tcpDaemon = &tcpd.Daemon{
 			Timer: t,
 		}
-		if err := tcp_daemon.InitializeListener(config.TcpAddress); err != nil {
+		if err := tcpDaemon.InitializeListener(config.TcpAddress); err != nil {
 			return err
 		}
 		slog.Info("running tcp daemon", "address", config.TcpAddress)
-		go tcp_daemon.Run(tcp_ctx)
+		go tcpDaemon.Run(tcp_ctx)
 	}
-	if config.HttpAddress != old_config.HttpAddress {
+	tls_options := tlsOptions(&config)
+	if err := tls_options.Validate(); err != nil {
+		return err
+	}
+	if config.HttpAddress != old_config.HttpAddress || config.BasePath != old_config.BasePath || !reflect.DeepEqual(tls_options, tlsOptions(&old_config)) {
 		if http_cancel != nil {
 			http_cancel()
 		}
 		http_ctx, http_cancel = context.WithCancel(context.Background())
 		httpDaemon = &httpd.Daemon{
-			Timer:   t,
-			Clients: &sync.Map{},
+			Timer:    t,
+			Hub:      httpd.NewHub(httpd.DEFAULT_QUEUE_SIZE, config.SseReplay),
+			BasePath: config.BasePath,
 		}
 		httpDaemon.Init()
-		httpDaemon.SetupEvents()
 		httpDaemon.JsonRoutes()
+		httpDaemon.V1Routes()
+		httpDaemon.MetricsRoutes()
+		httpDaemon.ConsensusRoutes()
+		httpDaemon.ShareRoutes()
 		if !config.NoWebgui {
 			runWebgui(config.HttpAddress)
 		}
-		go httpDaemon.Run(config.HttpAddress, config.Certfile, config.Keyfile, http_ctx)
+		go httpDaemon.Run(config.HttpAddress, tls_options, http_ctx)
+	}
+	if httpDaemon != nil {
+		httpDaemon.SetupEvents()
+		httpDaemon.Keepalive = config.SseKeepalive
+		httpDaemon.Scheduler = scheduler
+		httpDaemon.History = recorder
+		httpDaemon.Outbound = outboundClient
+		httpDaemon.Sync = nil
+		if shares == nil || config.SharesFile != old_config.SharesFile {
+			var err error
+			if shares, err = httpd.NewShares(config.SharesFile); err != nil {
+				return err
+			}
+		}
+		httpDaemon.Shares = shares
+		permissions, err := httpd.ParsePermissions(config.ClientPermissions)
+		if err != nil {
+			return err
+		}
+		httpDaemon.ClientPermissions = permissions
+		var registry *metrics.Registry
+		if config.Metrics {
+			registry = setupMetrics(t)
+		}
+		httpDaemon.SetMetrics(registry)
+	}
+	if config.Mdns {
+		if err := advertise(ctx); err != nil {
+			return err
+		}
+	}
+	if config.SyncGroup != "" {
+		if err := setupSync(t); err != nil {
+			return err
+		}
 	}
+	setupConsensus(t)
 	if config.Mpris {
 		instance, err := mpris.NewInstance(t, &mpris.InstanceOpts{NoInstance: config.MprisNoInstance, WebguiAddress: webguiAddress})
 		if err != nil {
@@ -419,13 +626,164 @@ func setupDaemons(t *timer.PomodoroTimer) error {
 	return nil
 }
 
+func setupSync(t *timer.PomodoroTimer) error {
+	if config.HttpAddress == "" {
+		return errors.New("sync-group requires http-address")
+	}
+	if syncer == nil || config.SyncGroup != old_config.SyncGroup || !slices.Equal(config.SyncPeers, old_config.SyncPeers) {
+		peers := make([]string, len(config.SyncPeers))
+		for i, peer := range config.SyncPeers {
+			peers[i] = utils.FixHttpAddress(peer)
+		}
+		node := peersync.NewNodeId()
+		if syncer != nil {
+			node = syncer.Node
+		}
+		syncer = peersync.NewSyncer(node, config.SyncGroup, t, peers)
+	}
+	syncer.Scheme = httpScheme()
+	syncer.Address = httpUrl()
+	if config.SyncInterval > 0 {
+		syncer.Interval = config.SyncInterval
+	}
+	syncer.AddEventWatchers(&config.Timer)
+	httpDaemon.Sync = syncer
+	slog.Info("joining sync group", "group", config.SyncGroup, "node", syncer.Node)
+	go syncer.Run(ctx)
+	if config.SyncMdns {
+		if err := syncer.Advertise(ctx, instanceName(), config.HttpAddress); err != nil {
+			return err
+		}
+		go syncer.Discover(ctx)
+	}
+	return nil
+}
+
+func setupConsensus(t *timer.PomodoroTimer) {
+	current := voting
+	if !config.Consensus {
+		current = nil
+	} else if voting == nil {
+		voting = consensus.NewVoting(t, config.ConsensusQuorum, config.ConsensusTimeout)
+		voting.Voters = func() []string {
+			if httpDaemon == nil {
+				return nil
+			}
+			return httpDaemon.Participants.Voters()
+		}
+		voting.OnChange = func(p consensus.Proposal) {
+			if httpDaemon != nil {
+				httpDaemon.Hub.Broadcast(httpd.NewEvent(p, "proposal"))
+			}
+		}
+		current = voting
+	}
+	if current != nil {
+		current.Quorum = config.ConsensusQuorum
+		current.Timeout = config.ConsensusTimeout
+	}
+	if httpDaemon != nil {
+		httpDaemon.Voting = current
+	}
+	if tcpDaemon != nil {
+		tcpDaemon.Voting = current
+		// so the participants that tcp clients identify as can vote, and their
+		// actions are recorded as the actions of http requests are
+		if httpDaemon != nil && httpDaemon.Participants != nil {
+			tcpDaemon.Presence = httpDaemon.Participants
+			tcpDaemon.Act = httpDaemon.Act
+		}
+	}
+}
+
+// fifos returns the fifo of the fifo option, and the fifos of c. paths of
+// fifos are expanded, as they aren't in filename_fields
+func fifos(c *AppConfig) []fifo.Fifo {
+	var fifos []fifo.Fifo
+	if c.Fifo != "" {
+		fifos = append(fifos, fifo.Fifo{Path: c.Fifo, Format: c.FifoFormat, Events: c.FifoEvents})
+	}
+	expanduser, err := utils.NewExpandUser()
+	for _, f := range c.Fifos {
+		if err == nil {
+			f.Path = expanduser.Expand(f.Path)
+		}
+		fifos = append(fifos, f)
+	}
+	return fifos
+}
+
+// tlsOptions returns the options of serving https of c
+func tlsOptions(c *AppConfig) httpd.TLSOptions {
+	options := httpd.TLSOptions{
+		Certfile:    c.Certfile,
+		Keyfile:     c.Keyfile,
+		Acme:        c.Acme,
+		Domains:     c.AcmeDomains,
+		Directory:   c.AcmeDirectory,
+		CacheDir:    c.AcmeCacheDir,
+		Email:       c.AcmeEmail,
+		CAFile:      c.AcmeCaFile,
+		HttpAddress: c.AcmeHttpAddress,
+		ClientCA:    c.ClientCa,
+	}
+	if options.Acme && options.CacheDir == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			options.CacheDir = filepath.Join(dir, "goje", "acme")
+		}
+	}
+	return options
+}
+
+// httpScheme returns the scheme of the http daemon, "http" or "https"
+func httpScheme() string {
+	options := tlsOptions(&config)
+	if options.Enabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// httpUrl returns the url of the http daemon, including its base path. the
+// first ACME domain is its host with ACME
+func httpUrl() string {
+	address := config.HttpAddress
+	if config.Acme && len(config.AcmeDomains) != 0 {
+		_, port, _ := net.SplitHostPort(address)
+		address = config.AcmeDomains[0]
+		if port != "" && port != "443" {
+			address = net.JoinHostPort(address, port)
+		}
+	}
+	if strings.HasPrefix(address, ":") {
+		address = "localhost" + address
+	}
+	return httpScheme() + "://" + address + httpd.CleanBasePath(config.BasePath)
+}
+
+func setupMetrics(t *timer.PomodoroTimer) *metrics.Registry {
+	slog.Debug("setting up metrics")
+	registry := metrics.NewRegistry()
+	metrics.AddTimerMetrics(registry, t)
+	registry.GaugeFunc("goje_sse_clients", "connected SSE and websocket clients of the http daemon", func() float64 {
+		return float64(httpDaemon.ClientsCount())
+	})
+	registry.GaugeFunc("goje_tcp_clients", "connected clients of the tcp daemon", func() float64 {
+		if tcpDaemon == nil || config.TcpAddress == "" {
+			return 0
+		}
+		return float64(tcpDaemon.ClientsCount())
+	})
+	return registry
+}
+
 func runWebgui(address string) {
 	slog.Debug("setting up webgui routes")
 	httpDaemon.WebguiRoutes(config.CustomCss)
 	if !config.NoOpenBrowser {
 		// set webguiAddress used in mpris raise
-		webguiAddress = address
-		go utils.OpenURL(utils.FixHttpAddress(address))
+		webguiAddress = httpUrl() + "/"
+		go utils.OpenURL(webguiAddress)
 	}
 }
 
@@ -440,6 +798,9 @@ func runSystemCommand(t *timer.PomodoroTimer, cmd string) {
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		if errors.As(err, &tcpd.AckError{}) {
+			os.Exit(EXIT_ACK)
+		}
 		os.Exit(1)
 	}
 }
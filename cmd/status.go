@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/statusbar"
+	"github.com/nimaaskarian/goje/timer"
+	"github.com/r3labs/sse/v2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	status_format   string
+	status_template string
+	status_follow   bool
+)
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	flags := statusCmd.Flags()
+	// the same flags as goje ctl status, as clicks run its actions
+	flags.StringVarP(&status_format, "format", "f", statusbar.Template, "format of the status bar ("+strings.Join(statusbar.Formats, ", ")+")")
+	flags.StringVar(&status_template, "template", statusbar.DEFAULT_TEMPLATE, "go template of the text that the bar shows (of .Mode, .ModeName, .Remaining, .Paused, .Percentage, .FinishedSessions, .Sessions and .Task)")
+	flags.BoolVar(&status_follow, "follow", false, "print the status on each event of the timer, until interrupted (as goje ctl watch)")
+	flags.DurationVarP(&ctl_timeout, "timeout", "t", 5*time.Second, "timeout of connecting to the daemon, and of its responses")
+	statusCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, to_complete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return statusbar.Formats, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "print the timer for status bars",
+	Long: `print the timer in the protocol of a status bar (waybar's json, i3bar's json, polybar, tmux or just the template), from the http api of the running goje.
+clicks of i3bar (and BLOCK_BUTTON of i3blocks) run the actions of goje ctl: left click pauses, middle click resets, right click skips and scrolling seeks by a minute`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) (errout error) {
+		return setupConfigForCmd(rootCmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatter, err := statusbar.NewFormatter(status_format, status_template)
+		if err != nil {
+			return err
+		}
+		if exe, err := os.Executable(); err == nil {
+			formatter.Ctl = exe + " ctl"
+			if config_file != "" {
+				path, _ := filepath.Abs(config_file)
+				formatter.Ctl = exe + " -c '" + path + "' ctl"
+			}
+		}
+		if config.HttpAddress == "" {
+			return errors.New("status requires http-address")
+		}
+		// i3blocks runs the block again with the button that is clicked
+		if button, err := strconv.Atoi(os.Getenv("BLOCK_BUTTON")); err == nil {
+			if click, ok := statusbar.ClickOf(button); ok {
+				runClick(click)
+			}
+		}
+		if !status_follow {
+			var res httpd.TimerResponse
+			if err := ctlRequest(http.MethodGet, "/timer", nil, &res); err != nil {
+				slog.Warn("goje isn't reachable", "err", err)
+				return printLine(formatter, nil)
+			}
+			status := statusOf(res)
+			return printLine(formatter, &status)
+		}
+		return followStatus(formatter)
+	},
+}
+
+// statusOf returns the status of the timer of /api/v1/timer, as goje ctl
+// status gets it
+func statusOf(res httpd.TimerResponse) statusbar.Status {
+	t := timer.PomodoroTimer{Config: &timer.TimerConfig{Sessions: res.Sessions}}
+	for mode := range timer.MODE_MAX {
+		if mode.SnakeCase() == res.Mode {
+			t.State.Mode = mode
+		}
+		t.Config.Duration[mode] = time.Duration(res.Durations[mode.SnakeCase()])
+	}
+	t.State.Duration = time.Duration(res.Remaining)
+	t.State.Paused = res.Paused
+	t.State.FinishedSessions = res.FinishedSessions
+	t.State.Task = res.Task
+	return statusbar.NewStatus(&t)
+}
+
+func printLine(formatter *statusbar.Formatter, status *statusbar.Status) error {
+	line, err := formatter.Line(status)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(line)
+	return err
+}
+
+// runClick runs the action of a click, logging its error
+func runClick(click statusbar.Click) {
+	var args []string
+	if click.Argument != "" {
+		args = []string{click.Argument}
+	}
+	if err := ctlAction(click.Action, args); err != nil {
+		slog.Error("running the action of the click failed", "action", click.Action, "err", err)
+	}
+}
+
+// followStatus prints the status on each event of the timer's stream, and the
+// offline status when goje isn't reachable. clicks of i3bar are read from
+// stdin
+func followStatus(formatter *statusbar.Formatter) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Print(formatter.Header())
+	if formatter.Format == statusbar.I3bar {
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				if button, ok := statusbar.ParseI3barClick(scanner.Bytes()); ok {
+					if click, ok := statusbar.ClickOf(button); ok {
+						runClick(click)
+					}
+				}
+			}
+		}()
+	}
+	stream := sse.NewClient(httpUrl() + "/api/v1/timer/stream")
+	offline := func() {
+		if err := printLine(formatter, nil); err != nil {
+			slog.Error("printing the status failed", "err", err)
+		}
+	}
+	stream.OnDisconnect(func(*sse.Client) { offline() })
+	stream.ReconnectNotify = func(err error, next time.Duration) {
+		slog.Warn("goje isn't reachable. reconnecting", "err", err, "in", next)
+		offline()
+	}
+	var print_err error
+	err := stream.SubscribeRawWithContext(ctx, func(msg *sse.Event) {
+		if !slices.Contains(timerEvents, string(msg.Event)) {
+			return
+		}
+		var res httpd.TimerResponse
+		if err := json.Unmarshal(msg.Data, &res); err != nil {
+			slog.Warn("invalid event", "err", err)
+			return
+		}
+		status := statusOf(res)
+		if err := printLine(formatter, &status); err != nil && print_err == nil {
+			print_err = err
+			stop()
+		}
+	})
+	if ctx.Err() != nil {
+		return print_err
+	}
+	return err
+}
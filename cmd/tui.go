@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nimaaskarian/goje/tui"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [address]",
+	Short: "full-screen terminal client of goje",
+	Long:  "full-screen terminal client of the goje at address (as http://host:7900, with its base path), or of the http-address of the config if empty",
+	Args:  cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) (errout error) {
+		return setupConfigForCmd(rootCmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var address string
+		if len(args) == 1 {
+			address = args[0]
+			if !strings.Contains(address, "://") {
+				address = "http://" + address
+			}
+		} else if config.HttpAddress != "" {
+			address = httpUrl()
+		} else {
+			return errors.New("neither an address nor http-address is set")
+		}
+		return tui.Run(context.Background(), address)
+	},
+}
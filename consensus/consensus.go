@@ -0,0 +1,289 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// actions that need consensus
+const (
+	Next   = "next"
+	Prev   = "prev"
+	Reset  = "reset"
+	Extend = "extend"
+	Mode   = "mode"
+	// sets the remaining duration, when it's more than the current one
+	Seek = "seek"
+	// starts a new cycle
+	Init = "init"
+)
+
+// status of proposals
+const (
+	Open     = "open"
+	Approved = "approved"
+	Rejected = "rejected"
+	Expired  = "expired"
+)
+
+const (
+	DEFAULT_QUORUM  = 0.5
+	DEFAULT_TIMEOUT = time.Minute
+	// count of the closed proposals that are kept
+	RECENT_SIZE = 20
+)
+
+var (
+	ErrOpenProposal = errors.New("another proposal is open")
+	ErrNotFound     = errors.New("proposal isn't found")
+	ErrClosed       = errors.New("proposal is closed")
+	ErrAnonymous    = errors.New("anonymous participants can't propose or vote")
+	ErrNotVoter     = errors.New("only connected participants with a secret can propose or vote")
+)
+
+// Proposal is an action that is applied when enough participants approve it
+type Proposal struct {
+	Id uint64
+	// "next", "prev", "reset", "extend", "mode", "seek" or "init"
+	Action string
+	// duration to extend the current mode by for "extend", and the remaining
+	// duration to set for "seek"
+	Duration time.Duration `json:",omitempty"`
+	// mode to set the timer to. only for "mode"
+	Mode timer.PomodoroTimerMode `json:",omitempty"`
+	// participant who proposed it. empty for anonymous proposers
+	Proposer   string
+	Approvals  []string
+	Rejections []string
+	// count of approvals needed for the proposal to be applied
+	Needed  int
+	Created time.Time
+	Expires time.Time
+	// "open", "approved", "rejected" or "expired"
+	Status string
+}
+
+// NewProposal returns an open proposal of action, validating it
+func NewProposal(action string, duration time.Duration, mode timer.PomodoroTimerMode) (Proposal, error) {
+	p := Proposal{Action: action, Status: Open}
+	switch action {
+	case Next, Prev, Reset, Init:
+	case Seek:
+		if duration < 0 {
+			return p, fmt.Errorf("duration to seek to can't be negative")
+		}
+		p.Duration = duration
+	case Extend:
+		if duration <= 0 {
+			return p, fmt.Errorf("duration to extend by should be positive")
+		}
+		p.Duration = duration
+	case Mode:
+		if mode < 0 || mode >= timer.MODE_MAX {
+			return p, fmt.Errorf("invalid mode %d", mode)
+		}
+		p.Mode = mode
+	default:
+		return p, fmt.Errorf("invalid action %q. expected next, prev, reset, extend, mode, seek or init", action)
+	}
+	return p, nil
+}
+
+// same reports whether p and other propose the same change
+func (p *Proposal) same(other Proposal) bool {
+	return p.Action == other.Action && p.Duration == other.Duration && p.Mode == other.Mode
+}
+
+// Voting applies actions on the timer only after more than Quorum of the
+// voters approve them within Timeout. one proposal can be open at a time
+type Voting struct {
+	Timer *timer.PomodoroTimer
+	// fraction of the voters that more than it should approve a proposal. 0.5
+	// means a majority
+	Quorum  float64
+	Timeout time.Duration
+	// returns the ids of the voters (connected participants, that are claimed
+	// by their clients). only they can propose and vote, and proposals of a
+	// lonely voter are applied right away. callers should make sure that the
+	// voter they propose or vote as is owned by their client
+	Voters func() []string
+	// runs (synchronously) when a proposal is made, voted on or closed
+	OnChange func(Proposal)
+
+	mu     sync.Mutex
+	lastId uint64
+	open   *Proposal
+	recent []Proposal
+}
+
+func NewVoting(t *timer.PomodoroTimer, quorum float64, timeout time.Duration) *Voting {
+	return &Voting{Timer: t, Quorum: quorum, Timeout: timeout}
+}
+
+// needed returns the count of approvals needed out of voters
+func (v *Voting) needed(voters int) int {
+	needed := int(v.Quorum*float64(voters)) + 1
+	return max(min(needed, voters), 1)
+}
+
+func (v *Voting) voters() []string {
+	if v.Voters == nil {
+		return nil
+	}
+	return v.Voters()
+}
+
+// check returns an error if voter can't propose or vote
+func (v *Voting) check(voter string) error {
+	if voter == "" {
+		return ErrAnonymous
+	}
+	if !slices.Contains(v.voters(), voter) {
+		return ErrNotVoter
+	}
+	return nil
+}
+
+// Propose opens the proposal, approved by voter. proposing the same change as
+// the open proposal approves it instead
+func (v *Voting) Propose(voter string, p Proposal) (Proposal, error) {
+	if err := v.check(voter); err != nil {
+		return Proposal{}, err
+	}
+	v.mu.Lock()
+	if v.open != nil {
+		if !v.open.same(p) {
+			v.mu.Unlock()
+			return *v.open, ErrOpenProposal
+		}
+		id := v.open.Id
+		v.mu.Unlock()
+		return v.Vote(id, voter, true)
+	}
+	v.lastId++
+	p.Id = v.lastId
+	p.Proposer = voter
+	p.Status = Open
+	p.Created = time.Now()
+	p.Expires = p.Created.Add(v.Timeout)
+	v.open = &p
+	id := p.Id
+	time.AfterFunc(v.Timeout, func() { v.expire(id) })
+	v.mu.Unlock()
+	return v.Vote(id, voter, true)
+}
+
+// Vote approves or rejects the open proposal of id, on behalf of voter. a
+// voter can change its vote
+func (v *Voting) Vote(id uint64, voter string, approve bool) (Proposal, error) {
+	if err := v.check(voter); err != nil {
+		return Proposal{}, err
+	}
+	v.mu.Lock()
+	if v.open == nil || v.open.Id != id {
+		defer v.mu.Unlock()
+		for _, p := range v.recent {
+			if p.Id == id {
+				return p, ErrClosed
+			}
+		}
+		return Proposal{}, ErrNotFound
+	}
+	p := v.open
+	p.Approvals = slices.DeleteFunc(p.Approvals, func(s string) bool { return s == voter })
+	p.Rejections = slices.DeleteFunc(p.Rejections, func(s string) bool { return s == voter })
+	if approve {
+		p.Approvals = append(p.Approvals, voter)
+	} else {
+		p.Rejections = append(p.Rejections, voter)
+	}
+	voters := len(v.voters())
+	p.Needed = v.needed(voters)
+	switch {
+	case len(p.Approvals) >= p.Needed:
+		p.Status = Approved
+		v.apply(p)
+	case len(p.Rejections) > max(voters, 1)-p.Needed:
+		p.Status = Rejected
+	}
+	return v.changed()
+}
+
+// expire closes the proposal of id, if its still open
+func (v *Voting) expire(id uint64) {
+	v.mu.Lock()
+	if v.open == nil || v.open.Id != id {
+		v.mu.Unlock()
+		return
+	}
+	v.open.Status = Expired
+	v.changed()
+}
+
+// changed closes the open proposal if its not open anymore, unlocks v.mu and
+// runs OnChange
+func (v *Voting) changed() (Proposal, error) {
+	p := *v.open
+	p.Approvals = slices.Clone(p.Approvals)
+	p.Rejections = slices.Clone(p.Rejections)
+	if p.Status != Open {
+		v.open = nil
+		v.recent = append(v.recent, p)
+		if len(v.recent) > RECENT_SIZE {
+			v.recent = slices.Delete(v.recent, 0, len(v.recent)-RECENT_SIZE)
+		}
+	}
+	v.mu.Unlock()
+	if v.OnChange != nil {
+		v.OnChange(p)
+	}
+	return p, nil
+}
+
+// apply applies the action of an approved proposal on the timer. callers of
+// Propose and Vote should hold the timer's State.Mu
+func (v *Voting) apply(p *Proposal) {
+	switch p.Action {
+	case Next:
+		v.Timer.SwitchNextMode()
+	case Prev:
+		v.Timer.SwitchPrevMode()
+	case Reset:
+		v.Timer.Reset()
+	case Extend:
+		v.Timer.SeekAdd(p.Duration)
+	case Mode:
+		v.Timer.SetMode(p.Mode)
+	case Seek:
+		v.Timer.SeekTo(p.Duration)
+	case Init:
+		v.Timer.Init()
+	}
+}
+
+// Open returns the open proposal
+func (v *Voting) Open() (Proposal, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.open == nil {
+		return Proposal{}, false
+	}
+	return *v.open, true
+}
+
+// Proposals returns the recently closed proposals and the open one, oldest
+// first
+func (v *Voting) Proposals() []Proposal {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	proposals := slices.Clone(v.recent)
+	if v.open != nil {
+		proposals = append(proposals, *v.open)
+	}
+	return proposals
+}
@@ -0,0 +1,149 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func newTestVoting(voters ...string) *Voting {
+	config := timer.DefaultConfig
+	t := &timer.PomodoroTimer{Config: &config}
+	t.Init()
+	v := NewVoting(t, DEFAULT_QUORUM, time.Minute)
+	v.Voters = func() []string { return voters }
+	return v
+}
+
+func TestNeeded(t *testing.T) {
+	for _, item := range []struct {
+		quorum         float64
+		voters, needed int
+	}{
+		{0.5, 0, 1},
+		{0.5, 1, 1},
+		{0.5, 2, 2},
+		{0.5, 3, 2},
+		{0.5, 4, 3},
+		{0, 4, 1},
+		{1, 3, 3},
+	} {
+		v := Voting{Quorum: item.quorum}
+		if needed := v.needed(item.voters); needed != item.needed {
+			t.Fatalf("%d approvals needed out of %d voters with quorum %v. expected %d", needed, item.voters, item.quorum, item.needed)
+		}
+	}
+}
+
+func TestApproval(t *testing.T) {
+	v := newTestVoting("alice", "bob", "carol")
+	var changes int
+	v.OnChange = func(Proposal) { changes++ }
+	proposal, err := NewProposal(Next, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal, err = v.Propose("alice", proposal)
+	if err != nil || proposal.Status != Open || proposal.Needed != 2 {
+		t.Fatalf("proposal: %+v, err: %v", proposal, err)
+	}
+	if _, err := v.Propose("bob", Proposal{Action: Reset}); err != ErrOpenProposal {
+		t.Fatalf("another proposal was opened while one is open. err: %v", err)
+	}
+	if v.Timer.State.Mode != timer.Pomodoro {
+		t.Fatalf("timer has changed before the proposal is approved")
+	}
+	// proposing the same action approves it
+	proposal, err = v.Propose("bob", Proposal{Action: Next})
+	if err != nil || proposal.Status != Approved {
+		t.Fatalf("proposal: %+v, err: %v", proposal, err)
+	}
+	if v.Timer.State.Mode != timer.ShortBreak {
+		t.Fatalf("approved proposal isn't applied")
+	}
+	if _, err := v.Vote(proposal.Id, "carol", true); err != ErrClosed {
+		t.Fatalf("voted on a closed proposal. err: %v", err)
+	}
+	if _, ok := v.Open(); ok || changes != 2 {
+		t.Fatalf("proposal is still open, or OnChange ran %d times. expected 2", changes)
+	}
+}
+
+func TestRejection(t *testing.T) {
+	v := newTestVoting("alice", "bob", "carol")
+	proposal, _ := NewProposal(Extend, time.Minute, 0)
+	proposal, _ = v.Propose("alice", proposal)
+	proposal, _ = v.Vote(proposal.Id, "bob", false)
+	if proposal.Status != Open {
+		t.Fatalf("proposal is closed with a single rejection: %+v", proposal)
+	}
+	// votes can be changed
+	proposal, _ = v.Vote(proposal.Id, "alice", false)
+	if proposal.Status != Rejected {
+		t.Fatalf("proposal isn't rejected: %+v", proposal)
+	}
+	if v.Timer.State.Duration != v.Timer.Config.Duration[timer.Pomodoro] {
+		t.Fatalf("rejected proposal is applied")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	v := newTestVoting("alice", "bob")
+	v.Timeout = 10 * time.Millisecond
+	closed := make(chan Proposal, 1)
+	v.OnChange = func(p Proposal) {
+		if p.Status != Open {
+			closed <- p
+		}
+	}
+	v.Propose("alice", Proposal{Action: Reset})
+	select {
+	case p := <-closed:
+		if p.Status != Expired {
+			t.Fatalf("proposal: %+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("proposal didn't expire")
+	}
+}
+
+func TestLonelyProposer(t *testing.T) {
+	v := newTestVoting("alice")
+	proposal, err := v.Propose("alice", Proposal{Action: Next})
+	if err != nil || proposal.Status != Approved || v.Timer.State.Mode != timer.ShortBreak {
+		t.Fatalf("proposal of a lonely proposer isn't applied right away: %+v", proposal)
+	}
+}
+
+func TestVoters(t *testing.T) {
+	v := newTestVoting("alice", "bob")
+	if _, err := v.Propose("", Proposal{Action: Next}); err != ErrAnonymous {
+		t.Fatalf("anonymous proposal. err: %v", err)
+	}
+	if _, err := v.Propose("mallory", Proposal{Action: Next}); err != ErrNotVoter {
+		t.Fatalf("proposal of a participant that isn't present. err: %v", err)
+	}
+	proposal, _ := v.Propose("alice", Proposal{Action: Next})
+	if _, err := v.Vote(proposal.Id, "mallory", true); err != ErrNotVoter {
+		t.Fatalf("vote of a participant that isn't present. err: %v", err)
+	}
+	if p, _ := v.Open(); len(p.Approvals) != 1 || v.Timer.State.Mode != timer.Pomodoro {
+		t.Fatalf("vote of a participant that isn't present is counted: %+v", p)
+	}
+}
+
+func TestSeekAndInit(t *testing.T) {
+	v := newTestVoting("alice")
+	if _, err := NewProposal(Seek, -time.Minute, 0); err == nil {
+		t.Fatal("negative seek is accepted")
+	}
+	proposal, _ := NewProposal(Seek, time.Hour, 0)
+	if proposal, _ = v.Propose("alice", proposal); proposal.Status != Approved || v.Timer.State.Duration != time.Hour {
+		t.Fatalf("seek isn't applied: %+v", proposal)
+	}
+	v.Timer.SwitchNextMode()
+	if proposal, _ = v.Propose("alice", Proposal{Action: Init}); proposal.Status != Approved || v.Timer.State.Mode != timer.Pomodoro {
+		t.Fatalf("init isn't applied: %+v", proposal)
+	}
+}
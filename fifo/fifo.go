@@ -0,0 +1,211 @@
+// Package fifo writes the timer on named pipes, in presets or templates
+package fifo
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/nimaaskarian/goje/statusbar"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// presets of the format
+const (
+	// the whole timer, with its config
+	Json = "json"
+	// mode, remaining duration, pause, sessions and task
+	JsonCompact = "json-compact"
+	// "MM:SS mode"
+	Plain = "plain"
+	// plain, in the color of the mode as lemonbar's formatting
+	Lemonbar = "lemonbar"
+)
+
+var Presets = []string{Json, JsonCompact, Plain, Lemonbar}
+
+// events of the timer that fifos are written on
+const (
+	Init   = "init"
+	Change = "change"
+	Start  = "start"
+	End    = "end"
+	Pause  = "pause"
+	Goal   = "goal"
+)
+
+var Events = []string{Init, Change, Start, End, Pause, Goal}
+
+// events that fifos are written on, if their events are empty
+var DefaultEvents = []string{Init, Change, Start, End}
+
+// Fifo is a fifo in the config
+type Fifo struct {
+	Path string `mapstructure:"path"`
+	// serve a unix socket at Path instead of a fifo. every connected reader
+	// gets every line, while readers of a fifo split the lines between them
+	Socket bool `mapstructure:"socket,omitempty"`
+	// one of Presets, or a go template of Data. Json if empty
+	Format string `mapstructure:"format,omitempty"`
+	// events that the fifo is written on. DefaultEvents if empty
+	Events []string `mapstructure:"events,omitempty"`
+}
+
+// Data is what the templates of fifos are applied on
+type Data struct {
+	statusbar.Status
+	// event that the fifo is written on
+	Event string
+}
+
+type compact struct {
+	Mode      string `json:"mode"`
+	Remaining string `json:"remaining"`
+	// remaining duration in seconds
+	Seconds          int    `json:"seconds"`
+	Paused           bool   `json:"paused"`
+	FinishedSessions uint   `json:"finished_sessions"`
+	Sessions         uint   `json:"sessions"`
+	Task             string `json:"task"`
+	Event            string `json:"event"`
+}
+
+var presetTemplates = map[string]string{
+	Plain:    "{{.Remaining}} {{.Mode}}",
+	Lemonbar: "%{F{{color .}}}{{.Remaining}} {{.ModeName}}%{F-}",
+}
+
+// sink is where the lines are written on
+type sink interface {
+	// send sends a line (with its newline) without blocking
+	send(line []byte)
+	close() error
+}
+
+// Writer writes the timer on a fifo (or a unix socket), on its events
+type Writer struct {
+	Fifo
+	// formats the timer. the newline is added by Write
+	format func(data Data, t *timer.PomodoroTimer) ([]byte, error)
+	closed atomic.Bool
+	sink   sink
+}
+
+// New validates the format and events of the fifo, and makes it (or listens
+// on the socket)
+func New(f Fifo) (*Writer, error) {
+	w := &Writer{Fifo: f}
+	if len(w.Events) == 0 {
+		w.Events = DefaultEvents
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(Events, event) {
+			return nil, fmt.Errorf("invalid event %q of fifo %s. expected one of %s", event, f.Path, strings.Join(Events, ", "))
+		}
+	}
+	switch f.Format {
+	case Json, "":
+		w.format = func(_ Data, t *timer.PomodoroTimer) ([]byte, error) {
+			return json.Marshal(t)
+		}
+	case JsonCompact:
+		w.format = func(data Data, _ *timer.PomodoroTimer) ([]byte, error) {
+			return json.Marshal(compact{
+				Mode:             data.Mode,
+				Remaining:        data.Remaining,
+				Seconds:          int(data.Duration.Seconds()),
+				Paused:           data.Paused,
+				FinishedSessions: data.FinishedSessions,
+				Sessions:         data.Sessions,
+				Task:             data.Task,
+				Event:            data.Event,
+			})
+		}
+	default:
+		text, ok := presetTemplates[f.Format]
+		if !ok {
+			if !strings.Contains(f.Format, "{{") {
+				return nil, fmt.Errorf("invalid format %q of fifo %s. expected a go template, or one of %s", f.Format, f.Path, strings.Join(Presets, ", "))
+			}
+			text = f.Format
+		}
+		tmpl, err := template.New(f.Path).Funcs(template.FuncMap{
+			"color": func(data Data) string { return statusbar.Color(&data.Status) },
+		}).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		w.format = func(data Data, _ *timer.PomodoroTimer) ([]byte, error) {
+			var buf strings.Builder
+			err := tmpl.Execute(&buf, data)
+			return []byte(buf.String()), err
+		}
+	}
+	var err error
+	if f.Socket {
+		w.sink, err = listen(f.Path)
+	} else {
+		w.sink, err = newPipe(f.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Format returns the line of the timer on event, without the newline
+func (w *Writer) Format(event string, t *timer.PomodoroTimer) ([]byte, error) {
+	return w.format(Data{Status: statusbar.NewStatus(t), Event: event}, t)
+}
+
+// Write writes the timer on the fifo, if event is one of its events. it
+// doesn't block; lines that the readers aren't ready for are coalesced or
+// dropped
+func (w *Writer) Write(event string, t *timer.PomodoroTimer) {
+	if w.closed.Load() || !slices.Contains(w.Events, event) {
+		return
+	}
+	content, err := w.Format(event, t)
+	if err != nil {
+		slog.Error("formatting the fifo failed", "path", w.Path, "err", err)
+		return
+	}
+	w.sink.send(append(content, '\n'))
+}
+
+// AddEventWatchers writes the fifo on the events of the timer. the lines are
+// formatted and sent by the hooks synchronously (under the timer's
+// State.Mu), so they're sent in the order of the events, with the state of
+// their event
+func (w *Writer) AddEventWatchers(config *timer.TimerConfig) {
+	for event, hook := range map[string]*timer.TimerConfigHook{
+		Init:   &config.Hooks.OnInit,
+		Change: &config.Hooks.OnChange,
+		Start:  &config.Hooks.OnModeStart,
+		End:    &config.Hooks.OnModeEnd,
+		Pause:  &config.Hooks.OnPause,
+		Goal:   &config.Hooks.OnGoalReached,
+	} {
+		if slices.Contains(w.Events, event) {
+			hook.AppendSync(func(t *timer.PomodoroTimer) { w.Write(event, t) })
+		}
+	}
+	config.Hooks.OnQuit.Append(func(*timer.PomodoroTimer) {
+		slog.Debug("removing fifo", "path", w.Path)
+		if err := w.Close(); err != nil {
+			slog.Error("remove fifo failed", "err", err)
+		}
+	})
+}
+
+// Close stops writing on the fifo, and removes it
+func (w *Writer) Close() error {
+	if w.closed.Swap(true) {
+		return nil
+	}
+	return w.sink.close()
+}
@@ -0,0 +1,233 @@
+package fifo
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func newTimer() *timer.PomodoroTimer {
+	config := timer.DefaultConfig
+	t := &timer.PomodoroTimer{Config: &config}
+	t.Init()
+	t.State.Duration = 12*time.Minute + 34*time.Second
+	t.State.Task = "reviewing"
+	return t
+}
+
+func TestFormats(t *testing.T) {
+	pt := newTimer()
+	for format, want := range map[string]string{
+		Plain:    "12:34 pomodoro",
+		Lemonbar: "%{F#e06c75}12:34 Pomodoro%{F-}",
+		JsonCompact: `{"mode":"pomodoro","remaining":"12:34","seconds":754,"paused":false,` +
+			`"finished_sessions":0,"sessions":4,"task":"reviewing","event":"start"}`,
+		"{{.Event}}: {{.Task}} {{.Percentage}}%": "start: reviewing 50%",
+	} {
+		w, err := New(Fifo{Path: filepath.Join(t.TempDir(), "fifo"), Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := w.Format(Start, pt)
+		if err != nil || string(got) != want {
+			t.Fatalf("format %q: %s, want %s. err: %v", format, got, want, err)
+		}
+	}
+
+	w, _ := New(Fifo{Path: filepath.Join(t.TempDir(), "fifo")})
+	got, _ := w.Format(Change, pt)
+	var decoded struct {
+		Config struct{ Sessions uint }
+		State  struct{ Task string }
+	}
+	if err := json.Unmarshal(got, &decoded); err != nil || decoded.State.Task != "reviewing" || decoded.Config.Sessions != 4 {
+		t.Fatalf("json format isn't the whole timer: %s", got)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fifo")
+	if _, err := New(Fifo{Path: path, Format: "jsno"}); err == nil {
+		t.Fatal("a format that's neither a preset nor a template is accepted")
+	}
+	if _, err := New(Fifo{Path: path, Format: "{{.Remaining"}); err == nil {
+		t.Fatal("invalid template is accepted")
+	}
+	if _, err := New(Fifo{Path: path, Events: []string{"tick"}}); err == nil {
+		t.Fatal("invalid event is accepted")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no fifos on windows")
+	}
+	path := filepath.Join(t.TempDir(), "fifo")
+	w, err := New(Fifo{Path: path, Format: Plain, Events: []string{End}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := newTimer()
+	// filtered out
+	w.Write(Change, pt)
+	w.Write(End, pt)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil || line != "12:34 pomodoro\n" {
+		t.Fatalf("read %q from the fifo. err: %v", line, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("fifo isn't removed: %v", err)
+	}
+}
+
+// readLines reads n lines from r, failing the test if they take too long
+func readLines(t *testing.T, r io.Reader, n int) []string {
+	t.Helper()
+	lines := make(chan []string, 1)
+	go func() {
+		var read []string
+		scanner := bufio.NewScanner(r)
+		for len(read) < n && scanner.Scan() {
+			read = append(read, scanner.Text())
+		}
+		lines <- read
+	}()
+	select {
+	case read := <-lines:
+		return read
+	case <-time.After(5 * time.Second):
+		t.Fatalf("reading %d lines timed out", n)
+		return nil
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no fifos on windows")
+	}
+	path := filepath.Join(t.TempDir(), "fifo")
+	w, err := New(Fifo{Path: path, Format: "{{.Task}}", Events: []string{Change}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	pt := newTimer()
+	// without a reader, writes don't block and only the latest is kept
+	for _, task := range []string{"a", "b", "c"} {
+		pt.State.Task = task
+		w.Write(Change, pt)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if lines := readLines(t, file, 1); len(lines) != 1 || lines[0] != "c" {
+		t.Fatalf("read %q, expected only the latest line", lines)
+	}
+	// with a reader, lines arrive in order. some may be coalesced
+	for i := range 100 {
+		pt.State.Task = strconv.Itoa(i)
+		w.Write(Change, pt)
+	}
+	scanner := bufio.NewScanner(file)
+	last := -1
+	for last != 99 && scanner.Scan() {
+		i, err := strconv.Atoi(scanner.Text())
+		if err != nil || i <= last {
+			t.Fatalf("read %q after %d", scanner.Text(), last)
+		}
+		last = i
+	}
+}
+
+func TestSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix sockets on windows")
+	}
+	path := filepath.Join(t.TempDir(), "sock")
+	w, err := New(Fifo{Path: path, Socket: true, Format: "{{.Task}}", Events: []string{Change}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := newTimer()
+	w.Write(Change, pt)
+	var conns []net.Conn
+	for range 2 {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	// each reader gets the latest line first, so they're both connected
+	for _, conn := range conns {
+		if lines := readLines(t, conn, 1); lines[0] != "reviewing" {
+			t.Fatalf("read %q on connecting", lines)
+		}
+	}
+	for _, task := range []string{"a", "b"} {
+		pt.State.Task = task
+		w.Write(Change, pt)
+	}
+	for _, conn := range conns {
+		if lines := readLines(t, conn, 2); len(lines) != 2 || lines[0] != "a" || lines[1] != "b" {
+			t.Fatalf("read %q, expected every line", lines)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket isn't removed: %v", err)
+	}
+}
+
+func TestEventOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix sockets on windows")
+	}
+	path := filepath.Join(t.TempDir(), "sock")
+	w, err := New(Fifo{Path: path, Socket: true, Format: "{{.Task}}", Events: []string{Change}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	pt := newTimer()
+	w.AddEventWatchers(pt.Config)
+	pt.Changed()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// the latest line is read on connecting
+	readLines(t, conn, 1)
+	for i := range 50 {
+		pt.State.Task = strconv.Itoa(i)
+		pt.Changed()
+	}
+	for i, line := range readLines(t, conn, 50) {
+		if line != strconv.Itoa(i) {
+			t.Fatalf("read %q as line %d. lines are reordered", line, i)
+		}
+	}
+}
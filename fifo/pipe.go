@@ -0,0 +1,130 @@
+package fifo
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// interval of retrying a pending line, while the fifo has no reader or its
+	// reader isn't reading
+	RETRY_INTERVAL = 500 * time.Millisecond
+	// time that the reader has to make room for a line, before its coalesced
+	// with the next ones
+	WRITE_TIMEOUT = time.Second
+)
+
+// opening the fifo failed, as it has no reader
+var errNoReader = errors.New("fifo has no reader")
+
+// pipe writes lines on a fifo in order, from a single goroutine. the fifo is
+// opened without blocking, and kept open while it has a reader. only the
+// latest line is kept while it has no reader
+type pipe struct {
+	path string
+
+	mu      sync.Mutex
+	pending []byte
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newPipe(path string) (*pipe, error) {
+	if err := mkfifo(path); err != nil {
+		return nil, err
+	}
+	p := &pipe{
+		path:    path,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// send replaces the pending line with line
+func (p *pipe) send(line []byte) {
+	p.mu.Lock()
+	p.pending = line
+	p.mu.Unlock()
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pipe) take() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	line := p.pending
+	p.pending = nil
+	return line
+}
+
+// putBack makes line pending again, unless a newer line is sent meanwhile
+func (p *pipe) putBack(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending == nil {
+		p.pending = line
+	}
+}
+
+func (p *pipe) run() {
+	defer close(p.stopped)
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.notify:
+		case <-retry:
+		}
+		retry = nil
+		line := p.take()
+		if line == nil {
+			continue
+		}
+		if file == nil {
+			var err error
+			if file, err = openPipe(p.path); err != nil {
+				if !errors.Is(err, errNoReader) {
+					slog.Warn("opening the fifo failed", "path", p.path, "err", err)
+				}
+				p.putBack(line)
+				retry = time.After(RETRY_INTERVAL)
+				continue
+			}
+		}
+		file.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+		if _, err := file.Write(line); err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				// the reader has closed the fifo. its opened again when there's
+				// another reader
+				slog.Debug("fifo's reader is gone", "path", p.path, "err", err)
+				file.Close()
+				file = nil
+			}
+			p.putBack(line)
+			retry = time.After(RETRY_INTERVAL)
+		}
+	}
+}
+
+// close stops the writer, and removes the fifo
+func (p *pipe) close() error {
+	close(p.done)
+	<-p.stopped
+	return os.Remove(p.path)
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+// +build !unix
+
+package fifo
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoFifos = errors.New("fifos aren't supported on this platform. use a socket instead")
+
+func mkfifo(path string) error {
+	return errNoFifos
+}
+
+func openPipe(path string) (*os.File, error) {
+	return nil, errNoFifos
+}
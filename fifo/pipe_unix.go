@@ -0,0 +1,36 @@
+//go:build unix
+// +build unix
+
+package fifo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+func mkfifo(path string) error {
+	err := syscall.Mkfifo(path, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeNamedPipe == 0 {
+			return errors.New(path + " exists, and isn't a fifo")
+		}
+		return nil
+	}
+	return err
+}
+
+// openPipe opens the fifo for writing without blocking. it fails with
+// errNoReader if the fifo has no reader
+func openPipe(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return nil, errNoReader
+	}
+	return file, err
+}
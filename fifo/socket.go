@@ -0,0 +1,108 @@
+package fifo
+
+import (
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+)
+
+// count of the lines that are buffered for each reader of a socket. a reader
+// that falls further behind is disconnected
+const CLIENT_BUFFER = 16
+
+// socket is a unix socket that sends every line to all of its readers, as
+// newline delimited lines. readers get the latest line when they connect
+type socket struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[net.Conn]chan []byte
+	latest  []byte
+	closed  bool
+}
+
+func listen(path string) (*socket, error) {
+	// socket of a previous run, that isn't removed
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &socket{listener: listener, clients: map[net.Conn]chan []byte{}}
+	go s.accept()
+	return s, nil
+}
+
+func (s *socket) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		lines := make(chan []byte, CLIENT_BUFFER)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if s.latest != nil {
+			lines <- s.latest
+		}
+		s.clients[conn] = lines
+		s.mu.Unlock()
+		go s.serve(conn, lines)
+	}
+}
+
+func (s *socket) serve(conn net.Conn, lines chan []byte) {
+	for line := range lines {
+		if _, err := conn.Write(line); err != nil {
+			s.mu.Lock()
+			s.drop(conn)
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// drop disconnects the reader. s.mu should be held
+func (s *socket) drop(conn net.Conn) {
+	if lines, ok := s.clients[conn]; ok {
+		delete(s.clients, conn)
+		close(lines)
+	}
+	conn.Close()
+}
+
+func (s *socket) send(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.latest = line
+	for conn, lines := range s.clients {
+		select {
+		case lines <- line:
+		default:
+			slog.Warn("disconnecting a slow reader of the socket", "path", s.listener.Addr())
+			s.drop(conn)
+		}
+	}
+}
+
+// close disconnects the readers, and removes the socket
+func (s *socket) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.clients {
+		s.drop(conn)
+	}
+	return s.listener.Close()
+}
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// Session is a mode of the timer that has reached its end
+type Session struct {
+	Mode  timer.PomodoroTimerMode
+	Start time.Time
+	End   time.Time
+	Task  string `json:",omitempty"`
+}
+
+// Recorder records start and end of modes. its kept in memory, and also
+// appended to a file as json lines if path isn't empty
+type Recorder struct {
+	path     string
+	mu       sync.Mutex
+	sessions []Session
+	current  *Session
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	r := &Recorder{path: path}
+	if path != "" {
+		sessions, err := Load(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		r.sessions = sessions
+	}
+	return r, nil
+}
+
+// Load reads sessions from a history file
+func Load(path string) ([]Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var sessions []Session
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal(scanner.Bytes(), &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, scanner.Err()
+}
+
+// Sessions returns a copy of the recorded sessions
+func (r *Recorder) Sessions() []Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Session(nil), r.sessions...)
+}
+
+func (r *Recorder) start(pt *timer.PomodoroTimer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = &Session{
+		Mode:  pt.State.Mode,
+		Start: time.Now(),
+		Task:  pt.State.Task,
+	}
+}
+
+func (r *Recorder) end(pt *timer.PomodoroTimer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the mode might've been ended without ever starting, if the timer was
+	// loaded from a state
+	if r.current == nil || r.current.Mode != pt.State.Mode {
+		return
+	}
+	session := *r.current
+	r.current = nil
+	session.End = time.Now()
+	if pt.State.Task != "" {
+		session.Task = pt.State.Task
+	}
+	r.sessions = append(r.sessions, session)
+	if r.path != "" {
+		if err := r.appendToFile(session); err != nil {
+			slog.Error("writing to history file failed", "path", r.path, "err", err)
+		}
+	}
+}
+
+func (r *Recorder) appendToFile(session Session) error {
+	content, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(content, '\n'))
+	return err
+}
+
+// AddEventWatchers records the modes synchronously, so an end of mode isn't
+// handled after the start of the next one
+func (r *Recorder) AddEventWatchers(config *timer.TimerConfig) {
+	config.Hooks.OnModeStart.AppendSync(r.start)
+	config.Hooks.OnModeEnd.AppendSync(r.end)
+}
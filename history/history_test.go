@@ -0,0 +1,113 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2025, 5, 10, 9, 0, 0, 0, time.UTC)
+	sessions := []Session{
+		{Mode: timer.Pomodoro, Start: start, End: start.Add(25 * time.Minute), Task: "write docs, then; test"},
+		{Mode: timer.ShortBreak, Start: start.Add(25 * time.Minute), End: start.Add(30 * time.Minute)},
+	}
+	var buf bytes.Buffer
+	if err := WriteICS(&buf, sessions); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20250510T090000Z\r\n",
+		"DTEND:20250510T092500Z\r\n",
+		"SUMMARY:Pomodoro: write docs\\, then\\; test\r\n",
+		"SUMMARY:Short Break\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("%q not found in ics output:\n%s", expected, out)
+		}
+	}
+	if count := strings.Count(out, "BEGIN:VEVENT"); count != len(sessions) {
+		t.Fatalf("%d events written. expected %d", count, len(sessions))
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("گوجه", 40)
+	folded := foldLine(line)
+	for part := range strings.SplitSeq(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(part) > 75 {
+			t.Fatalf("folded line is %d octets long", len(part))
+		}
+	}
+	if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); unfolded != line {
+		t.Fatalf("unfolding %q doesn't result in the original line", folded)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := timer.PomodoroTimer{Config: &timer.DefaultConfig}
+	pt.State.Task = "goje"
+	r.start(&pt)
+	r.end(&pt)
+	// ending a mode that hasn't started shouldn't be recorded
+	pt.State.Mode = timer.ShortBreak
+	r.end(&pt)
+
+	sessions, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Task != "goje" || sessions[0].Mode != timer.Pomodoro {
+		t.Fatalf("unexpected sessions in history file: %+v", sessions)
+	}
+	r, err = NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Sessions()) != 1 {
+		t.Fatalf("recorder didn't load the history file: %+v", r.Sessions())
+	}
+}
+
+func TestRecorderLoop(t *testing.T) {
+	r, err := NewRecorder("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := timer.DefaultConfig
+	config.DurationPerTick = time.Millisecond
+	config.Duration = [timer.MODE_MAX]time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond}
+	r.AddEventWatchers(&config)
+	pt := timer.PomodoroTimer{Config: &config}
+	pt.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pt.Loop(ctx)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	// every mode that has ended is recorded, even though the next one starts
+	// right after it
+	sessions := r.Sessions()
+	if len(sessions) < 4 {
+		t.Fatalf("only %d sessions are recorded", len(sessions))
+	}
+	for i, session := range sessions[1:] {
+		if session.Mode == sessions[i].Mode {
+			t.Fatalf("mode %s is recorded twice in a row: %+v", session.Mode, sessions)
+		}
+	}
+}
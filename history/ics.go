@@ -0,0 +1,80 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const ICS_TIME_LAYOUT = "20060102T150405Z"
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// foldLine folds a content line into lines of at most 75 octets, as required
+// by RFC 5545. continuation lines start with a space
+func foldLine(line string) string {
+	const limit = 75
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func (s Session) Summary() string {
+	if s.Task != "" {
+		return s.Mode.String() + ": " + s.Task
+	}
+	return s.Mode.String()
+}
+
+// WriteICS writes sessions as VEVENTs of an iCalendar
+func WriteICS(w io.Writer, sessions []Session) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//goje//goje " + timer.VERSION + "//EN",
+		"CALSCALE:GREGORIAN",
+	}
+	for _, s := range sessions {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%d-%s@goje", s.Start.UnixNano(), s.Mode.WormCase()),
+			"DTSTAMP:"+s.End.UTC().Format(ICS_TIME_LAYOUT),
+			"DTSTART:"+s.Start.UTC().Format(ICS_TIME_LAYOUT),
+			"DTEND:"+s.End.UTC().Format(ICS_TIME_LAYOUT),
+			"SUMMARY:"+icsEscaper.Replace(s.Summary()),
+			"CATEGORIES:"+icsEscaper.Replace(s.Mode.String()),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldLine(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Since filters the sessions that started after t
+func Since(sessions []Session, t time.Time) []Session {
+	out := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		if s.Start.After(t) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
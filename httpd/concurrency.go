@@ -0,0 +1,60 @@
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag returns the timer's state version as an entity tag
+func (d *Daemon) etag() string {
+	return fmt.Sprintf(`"%d"`, d.Timer.State.Version)
+}
+
+// matchesEtag reports whether the value of an If-Match header matches etag
+func matchesEtag(header, etag string) bool {
+	for tag := range strings.SplitSeq(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// precondition is a middleware that serializes changes through the http api.
+// it rejects a change with 409 Conflict if its If-Match header doesn't match
+// the timer's current version. pauses, skips and resets that the request makes
+// are attributed to its participant
+func (d *Daemon) precondition(c *gin.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Timer.State.Mu.Lock()
+	defer d.Timer.State.Mu.Unlock()
+	if header := c.GetHeader("If-Match"); header != "" && !matchesEtag(header, d.etag()) {
+		c.Header("ETag", d.etag())
+		abortWithError(c, http.StatusConflict, fmt.Errorf("timer has changed. version %s doesn't match the current version %s", header, d.etag()))
+		return
+	}
+	defer d.Act(d.identify(c))()
+	c.Next()
+}
+
+// locked serializes handler, that reads the timer, with the changes
+func (d *Daemon) locked(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.Timer.State.Mu.Lock()
+		defer d.Timer.State.Mu.Unlock()
+		handler(c)
+	}
+}
+
+// respondTimer responds with the timer as json, and its version as ETag
+func (d *Daemon) respondTimer(c *gin.Context) {
+	c.Header("ETag", d.etag())
+	c.JSON(http.StatusOK, d.Timer)
+}
@@ -0,0 +1,266 @@
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nimaaskarian/goje/consensus"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// ProposalResponse is an action that is applied when enough participants
+// approve it
+type ProposalResponse struct {
+	Id uint64 `json:"id"`
+	// "next", "prev", "reset", "extend", "mode", "seek" or "init"
+	Action string `json:"action"`
+	// duration to extend the current mode by for "extend", and the remaining
+	// duration to set for "seek"
+	Duration Duration `json:"duration"`
+	// snake_case name of the mode to switch to. only for "mode"
+	Mode string `json:"mode"`
+	// participant who proposed it. empty for anonymous proposers
+	Proposer   string    `json:"proposer"`
+	Approvals  []string  `json:"approvals"`
+	Rejections []string  `json:"rejections"`
+	Needed     int       `json:"needed"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	// "open", "approved", "rejected" or "expired"
+	Status string `json:"status"`
+}
+
+func NewProposalResponse(p consensus.Proposal) ProposalResponse {
+	res := ProposalResponse{
+		Id:         p.Id,
+		Action:     p.Action,
+		Duration:   Duration(p.Duration),
+		Proposer:   p.Proposer,
+		Approvals:  p.Approvals,
+		Rejections: p.Rejections,
+		Needed:     p.Needed,
+		Created:    p.Created,
+		Expires:    p.Expires,
+		Status:     p.Status,
+	}
+	if p.Action == consensus.Mode {
+		res.Mode = p.Mode.SnakeCase()
+	}
+	return res
+}
+
+type ProposalRequest struct {
+	// "next", "prev", "reset", "extend", "mode", "seek" or "init"
+	Action   string   `json:"action"`
+	Duration Duration `json:"duration"`
+	// snake_case name of the mode. only for "mode"
+	Mode string `json:"mode"`
+}
+
+type VoteRequest struct {
+	Approve *bool `json:"approve"`
+}
+
+// STALE_DURATION is how much the remaining duration in a posted timer can be
+// more than the current one, without being a seek. its the timer that the
+// client has got a few ticks ago
+const STALE_DURATION = 2 * time.Second
+
+// votingStatus returns the status code of an error of the voting
+func votingStatus(err error) int {
+	switch err {
+	case consensus.ErrNotFound:
+		return http.StatusNotFound
+	case consensus.ErrAnonymous, consensus.ErrNotVoter, ErrNotOwner:
+		return http.StatusForbidden
+	}
+	return http.StatusConflict
+}
+
+// propose proposes the action instead of applying it, if consensus is enabled.
+// it responds 202 Accepted with the open proposal (in the v1 format if v1), 409
+// Conflict if another proposal is open, or 403 Forbidden if the participant
+// can't propose. returns false if the action should be applied right away, or
+// is applied already as its approved
+func (d *Daemon) propose(c *gin.Context, proposal consensus.Proposal, v1 bool) bool {
+	if d.Voting == nil {
+		return false
+	}
+	voter, err := d.voter(c)
+	if err == nil {
+		proposal, err = d.Voting.Propose(voter, proposal)
+	}
+	if err != nil {
+		abortWithError(c, votingStatus(err), err)
+		return true
+	}
+	if proposal.Status == consensus.Approved {
+		if v1 {
+			d.respondV1(c)
+		} else {
+			d.respondTimer(c)
+		}
+		return true
+	}
+	if v1 {
+		c.JSON(http.StatusAccepted, NewProposalResponse(proposal))
+	} else {
+		c.JSON(http.StatusAccepted, proposal)
+	}
+	return true
+}
+
+// proposalOf returns the proposal of an action without arguments
+func proposalOf(action string) consensus.Proposal {
+	proposal, _ := consensus.NewProposal(action, 0, 0)
+	return proposal
+}
+
+// proposalOfChange returns the proposal for the change of the timer to
+// changed, if it's a skip, reset, switch of mode or an increase of the
+// remaining duration. ok is false for other changes
+func proposalOfChange(current, changed *timer.PomodoroTimer) (proposal consensus.Proposal, ok bool) {
+	if changed.State.Mode != current.State.Mode {
+		next, prev := snapshot(current), snapshot(current)
+		next.SwitchNextMode()
+		prev.SwitchPrevMode()
+		switch changed.State.Mode {
+		case next.State.Mode:
+			proposal = proposalOf(consensus.Next)
+		case prev.State.Mode:
+			proposal = proposalOf(consensus.Prev)
+		default:
+			proposal, _ = consensus.NewProposal(consensus.Mode, 0, changed.State.Mode)
+		}
+		return proposal, true
+	}
+	full := current.Config.Duration[current.State.Mode]
+	if changed.State.Duration == full && current.State.Duration != full {
+		return proposalOf(consensus.Reset), true
+	}
+	if changed.State.Duration > current.State.Duration+STALE_DURATION {
+		proposal, _ = consensus.NewProposal(consensus.Seek, changed.State.Duration, 0)
+		return proposal, true
+	}
+	return proposal, false
+}
+
+func (d *Daemon) ConsensusRoutes() {
+	d.router.GET("/api/proposals", func(c *gin.Context) {
+		if d.Voting == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "consensus isn't enabled"})
+			return
+		}
+		c.JSON(http.StatusOK, d.Voting.Proposals())
+	})
+	d.router.POST("/api/proposals", d.precondition, func(c *gin.Context) {
+		if d.Voting == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "consensus isn't enabled"})
+			return
+		}
+		var req struct {
+			Action   string
+			Duration time.Duration
+			Mode     timer.PomodoroTimerMode
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		proposal, err := consensus.NewProposal(req.Action, req.Duration, req.Mode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		d.propose(c, proposal, false)
+	})
+	d.router.POST("/api/proposals/:id/vote", d.precondition, func(c *gin.Context) {
+		if d.Voting == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "consensus isn't enabled"})
+			return
+		}
+		var req struct{ Approve bool }
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+		voter, err := d.voter(c)
+		var proposal consensus.Proposal
+		if err == nil {
+			proposal, err = d.Voting.Vote(id, voter, req.Approve)
+		}
+		if err != nil {
+			c.JSON(votingStatus(err), gin.H{"Error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, proposal)
+	})
+}
+
+func (d *Daemon) v1ConsensusRoutes() []route {
+	enabled := func(c *gin.Context) bool {
+		if d.Voting == nil {
+			abortWithError(c, http.StatusNotFound, fmt.Errorf("consensus isn't enabled"))
+			return false
+		}
+		return true
+	}
+	return []route{
+		{http.MethodGet, "/proposals", "recent proposals, and the open one", nil, []ProposalResponse{}, func(c *gin.Context) {
+			if !enabled(c) {
+				return
+			}
+			proposals := d.Voting.Proposals()
+			res := make([]ProposalResponse, 0, len(proposals))
+			for _, p := range proposals {
+				res = append(res, NewProposalResponse(p))
+			}
+			c.JSON(http.StatusOK, res)
+		}},
+		{http.MethodPost, "/proposals", "propose an action. its applied when enough participants approve it", ProposalRequest{}, ProposalResponse{}, func(c *gin.Context) {
+			var req ProposalRequest
+			if !enabled(c) || !bindV1(c, &req) {
+				return
+			}
+			var mode timer.PomodoroTimerMode
+			if req.Action == consensus.Mode {
+				var err error
+				if mode, err = parseMode(req.Mode); err != nil {
+					abortWithError(c, http.StatusBadRequest, err)
+					return
+				}
+			}
+			proposal, err := consensus.NewProposal(req.Action, time.Duration(req.Duration), mode)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, err)
+				return
+			}
+			d.propose(c, proposal, true)
+		}},
+		{http.MethodPost, "/proposals/:id/vote", "approve or reject the open proposal", VoteRequest{}, ProposalResponse{}, func(c *gin.Context) {
+			var req VoteRequest
+			if !enabled(c) || !bindV1(c, &req) {
+				return
+			}
+			if req.Approve == nil {
+				abortWithError(c, http.StatusBadRequest, fmt.Errorf("approve is required"))
+				return
+			}
+			id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+			voter, err := d.voter(c)
+			var proposal consensus.Proposal
+			if err == nil {
+				proposal, err = d.Voting.Vote(id, voter, *req.Approve)
+			}
+			if err != nil {
+				abortWithError(c, votingStatus(err), err)
+				return
+			}
+			c.JSON(http.StatusOK, NewProposalResponse(proposal))
+		}},
+	}
+}
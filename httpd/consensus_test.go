@@ -0,0 +1,118 @@
+package httpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/consensus"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func TestConsensus(t *testing.T) {
+	d := newTestDaemon()
+	d.ConsensusRoutes()
+	d.Voting = consensus.NewVoting(d.Timer, consensus.DEFAULT_QUORUM, time.Minute)
+	d.Voting.Voters = d.Participants.Voters
+	d.Participants.Join("alice", "s-alice", "Alice", "")
+	d.Participants.Join("bob", "s-bob", "Bob", "")
+	// carol is only registered through the api, so she isn't a voter
+	d.Participants.Update("carol", "s-carol", "Carol", "")
+	sendAs := func(method, path, body, participant, secret string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(PARTICIPANT_HEADER, participant)
+		req.Header.Set(SECRET_HEADER, secret)
+		d.engine.ServeHTTP(w, req)
+		return w
+	}
+	send := func(method, path, body, participant string) *httptest.ResponseRecorder {
+		return sendAs(method, path, body, participant, "s-"+participant)
+	}
+
+	w := send("POST", "/api/v1/timer/next", "", "alice")
+	var proposal ProposalResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &proposal); err != nil || w.Code != http.StatusAccepted {
+		t.Fatalf("next isn't proposed: %d %s", w.Code, w.Body)
+	}
+	if proposal.Action != consensus.Next || proposal.Proposer != "alice" || proposal.Needed != 2 {
+		t.Fatalf("proposal: %+v", proposal)
+	}
+	if d.Timer.State.Mode != timer.Pomodoro {
+		t.Fatalf("timer has skipped before the proposal is approved")
+	}
+	if w := send("POST", "/api/timer/reset", "", "bob"); w.Code != http.StatusConflict {
+		t.Fatalf("another proposal is opened while one is open: %d %s", w.Code, w.Body)
+	}
+	// votes as a participant need its secret
+	for _, secret := range []string{"", "s-alice"} {
+		if w := sendAs("POST", "/api/v1/proposals/1/vote", `{"approve": true}`, "bob", secret); w.Code != http.StatusForbidden {
+			t.Fatalf("vote as bob with secret %q: %d %s", secret, w.Code, w.Body)
+		}
+	}
+	if w := send("POST", "/api/v1/proposals/1/vote", `{"approve": true}`, "carol"); w.Code != http.StatusForbidden {
+		t.Fatalf("vote of a participant that isn't connected: %d %s", w.Code, w.Body)
+	}
+	if d.Timer.State.Mode != timer.Pomodoro {
+		t.Fatalf("proposal is approved by a refused vote")
+	}
+	if w := send("POST", "/api/proposals/1/vote", `{"Approve": true}`, "bob"); w.Code != http.StatusOK {
+		t.Fatalf("vote failed: %d %s", w.Code, w.Body)
+	}
+	if d.Timer.State.Mode != timer.ShortBreak {
+		t.Fatalf("approved proposal isn't applied")
+	}
+	if w := send("POST", "/api/v1/proposals/1/vote", `{"approve": true}`, "bob"); w.Code != http.StatusConflict {
+		t.Fatalf("voted on a closed proposal: %d %s", w.Code, w.Body)
+	}
+	// pausing doesn't need consensus
+	if w := send("POST", "/api/v1/timer/pause", `{"paused": true}`, "bob"); w.Code != http.StatusOK {
+		t.Fatalf("pause is proposed: %d %s", w.Code, w.Body)
+	}
+	// neither does seeking back
+	if w := send("POST", "/api/v1/timer/seek", `{"duration": "1m"}`, "bob"); w.Code != http.StatusOK {
+		t.Fatalf("seeking back is proposed: %d %s", w.Code, w.Body)
+	}
+	if w := send("POST", "/api/v1/timer/next", "", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("anonymous proposal: %d %s", w.Code, w.Body)
+	}
+	if w := send("POST", "/api/v1/timer/next", "", "mallory"); w.Code != http.StatusForbidden {
+		t.Fatalf("proposal of a participant that isn't present: %d %s", w.Code, w.Body)
+	}
+	if w := send("PATCH", "/api/v1/timer", `{"mode": "pomodoro", "task": "x"}`, "alice"); w.Code != http.StatusBadRequest {
+		t.Fatalf("patch that switches the mode with other fields: %d %s", w.Code, w.Body)
+	}
+	// every switch of mode, and every increase of the remaining duration is
+	// proposed
+	for i, item := range []struct{ method, path, body, action string }{
+		{"PUT", "/api/v1/timer/mode", `{"mode": "long_break"}`, consensus.Mode},
+		{"PUT", "/api/v1/timer/mode", `{"mode": "short_break"}`, consensus.Reset},
+		{"POST", "/api/v1/timer/seek", `{"duration": "1h"}`, consensus.Seek},
+		{"POST", "/api/v1/timer/init", "", consensus.Init},
+		{"PATCH", "/api/v1/timer", `{"mode": "pomodoro"}`, consensus.Mode},
+		{"PATCH", "/api/v1/timer", `{"remaining": "30m"}`, consensus.Seek},
+		{"POST", "/api/timer", `{"State": {"Mode": 2}}`, consensus.Mode},
+		{"POST", "/api/timer", `{"State": {"Duration": 3600000000000}}`, consensus.Seek},
+	} {
+		w := send(item.method, item.path, item.body, "alice")
+		// fields of both the v1 and the legacy proposals
+		var proposal struct {
+			Id     uint64
+			Action string
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &proposal); err != nil || w.Code != http.StatusAccepted || proposal.Action != item.action {
+			t.Fatalf("%s %s isn't proposed as %s: %d %s", item.method, item.path, item.action, w.Code, w.Body)
+		}
+		if w := send("POST", fmt.Sprintf("/api/v1/proposals/%d/vote", proposal.Id), `{"approve": false}`, "bob"); w.Code != http.StatusOK {
+			t.Fatalf("rejecting proposal %d failed: %d %s", i, w.Code, w.Body)
+		}
+	}
+	if d.Timer.State.Mode != timer.ShortBreak || d.Timer.State.Duration != time.Minute {
+		t.Fatalf("rejected proposals are applied: %s %v", d.Timer.State.Mode, d.Timer.State.Duration)
+	}
+}
@@ -2,71 +2,178 @@ package httpd
 
 import (
 	"context"
-	"crypto/tls"
 	"log/slog"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
+	"github.com/nimaaskarian/goje/consensus"
+	"github.com/nimaaskarian/goje/history"
+	"github.com/nimaaskarian/goje/metrics"
+	"github.com/nimaaskarian/goje/outbound"
+	"github.com/nimaaskarian/goje/peersync"
+	"github.com/nimaaskarian/goje/schedule"
 	"github.com/nimaaskarian/goje/timer"
 )
 
 type Daemon struct {
-	engine     *gin.Engine
-	Timer      *timer.PomodoroTimer
-	lastId     uint
-	ClosingIds chan uint
-	Clients    *sync.Map
+	engine *gin.Engine
+	// group of the routes, at BasePath
+	router *gin.RouterGroup
+	// prefix that the webgui and the api are served under ("/goje" for
+	// example), for reverse proxies. empty serves them at the root
+	BasePath string
+	Timer    *timer.PomodoroTimer
+	// fans events out to the SSE and websocket clients
+	Hub *Hub
+	// period of keepalive comments of the SSE stream. zero disables them
+	Keepalive time.Duration
+	// optional. nil when no schedule is configured
+	Scheduler *schedule.Scheduler
+	History   *history.Recorder
+	// connection to the outbound server of goje client. /api/outbound responds
+	// 404 when nil
+	Outbound *outbound.Client
+	// member of a sync group. /api/sync responds 404 when nil
+	Sync *peersync.Syncer
+	// optional. skips, resets and extensions need consensus of the
+	// participants when set
+	Voting *consensus.Voting
+	// presence of participants and their actions. set by Init if nil
+	Participants *Participants
+	// read-only share links. set by Init (without a file) if nil
+	Shares *Shares
+	// permissions of the clients by the subjects of their certificates, when
+	// they're verified with TLSOptions.ClientCA. every verified client can
+	// write if empty
+	ClientPermissions map[string]Permission
+	// serializes changes through the http api. changes hold the lock of
+	// timer's state too, as the timer loop does
+	mu sync.Mutex
+	// the request that actions are attributed to. nil out of the requests
+	acting   *acting
+	actingMu sync.Mutex
+	// optional. /metrics responds 404 when nil. its replaced on reloads, while
+	// the daemon serves, so its accessed with registryMu
+	registry   *metrics.Registry
+	registryMu sync.Mutex
 }
 
+// SetMetrics sets the registry of /metrics. nil disables it
+func (d *Daemon) SetMetrics(registry *metrics.Registry) {
+	d.registryMu.Lock()
+	defer d.registryMu.Unlock()
+	d.registry = registry
+}
+
+// Metrics returns the registry of /metrics. nil if its disabled
+func (d *Daemon) Metrics() *metrics.Registry {
+	d.registryMu.Lock()
+	defer d.registryMu.Unlock()
+	return d.registry
+}
+
+// ClientsCount returns count of the connected SSE and websocket clients
+func (d *Daemon) ClientsCount() int {
+	return d.Hub.Count()
+}
+
+// SetupEvents broadcasts the events of the timer, and attributes its actions.
+// call it on every (re)load of config
 func (d *Daemon) SetupEvents() {
 	d.Timer.Config.Hooks.OnChange.Append(func(t *timer.PomodoroTimer) {
-		d.BroadcastToSSEClients(ChangeEvent(t))
+		d.Hub.Broadcast(ChangeEvent(lockedSnapshot(t)))
 	})
 	d.Timer.Config.Hooks.OnModeStart.Append(func(t *timer.PomodoroTimer) {
-		d.BroadcastToSSEClients(NewEvent(t, "start"))
+		d.Hub.Broadcast(NewEvent(lockedSnapshot(t), "start"))
 	})
 	d.Timer.Config.Hooks.OnModeEnd.Append(func(t *timer.PomodoroTimer) {
-		d.BroadcastToSSEClients(NewEvent(t, "end"))
+		d.Hub.Broadcast(NewEvent(lockedSnapshot(t), "end"))
 	})
 	d.Timer.Config.Hooks.OnPause.Append(func(t *timer.PomodoroTimer) {
-		d.BroadcastToSSEClients(NewEvent(t, "pause"))
+		d.Hub.Broadcast(NewEvent(lockedSnapshot(t), "pause"))
 	})
-}
-
-func (d *Daemon) BroadcastToSSEClients(e Event) {
-	d.Clients.Range(func(id any, value any) bool {
-		client := value.(chan Event)
-		client <- e
-		return true
+	d.Timer.Config.Hooks.OnGoalReached.Append(func(t *timer.PomodoroTimer) {
+		d.Hub.Broadcast(NewEvent(lockedSnapshot(t), "goal"))
 	})
+	d.watchActions()
 }
 
 func (d *Daemon) Init() {
 	gin.SetMode(gin.ReleaseMode)
+	d.BasePath = CleanBasePath(d.BasePath)
 	d.engine = gin.Default()
 	d.engine.Use(func(c *gin.Context) {
-		if !strings.HasPrefix(c.Request.URL.Path, "/api") {
+		path := strings.TrimPrefix(c.Request.URL.Path, d.BasePath)
+		if !strings.HasPrefix(path, "/api") && !strings.HasPrefix(path, "/share/") && path != "/metrics" {
 			c.Writer.Header().Set("Cache-Control", "public, max-age=31536000")
 		}
-	}, gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api"})))
+	}, gzip.Gzip(gzip.DefaultCompression,
+		gzip.WithExcludedPaths([]string{d.BasePath + "/api"}),
+		gzip.WithExcludedPathsRegexs([]string{"^" + regexp.QuoteMeta(d.BasePath) + "/share/[^/]+/api"}),
+	))
+	d.engine.Use(d.authorize)
+	d.router = d.engine.Group(d.BasePath)
+	if d.Participants == nil {
+		d.Participants = NewParticipants()
+	}
+	if d.Shares == nil {
+		d.Shares, _ = NewShares("")
+	}
+	d.Participants.OnChange = func(participants []Participant) {
+		d.Hub.Broadcast(NewEvent(participants, "participants"))
+	}
+	d.Participants.OnAction = func(action Action) {
+		d.Hub.Broadcast(NewEvent(action, "action"))
+	}
+}
+
+// CleanBasePath returns path with a leading slash and without a trailing one.
+// "" and "/" are the root, and are returned as ""
+func CleanBasePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// Handler returns the http handler of the daemon's routes
+func (d *Daemon) Handler() http.Handler {
+	return d.engine.Handler()
 }
 
-func (d *Daemon) Run(address, certfile, keyfile string, ctx context.Context) {
+// Run serves the daemon at address until ctx is done. it serves https if
+// tlsOptions is enabled
+func (d *Daemon) Run(address string, tlsOptions TLSOptions, ctx context.Context) {
 	httpServer := &http.Server{
 		Addr:    address,
-		Handler: d.engine.Handler(),
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		},
+		Handler: d.Handler(),
 	}
 
-	if certfile != "" && keyfile != "" {
-		slog.Info("running https daemon", "address", address, "certfile", certfile, "keyfile", keyfile)
+	if tlsOptions.Enabled() {
+		config, challenge, err := tlsOptions.config(ctx)
+		if err != nil {
+			slog.Error("setting up https failed", "err", err)
+			return
+		}
+		httpServer.TLSConfig = config
+		if challenge != nil && tlsOptions.HttpAddress != "" {
+			challengeServer := &http.Server{Addr: tlsOptions.HttpAddress, Handler: challenge}
+			defer challengeServer.Shutdown(context.Background())
+			go func() {
+				if err := challengeServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					slog.Error("acme http-01 challenge server failed", "err", err)
+				}
+			}()
+		}
+		slog.Info("running https daemon", "address", address, "certfile", tlsOptions.Certfile, "acme", tlsOptions.Acme, "domains", tlsOptions.Domains)
 		go func() {
-			if err := httpServer.ListenAndServeTLS(certfile, keyfile); err != nil && err != http.ErrServerClosed {
+			if err := httpServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 				slog.Error("https server failed", "err", err)
 			}
 		}()
@@ -79,8 +186,17 @@ func (d *Daemon) Run(address, certfile, keyfile string, ctx context.Context) {
 		}()
 	}
 
-	<-ctx.Done()
-	d.BroadcastToSSEClients(Event{Name: "restart"})
+	prune := time.NewTicker(PARTICIPANT_TTL / 2)
+	defer prune.Stop()
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-prune.C:
+			d.Participants.Prune()
+		}
+	}
+	d.Hub.Broadcast(Event{Name: "restart"})
 	slog.Info("shutting http server down...")
 	ctx = context.Background()
 	httpServer.Shutdown(ctx)
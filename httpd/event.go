@@ -1,6 +1,14 @@
 package httpd
 
+import (
+	"encoding/json"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
 type Event struct {
+	// given by the hub on broadcast
+	Id      uint64
 	Name    string
 	Payload any
 }
@@ -14,3 +22,20 @@ func NewEvent(payload any, name string) (e Event) {
 func ChangeEvent(payload any) Event {
 	return NewEvent(payload, "change")
 }
+
+// snapshot copies the timer, so payload of an event that might be replayed
+// later isn't changed with the timer
+func snapshot(pt *timer.PomodoroTimer) *timer.PomodoroTimer {
+	data, _ := json.Marshal(pt)
+	copy := &timer.PomodoroTimer{Config: &timer.TimerConfig{}}
+	json.Unmarshal(data, copy)
+	return copy
+}
+
+// lockedSnapshot is snapshot, that holds the lock of timer's state. use it out
+// of the handlers, as they hold the lock already
+func lockedSnapshot(pt *timer.PomodoroTimer) *timer.PomodoroTimer {
+	pt.State.Mu.Lock()
+	defer pt.State.Mu.Unlock()
+	return snapshot(pt)
+}
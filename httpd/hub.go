@@ -0,0 +1,211 @@
+package httpd
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_QUEUE_SIZE  = 16
+	DEFAULT_REPLAY_SIZE = 32
+)
+
+var (
+	ErrEvicted      = errors.New("client is evicted for being too slow")
+	ErrUnsubscribed = errors.New("client is unsubscribed")
+)
+
+// Hub fans the events out to the connected clients. each client has its own
+// bounded queue, so a slow client never blocks the broadcast. change events
+// are coalesced, as only the latest one matters. a client whose queue is full
+// anyway is evicted
+type Hub struct {
+	mu           sync.Mutex
+	lastId       uint64
+	lastClientId uint64
+	clients      map[uint64]*Client
+	// recent events (except for changes), to be replayed for resuming clients
+	replay     []Event
+	queueSize  int
+	replaySize int
+}
+
+func NewHub(queueSize, replaySize int) *Hub {
+	return &Hub{
+		clients:    make(map[uint64]*Client),
+		queueSize:  max(queueSize, 1),
+		replaySize: max(replaySize, 0),
+	}
+}
+
+// Client is a subscriber of a hub
+type Client struct {
+	Id        uint64
+	Kind      string
+	Address   string
+	UserAgent string
+	Connected time.Time
+	hub       *Hub
+	queue     []Event
+	// signaled when an event is queued
+	notify chan struct{}
+	// closed when client is unsubscribed or evicted
+	done    chan struct{}
+	evicted bool
+}
+
+// ClientInfo is a client as its exposed in the api
+type ClientInfo struct {
+	Id        uint64
+	Kind      string
+	Address   string
+	UserAgent string
+	Connected time.Time
+	Queued    int
+}
+
+// Subscribe adds a client of kind ("sse" or "websocket"). if resume, the events
+// after lastEventId that are still in the replay buffer are queued for it. the
+// client gets current (a change event) as its first event after those
+func (h *Hub) Subscribe(kind string, r *http.Request, lastEventId uint64, resume bool, current Event) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastClientId++
+	client := &Client{
+		Id:        h.lastClientId,
+		Kind:      kind,
+		Address:   r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+		Connected: time.Now(),
+		hub:       h,
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	if resume {
+		for _, e := range h.replay {
+			if e.Id > lastEventId {
+				client.queue = append(client.queue, e)
+			}
+		}
+		if len(client.queue) >= h.queueSize {
+			client.queue = client.queue[len(client.queue)-h.queueSize+1:]
+		}
+	}
+	current.Id = h.lastId
+	client.queue = append(client.queue, current)
+	client.notify <- struct{}{}
+	h.clients[client.Id] = client
+	return client
+}
+
+// Unsubscribe removes the client from the hub
+func (h *Hub) Unsubscribe(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(client)
+}
+
+func (h *Hub) remove(client *Client) {
+	if _, ok := h.clients[client.Id]; ok {
+		delete(h.clients, client.Id)
+		close(client.done)
+	}
+}
+
+// Broadcast gives the event the next id, and queues it for every client
+func (h *Hub) Broadcast(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastId++
+	e.Id = h.lastId
+	if e.Name != "change" && e.Name != "restart" && h.replaySize > 0 {
+		h.replay = append(h.replay, e)
+		if len(h.replay) > h.replaySize {
+			h.replay = slices.Delete(h.replay, 0, len(h.replay)-h.replaySize)
+		}
+	}
+	for _, client := range h.clients {
+		if e.Name == "change" {
+			client.queue = slices.DeleteFunc(client.queue, func(queued Event) bool {
+				return queued.Name == "change"
+			})
+		}
+		if len(client.queue) >= h.queueSize {
+			client.evicted = true
+			h.remove(client)
+			continue
+		}
+		client.queue = append(client.queue, e)
+		select {
+		case client.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Clients returns the connected clients, ordered by their id
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	infos := make([]ClientInfo, 0, len(h.clients))
+	for _, client := range h.clients {
+		infos = append(infos, ClientInfo{
+			Id:        client.Id,
+			Kind:      client.Kind,
+			Address:   client.Address,
+			UserAgent: client.UserAgent,
+			Connected: client.Connected,
+			Queued:    len(client.queue),
+		})
+	}
+	slices.SortFunc(infos, func(a, b ClientInfo) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	return infos
+}
+
+// Count returns count of the connected clients
+func (h *Hub) Count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Next waits for the client's next event. returns ErrEvicted or
+// ErrUnsubscribed if the client is removed from the hub, or ctx's error if its
+// done first
+func (client *Client) Next(ctx context.Context) (Event, error) {
+	for {
+		client.hub.mu.Lock()
+		if client.evicted {
+			client.hub.mu.Unlock()
+			return Event{}, ErrEvicted
+		}
+		if len(client.queue) > 0 {
+			e := client.queue[0]
+			client.queue = client.queue[1:]
+			client.hub.mu.Unlock()
+			return e, nil
+		}
+		client.hub.mu.Unlock()
+		select {
+		case <-client.notify:
+		case <-client.done:
+			return Event{}, ErrUnsubscribed
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		}
+	}
+}
+
+// Evicted reports whether the client was removed for being too slow
+func (client *Client) Evicted() bool {
+	client.hub.mu.Lock()
+	defer client.hub.mu.Unlock()
+	return client.evicted
+}
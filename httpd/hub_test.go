@@ -0,0 +1,109 @@
+package httpd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// drain returns the names of the queued events of client, without waiting
+func drain(client *Client) (names []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for {
+		e, err := client.Next(ctx)
+		if err != nil {
+			return
+		}
+		names = append(names, e.Name)
+	}
+}
+
+func TestHubCoalescesChanges(t *testing.T) {
+	hub := NewHub(4, 0)
+	client := hub.Subscribe("sse", httptest.NewRequest("GET", "/", nil), 0, false, ChangeEvent(nil))
+	hub.Broadcast(ChangeEvent(nil))
+	hub.Broadcast(NewEvent(nil, "start"))
+	for range 10 {
+		hub.Broadcast(ChangeEvent(nil))
+	}
+	got := drain(client)
+	if len(got) != 2 || got[0] != "start" || got[1] != "change" {
+		t.Fatalf("events aren't coalesced: %v", got)
+	}
+}
+
+func TestHubEvictsSlowClients(t *testing.T) {
+	hub := NewHub(2, 0)
+	slow := hub.Subscribe("sse", httptest.NewRequest("GET", "/", nil), 0, false, ChangeEvent(nil))
+	fast := hub.Subscribe("websocket", httptest.NewRequest("GET", "/", nil), 0, false, ChangeEvent(nil))
+	for range 3 {
+		hub.Broadcast(NewEvent(nil, "pause"))
+		drain(fast)
+	}
+	if !slow.Evicted() || fast.Evicted() {
+		t.Fatalf("evicted slow: %t, fast: %t", slow.Evicted(), fast.Evicted())
+	}
+	if _, err := slow.Next(context.Background()); err != ErrEvicted {
+		t.Fatalf("evicted client's next event returned %v", err)
+	}
+	if clients := hub.Clients(); len(clients) != 1 || clients[0].Id != fast.Id {
+		t.Fatalf("clients of hub: %+v", clients)
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	hub := NewHub(8, 2)
+	hub.Broadcast(NewEvent(nil, "start"))
+	hub.Broadcast(ChangeEvent(nil))
+	hub.Broadcast(NewEvent(nil, "pause"))
+	hub.Broadcast(NewEvent(nil, "end"))
+	client := hub.Subscribe("sse", httptest.NewRequest("GET", "/", nil), 2, true, ChangeEvent(nil))
+	e, _ := client.Next(context.Background())
+	if e.Name != "pause" || e.Id != 3 {
+		t.Fatalf("first replayed event is %+v", e)
+	}
+	if got := drain(client); len(got) != 2 || got[0] != "end" || got[1] != "change" {
+		t.Fatalf("replayed events: %v", got)
+	}
+	client = hub.Subscribe("sse", httptest.NewRequest("GET", "/", nil), 0, false, ChangeEvent(nil))
+	if got := drain(client); len(got) != 1 {
+		t.Fatalf("events replayed for a client that isn't resuming: %v", got)
+	}
+}
+
+func TestStreamKeepaliveAndResume(t *testing.T) {
+	d := newTestDaemon()
+	d.Keepalive = 50 * time.Millisecond
+	d.Hub.Broadcast(NewEvent(nil, "start"))
+	d.Hub.Broadcast(NewEvent(nil, "pause"))
+	server := httptest.NewServer(d.engine)
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL+"/api/timer/stream", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	stream := string(body)
+	if !strings.HasPrefix(stream, "id:2\nevent:pause\nretry:3000\n") {
+		t.Fatalf("stream doesn't start with the replayed event: %q", stream)
+	}
+	if strings.Count(stream, "retry:") != 1 {
+		t.Fatalf("retry is sent more than once: %q", stream)
+	}
+	if !strings.Contains(stream, "id:2\nevent:change\n") {
+		t.Fatalf("replayed event isn't followed by a change: %q", stream)
+	}
+	if !strings.Contains(stream, ": keepalive\n\n") {
+		t.Fatalf("no keepalives in the stream: %q", stream)
+	}
+}
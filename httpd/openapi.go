@@ -0,0 +1,169 @@
+package httpd
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+var (
+	durationType = reflect.TypeFor[Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+)
+
+// schemas generates json schemas of go types, in the openapi flavor.
+// named structs are put in components and referenced
+type schemas map[string]any
+
+func (s schemas) of(t reflect.Type) map[string]any {
+	if t == durationType {
+		return map[string]any{"type": "string", "format": "duration", "example": "25m0s"}
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if _, ok := s[t.Name()]; !ok {
+			// placeholder, so recursive types wouldn't recurse forever
+			s[t.Name()] = nil
+			properties := map[string]any{}
+			for i := range t.NumField() {
+				field := t.Field(i)
+				name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if !field.IsExported() || name == "-" {
+					continue
+				}
+				if name == "" {
+					name = field.Name
+				}
+				properties[name] = s.of(field.Type)
+			}
+			s[t.Name()] = map[string]any{"type": "object", "properties": properties}
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{"schema": schema},
+	}
+}
+
+// openapiSpec generates an openapi 3 document for routes under prefix
+func openapiSpec(prefix string, routes []route) map[string]any {
+	s := schemas{}
+	errorSchema := s.of(reflect.TypeFor[ErrorResponse]())
+	paths := map[string]map[string]any{}
+	for _, r := range routes {
+		operation := map[string]any{
+			"summary": r.summary,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content":     jsonContent(s.of(reflect.TypeOf(r.response))),
+				},
+			},
+		}
+		path, parameters := openapiPath(r.path)
+		if r.method != http.MethodGet {
+			parameters = append(parameters, map[string]any{
+				"name":        "If-Match",
+				"in":          "header",
+				"description": "version of the timer that the change is based on",
+				"schema":      map[string]any{"type": "string"},
+			})
+			operation["responses"].(map[string]any)["409"] = map[string]any{
+				"description": "timer has changed since the version in If-Match",
+				"content":     jsonContent(errorSchema),
+			}
+		}
+		if r.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(s.of(reflect.TypeOf(r.request))),
+			}
+			operation["responses"].(map[string]any)["400"] = map[string]any{
+				"description": "invalid request",
+				"content":     jsonContent(errorSchema),
+			}
+		}
+		if strings.HasSuffix(r.path, "/stream") {
+			operation["responses"] = map[string]any{
+				"200": map[string]any{
+					"description": "server-sent events",
+					"content": map[string]any{
+						"text/event-stream": map[string]any{"schema": s.of(reflect.TypeOf(r.response))},
+					},
+				},
+			}
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(r.method)] = operation
+	}
+	paths["/openapi.json"] = map[string]any{
+		strings.ToLower(http.MethodGet): map[string]any{
+			"summary": "this document",
+			"responses": map[string]any{
+				"200": map[string]any{"description": "OK"},
+			},
+		},
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "goje",
+			"version": timer.VERSION,
+		},
+		"servers": []map[string]any{{"url": prefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": map[string]any(s),
+		},
+	}
+}
+
+// openapiPath returns path with gin's ":id" parameters as openapi's "{id}",
+// and the parameters
+func openapiPath(path string) (string, []map[string]any) {
+	var parameters []map[string]any
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+			parameters = append(parameters, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), parameters
+}
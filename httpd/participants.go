@@ -0,0 +1,370 @@
+package httpd
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const (
+	// header (or query) that identifies the participant who made a request
+	PARTICIPANT_HEADER = "X-Goje-Participant"
+	// header (or "secret" query) of the secret that the participant is claimed
+	// with. only requests with it act as the participant
+	SECRET_HEADER = "X-Goje-Participant-Secret"
+	// participants that are registered through the api, without connecting to
+	// the stream, are dropped after this long without an update
+	PARTICIPANT_TTL = 2 * time.Minute
+	// count of the recent actions that are kept
+	ACTIONS_SIZE = 100
+)
+
+// ErrNotOwner is returned for a participant that is claimed with another
+// secret
+var ErrNotOwner = errors.New("participant is claimed with another secret")
+
+// Participant is a member of a shared session. its present while its
+// connected to the event stream (or websocket), or is updated through the api
+// recently
+type Participant struct {
+	Id   string
+	Name string
+	// what the participant is working on
+	Task   string
+	Joined time.Time
+	// count of the connected streams of the participant
+	Connections int
+	// last registration through the api. zero if the participant only uses
+	// streams
+	Updated time.Time `json:",omitzero"`
+	// the participant is claimed with it by its first client that has one.
+	// only the clients with it can act as the participant
+	secret string
+}
+
+// Action is a pause, resume, skip or reset of the timer, and who did it
+type Action struct {
+	Time time.Time
+	// "pause", "resume", "skip" or "reset"
+	Action string
+	// mode of the timer after the action
+	Mode timer.PomodoroTimerMode
+	// id of the participant. empty if the request wasn't identified
+	Participant string `json:",omitempty"`
+	Name        string `json:",omitempty"`
+}
+
+// Participants keeps track of the presence of participants, and the actions
+// they've made
+type Participants struct {
+	mu           sync.Mutex
+	participants map[string]*Participant
+	actions      []Action
+	// runs (synchronously) when a participant joins, leaves or is updated
+	OnChange func([]Participant)
+	// runs (synchronously) when an action is recorded
+	OnAction func(Action)
+}
+
+func NewParticipants() *Participants {
+	return &Participants{participants: map[string]*Participant{}}
+}
+
+// Join adds a connection of the participant. name and task are updated if
+// they're not empty. returns ErrNotOwner if secret doesn't match the secret
+// that the participant is claimed with
+func (p *Participants) Join(id, secret, name, task string) error {
+	p.mu.Lock()
+	participant := p.get(id)
+	if err := claim(participant, secret); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	participant.Connections++
+	p.set(participant, name, task)
+	p.changed()
+	return nil
+}
+
+// Leave removes a connection of the participant. the participant leaves with
+// its last connection, unless its updated through the api recently
+func (p *Participants) Leave(id string) {
+	p.mu.Lock()
+	participant, ok := p.participants[id]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	participant.Connections--
+	if participant.Connections <= 0 && time.Since(participant.Updated) > PARTICIPANT_TTL {
+		delete(p.participants, id)
+	}
+	p.changed()
+}
+
+// Update registers the participant through the api. it should be updated
+// again before PARTICIPANT_TTL, unless its connected to a stream. returns
+// ErrNotOwner like Join
+func (p *Participants) Update(id, secret, name, task string) (Participant, error) {
+	p.mu.Lock()
+	participant := p.get(id)
+	if err := claim(participant, secret); err != nil {
+		p.mu.Unlock()
+		return Participant{}, err
+	}
+	participant.Updated = time.Now()
+	participant.Name = name
+	participant.Task = task
+	copied := *participant
+	p.changed()
+	return copied, nil
+}
+
+// Remove removes the participant, regardless of its connections. returns
+// ErrNotOwner like Join
+func (p *Participants) Remove(id, secret string) (bool, error) {
+	p.mu.Lock()
+	participant, ok := p.participants[id]
+	if !ok {
+		p.mu.Unlock()
+		return false, nil
+	}
+	if participant.secret != secret {
+		p.mu.Unlock()
+		return false, ErrNotOwner
+	}
+	delete(p.participants, id)
+	p.changed()
+	return true, nil
+}
+
+// Owns reports whether secret is the secret that the participant of id is
+// claimed with
+func (p *Participants) Owns(id, secret string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	participant, ok := p.participants[id]
+	return ok && secret != "" && participant.secret == secret
+}
+
+// Claimed reports whether the participant of id is claimed with a secret
+func (p *Participants) Claimed(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	participant, ok := p.participants[id]
+	return ok && participant.secret != ""
+}
+
+// Voters returns the ids of the participants that can propose and vote: the
+// ones that are connected to a stream, and are claimed with a secret.
+// registering through the api doesn't make a voter, so a client can't make up
+// voters without keeping their connections
+func (p *Participants) Voters() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []string
+	for _, participant := range p.participants {
+		if participant.Connections > 0 && participant.secret != "" {
+			ids = append(ids, participant.Id)
+		}
+	}
+	return ids
+}
+
+// Prune removes the participants that aren't connected, and haven't been
+// updated for PARTICIPANT_TTL
+func (p *Participants) Prune() {
+	p.mu.Lock()
+	pruned := false
+	for id, participant := range p.participants {
+		if participant.Connections <= 0 && time.Since(participant.Updated) > PARTICIPANT_TTL {
+			delete(p.participants, id)
+			pruned = true
+		}
+	}
+	if !pruned {
+		p.mu.Unlock()
+		return
+	}
+	p.changed()
+}
+
+// get returns the participant of id, adding it if its not present. p.mu
+// should be held
+func (p *Participants) get(id string) *Participant {
+	participant, ok := p.participants[id]
+	if !ok {
+		participant = &Participant{Id: id, Name: id, Joined: time.Now()}
+		p.participants[id] = participant
+	}
+	return participant
+}
+
+// claim claims the participant with secret, if its not claimed yet. a claimed
+// participant can only be joined or updated with its secret. p.mu should be
+// held
+func claim(participant *Participant, secret string) error {
+	if participant.secret == "" {
+		participant.secret = secret
+		return nil
+	}
+	if participant.secret != secret {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (p *Participants) set(participant *Participant, name, task string) {
+	if name != "" {
+		participant.Name = name
+	}
+	if task != "" {
+		participant.Task = task
+	}
+}
+
+// changed unlocks p.mu and runs OnChange
+func (p *Participants) changed() {
+	list := p.listLocked()
+	p.mu.Unlock()
+	if p.OnChange != nil {
+		p.OnChange(list)
+	}
+}
+
+// List returns the present participants, in order of joining
+func (p *Participants) List() []Participant {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.listLocked()
+}
+
+func (p *Participants) listLocked() []Participant {
+	list := make([]Participant, 0, len(p.participants))
+	for _, participant := range p.participants {
+		list = append(list, *participant)
+	}
+	slices.SortFunc(list, func(a, b Participant) int {
+		return cmp.Or(a.Joined.Compare(b.Joined), cmp.Compare(a.Id, b.Id))
+	})
+	return list
+}
+
+// Record records the action of participant id (empty if unknown)
+func (p *Participants) Record(id, action string, mode timer.PomodoroTimerMode) Action {
+	p.mu.Lock()
+	a := Action{Time: time.Now(), Action: action, Mode: mode, Participant: id}
+	if participant, ok := p.participants[id]; ok {
+		a.Name = participant.Name
+	} else {
+		a.Name = id
+	}
+	p.actions = append(p.actions, a)
+	if len(p.actions) > ACTIONS_SIZE {
+		p.actions = slices.Delete(p.actions, 0, len(p.actions)-ACTIONS_SIZE)
+	}
+	p.mu.Unlock()
+	if p.OnAction != nil {
+		p.OnAction(a)
+	}
+	return a
+}
+
+// Actions returns the recent actions, oldest first
+func (p *Participants) Actions() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.actions)
+}
+
+// participantOf returns the id of the participant who made the request
+func participantOf(c *gin.Context) string {
+	if id := c.GetHeader(PARTICIPANT_HEADER); id != "" {
+		return id
+	}
+	return c.Query("participant")
+}
+
+// secretOf returns the secret of the participant who made the request
+func secretOf(c *gin.Context) string {
+	if secret := c.GetHeader(SECRET_HEADER); secret != "" {
+		return secret
+	}
+	return c.Query("secret")
+}
+
+// identify returns the participant that the request acts as. requests with
+// the id of a participant that is claimed with another secret are anonymous
+func (d *Daemon) identify(c *gin.Context) string {
+	id := participantOf(c)
+	if id == "" || !d.Participants.Claimed(id) || d.Participants.Owns(id, secretOf(c)) {
+		return id
+	}
+	return ""
+}
+
+// voter returns the participant that the request proposes or votes as. it
+// should own the participant
+func (d *Daemon) voter(c *gin.Context) (string, error) {
+	id := participantOf(c)
+	if id != "" && !d.Participants.Owns(id, secretOf(c)) {
+		return "", ErrNotOwner
+	}
+	return id, nil
+}
+
+// acting is the request that is being handled, and the actions it has made
+type acting struct {
+	participant string
+	actions     []string
+}
+
+// Act makes the actions of the timer to be attributed to participant, until
+// the returned function is called. the actions are recorded then, with the
+// timer's mode at that time. hold d.Timer.State.Mu until then, so changes of
+// others (as the scheduler), that hold it too, aren't attributed. the http
+// handlers use it, and so does tcpd for its commands
+func (d *Daemon) Act(participant string) (done func()) {
+	d.actingMu.Lock()
+	d.acting = &acting{participant: participant}
+	d.actingMu.Unlock()
+	return func() {
+		d.actingMu.Lock()
+		a := d.acting
+		d.acting = nil
+		d.actingMu.Unlock()
+		for _, action := range a.actions {
+			d.Participants.Record(a.participant, action, d.Timer.State.Mode)
+		}
+	}
+}
+
+// acted adds action to the actions of the request that is being handled.
+// actions out of the requests aren't attributed
+func (d *Daemon) acted(action string) {
+	d.actingMu.Lock()
+	defer d.actingMu.Unlock()
+	if d.acting != nil {
+		d.acting.actions = append(d.acting.actions, action)
+	}
+}
+
+// watchActions attributes the pauses, resumes, skips and resets of the timer,
+// as its hooks run them
+func (d *Daemon) watchActions() {
+	hooks := &d.Timer.Config.Hooks
+	hooks.OnSkip.AppendSync(func(*timer.PomodoroTimer) { d.acted("skip") })
+	hooks.OnReset.AppendSync(func(*timer.PomodoroTimer) { d.acted("reset") })
+	hooks.OnPause.AppendSync(func(t *timer.PomodoroTimer) {
+		if t.State.Paused {
+			d.acted("pause")
+		} else {
+			d.acted("resume")
+		}
+	})
+}
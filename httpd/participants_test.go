@@ -0,0 +1,112 @@
+package httpd
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParticipantsPresence(t *testing.T) {
+	p := NewParticipants()
+	var changes int
+	p.OnChange = func([]Participant) { changes++ }
+	p.Join("alice", "", "Alice", "reading")
+	p.Join("alice", "", "", "")
+	p.Join("bob", "", "", "")
+	p.Leave("alice")
+	list := p.List()
+	if len(list) != 2 || list[0].Name != "Alice" || list[0].Task != "reading" || list[0].Connections != 1 || list[1].Name != "bob" {
+		t.Fatalf("participants: %+v", list)
+	}
+	p.Leave("alice")
+	if list := p.List(); len(list) != 1 || list[0].Id != "bob" {
+		t.Fatalf("participant didn't leave with its last connection: %+v", list)
+	}
+
+	// participants of the api stay until they time out
+	p.Update("carol", "", "Carol", "writing")
+	p.Join("carol", "", "", "")
+	p.Leave("carol")
+	p.Prune()
+	if list := p.List(); len(list) != 2 || list[1].Task != "writing" {
+		t.Fatalf("participant of the api isn't present: %+v", list)
+	}
+	if changes != 8 {
+		t.Fatalf("OnChange ran %d times. expected 8", changes)
+	}
+}
+
+func TestParticipantsOwnership(t *testing.T) {
+	p := NewParticipants()
+	if err := p.Join("alice", "s-alice", "Alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Join("alice", "guess", "Mallory", ""); err != ErrNotOwner {
+		t.Fatalf("participant is joined with another secret. err: %v", err)
+	}
+	if _, err := p.Update("alice", "", "Mallory", ""); err != ErrNotOwner {
+		t.Fatalf("participant is updated without its secret. err: %v", err)
+	}
+	if _, err := p.Remove("alice", "guess"); err != ErrNotOwner {
+		t.Fatalf("participant is removed with another secret. err: %v", err)
+	}
+	if !p.Owns("alice", "s-alice") || p.Owns("alice", "") || p.List()[0].Name != "Alice" {
+		t.Fatalf("participant isn't owned by its secret: %+v", p.List())
+	}
+	// registering through the api, or joining without a secret doesn't make a
+	// voter
+	p.Update("bob", "s-bob", "", "")
+	p.Join("carol", "", "", "")
+	if voters := p.Voters(); len(voters) != 1 || voters[0] != "alice" {
+		t.Fatalf("voters: %q", voters)
+	}
+}
+
+func TestActionAttribution(t *testing.T) {
+	d := newTestDaemon()
+	d.Participants.Join("alice", "", "Alice", "")
+	d.Participants.Join("dave", "s-dave", "Dave", "")
+	for _, item := range []struct {
+		method, path, body, participant string
+	}{
+		{"POST", "/api/timer/pause", "", "alice"},
+		{"POST", "/api/v1/timer/pause", `{"paused": false}`, "bob"},
+		{"POST", "/api/v1/timer/seek", `{"duration": "1m"}`, "alice"},
+		{"POST", "/api/timer/reset", "", ""},
+		{"POST", "/api/v1/timer/next", "", "alice"},
+		{"PUT", "/api/v1/timer/task", `{"task": "ignored"}`, "alice"},
+		// switching the mode isn't a skip, and seeking to the whole duration
+		// isn't a reset
+		{"PUT", "/api/v1/timer/mode", `{"mode": "long_break"}`, "alice"},
+		{"POST", "/api/v1/timer/seek", `{"duration": "30m"}`, "alice"},
+		{"POST", "/api/timer", `{"State": {"Paused": true}}`, "carol"},
+		// dave is claimed with a secret, that the request doesn't have
+		{"POST", "/api/timer/pause", "", "dave"},
+	} {
+		req := httptest.NewRequest(item.method, item.path, strings.NewReader(item.body))
+		req.Header.Set("Content-Type", "application/json")
+		if item.participant != "" {
+			req.Header.Set(PARTICIPANT_HEADER, item.participant)
+		}
+		d.engine.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	want := []Action{
+		{Action: "pause", Participant: "alice", Name: "Alice"},
+		{Action: "resume", Participant: "bob", Name: "bob"},
+		{Action: "reset"},
+		{Action: "skip", Participant: "alice", Name: "Alice"},
+		{Action: "pause", Participant: "carol", Name: "carol"},
+		{Action: "resume"},
+	}
+	actions := d.Participants.Actions()
+	if len(actions) != len(want) {
+		t.Fatalf("recorded actions: %+v", actions)
+	}
+	for i, action := range actions {
+		action.Time, action.Mode = time.Time{}, 0
+		if action != want[i] {
+			t.Fatalf("action %d is %+v. expected %+v", i, action, want[i])
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package httpd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is what a client with a certificate is allowed to do
+type Permission int
+
+const (
+	// rejected
+	PermissionNone Permission = iota
+	// only reads the timer and its events
+	PermissionRead
+	// reads and changes the timer
+	PermissionWrite
+)
+
+// key of the gin context that the permission of the client is set on
+const permissionKey = "goje-permission"
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionRead:
+		return "read"
+	case PermissionWrite:
+		return "write"
+	default:
+		return "none"
+	}
+}
+
+func ParsePermission(s string) (Permission, error) {
+	switch s {
+	case "none":
+		return PermissionNone, nil
+	case "read":
+		return PermissionRead, nil
+	case "write":
+		return PermissionWrite, nil
+	}
+	return PermissionNone, fmt.Errorf("invalid permission %q. expected none, read or write", s)
+}
+
+// ClientPermission is the permission of the clients with certificates of
+// Subject, as configured
+type ClientPermission struct {
+	// "CN=alice,O=team", "CN=alice", "O=team" or "*"
+	Subject string `mapstructure:"subject"`
+	// "none", "read" or "write"
+	Permission string `mapstructure:"permission"`
+}
+
+// ParsePermissions returns the permissions of the configured subjects
+func ParsePermissions(configured []ClientPermission) (map[string]Permission, error) {
+	permissions := make(map[string]Permission, len(configured))
+	for _, item := range configured {
+		permission, err := ParsePermission(item.Permission)
+		if err != nil {
+			return nil, fmt.Errorf("permission of %q: %w", item.Subject, err)
+		}
+		permissions[item.Subject] = permission
+	}
+	return permissions, nil
+}
+
+// permissionOf returns the permission of the certificate, from the most
+// specific key of permissions that matches its subject: the whole subject
+// ("CN=alice,O=team"), its common name ("CN=alice"), one of its organizations
+// ("O=team") or "*"
+func permissionOf(permissions map[string]Permission, cert *x509.Certificate) Permission {
+	keys := []string{cert.Subject.String(), "CN=" + cert.Subject.CommonName}
+	for _, organization := range cert.Subject.Organization {
+		keys = append(keys, "O="+organization)
+	}
+	keys = append(keys, "*")
+	for _, key := range keys {
+		if permission, ok := permissions[key]; ok {
+			return permission
+		}
+	}
+	return PermissionNone
+}
+
+// authorize is a middleware that applies ClientPermissions on the clients
+// with a verified certificate. clients without a permission are rejected, and
+// clients with the read permission can only make GET requests
+func (d *Daemon) authorize(c *gin.Context) {
+	if len(d.ClientPermissions) == 0 || c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return
+	}
+	cert := c.Request.TLS.VerifiedChains[0][0]
+	permission := permissionOf(d.ClientPermissions, cert)
+	switch {
+	case permission == PermissionNone:
+		abortWithError(c, http.StatusForbidden, fmt.Errorf("certificate of %q isn't permitted", cert.Subject))
+		return
+	case permission == PermissionRead && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead:
+		abortWithError(c, http.StatusForbidden, fmt.Errorf("certificate of %q can only read", cert.Subject))
+		return
+	}
+	c.Set(permissionKey, permission)
+}
+
+// readOnly reports whether the client of c can only read
+func readOnly(c *gin.Context) bool {
+	permission, ok := c.Get(permissionKey)
+	return ok && permission == PermissionRead
+}
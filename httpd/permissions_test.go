@@ -0,0 +1,142 @@
+package httpd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPermissionOf(t *testing.T) {
+	permissions := map[string]Permission{
+		"CN=alice,O=team": PermissionWrite,
+		"CN=bob":          PermissionRead,
+		"O=team":          PermissionRead,
+		"*":               PermissionNone,
+	}
+	for _, item := range []struct {
+		subject    pkix.Name
+		permission Permission
+	}{
+		{pkix.Name{CommonName: "alice", Organization: []string{"team"}}, PermissionWrite},
+		{pkix.Name{CommonName: "bob", Organization: []string{"team"}}, PermissionRead},
+		{pkix.Name{CommonName: "carol", Organization: []string{"team"}}, PermissionRead},
+		{pkix.Name{CommonName: "mallory"}, PermissionNone},
+	} {
+		if permission := permissionOf(permissions, &x509.Certificate{Subject: item.subject}); permission != item.permission {
+			t.Fatalf("permission of %s is %s. expected %s", item.subject, permission, item.permission)
+		}
+	}
+}
+
+// testCA signs certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "goje test ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert, key}
+}
+
+// issue returns a certificate of subject, signed by the ca
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, usage x509.ExtKeyUsage) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientPermissions(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "localhost")
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600)
+
+	d := newTestDaemon()
+	d.ClientPermissions = map[string]Permission{"CN=alice": PermissionWrite, "CN=bob": PermissionRead}
+	options := TLSOptions{Certfile: filepath.Join(dir, "cert.pem"), Keyfile: filepath.Join(dir, "key.pem"), ClientCA: caFile}
+	if err := options.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config, _, err := options.config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(d.Handler())
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	client := func(name string) *http.Client {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if name != "" {
+			tlsConfig.Certificates = []tls.Certificate{ca.issue(t, pkix.Name{CommonName: name}, x509.ExtKeyUsageClientAuth)}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	for _, item := range []struct {
+		client, method, path string
+		status               int
+	}{
+		{"alice", "GET", "/api/timer", http.StatusOK},
+		{"alice", "POST", "/api/timer/pause", http.StatusOK},
+		{"bob", "GET", "/api/v1/timer", http.StatusOK},
+		{"bob", "POST", "/api/timer/pause", http.StatusForbidden},
+		{"carol", "GET", "/api/timer", http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest(item.method, server.URL+item.path, strings.NewReader(""))
+		resp, err := client(item.client).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != item.status {
+			t.Fatalf("%s %s of %s responded %d. expected %d", item.method, item.path, item.client, resp.StatusCode, item.status)
+		}
+	}
+	// clients without a certificate don't get past the handshake
+	if _, err := client("").Get(server.URL + "/api/timer"); err == nil {
+		t.Fatalf("client without a certificate is accepted")
+	}
+}
@@ -1,94 +1,397 @@
 package httpd
 
 import (
+	"bytes"
+	"context"
 	"embed"
+	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/nimaaskarian/goje/consensus"
+	"github.com/nimaaskarian/goje/history"
+	"github.com/nimaaskarian/goje/metrics"
+	"github.com/nimaaskarian/goje/peersync"
+	"github.com/nimaaskarian/goje/timer"
 	"github.com/spf13/viper"
 )
 
 //go:embed webgui-preact/dist/*
 var embed_fs embed.FS
 
-func (d *Daemon) JsonRoutes() {
-	d.engine.GET("/api/timer", func(c *gin.Context) {
-		c.JSON(http.StatusOK, d.Timer)
+func (d *Daemon) MetricsRoutes() {
+	d.router.GET("/metrics", func(c *gin.Context) {
+		registry := d.Metrics()
+		if registry == nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Header("Content-Type", metrics.CONTENT_TYPE)
+		c.Status(http.StatusOK)
+		registry.WriteTo(c.Writer)
 	})
-	d.engine.POST("/api/timer/nextmode", func(c *gin.Context) {
+}
+
+func (d *Daemon) JsonRoutes() {
+	d.router.GET("/api/timer", d.locked(d.respondTimer))
+	d.router.POST("/api/timer/nextmode", d.precondition, func(c *gin.Context) {
+		if d.propose(c, proposalOf(consensus.Next), false) {
+			return
+		}
 		d.Timer.SwitchNextMode()
-		c.JSON(http.StatusOK, d.Timer)
+		d.respondTimer(c)
 	})
-	d.engine.POST("/api/timer/pause", func(c *gin.Context) {
+	d.router.POST("/api/timer/pause", d.precondition, func(c *gin.Context) {
 		d.Timer.TogglePause()
-		c.JSON(http.StatusOK, d.Timer)
+		d.respondTimer(c)
 	})
-	d.engine.POST("/api/timer/reset", func(c *gin.Context) {
+	d.router.POST("/api/timer/reset", d.precondition, func(c *gin.Context) {
+		if d.propose(c, proposalOf(consensus.Reset), false) {
+			return
+		}
 		d.Timer.Reset()
-		c.JSON(http.StatusOK, d.Timer)
+		d.respondTimer(c)
 	})
-	d.engine.POST("/api/timer/save-settings-to-file", func(c *gin.Context) {
-		d.handlePostTimer(c)
-		// viper.Set("timer", d.Timer.Config)
-		viper.WriteConfig()
+	d.router.POST("/api/timer/save-settings-to-file", d.precondition, func(c *gin.Context) {
+		if d.handlePostTimer(c) {
+			// viper.Set("timer", d.Timer.Config)
+			viper.WriteConfig()
+		}
 	})
-	d.engine.POST("/api/timer/prevmode", func(c *gin.Context) {
+	d.router.POST("/api/timer/prevmode", d.precondition, func(c *gin.Context) {
+		if d.propose(c, proposalOf(consensus.Prev), false) {
+			return
+		}
 		d.Timer.SwitchPrevMode()
-		c.JSON(http.StatusOK, d.Timer)
+		d.respondTimer(c)
 	})
-	d.engine.POST("/api/timer", func(c *gin.Context) {
+	d.router.POST("/api/timer", d.precondition, func(c *gin.Context) {
 		d.handlePostTimer(c)
 	})
-	d.engine.GET("/api/timer/stream", func(c *gin.Context) {
+	// same as POST. but as partial updates are a better fit for PATCH
+	d.router.PATCH("/api/timer", d.precondition, func(c *gin.Context) {
+		d.handlePostTimer(c)
+	})
+	d.router.GET("/api/schedule", func(c *gin.Context) {
+		if d.Scheduler == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "no schedule is configured"})
+			return
+		}
+		res := gin.H{"Next": nil, "Stopped": d.Scheduler.Stopped(time.Now())}
+		if next, ok := d.Scheduler.Next(time.Now()); ok {
+			res["Next"] = next
+		}
+		c.JSON(http.StatusOK, res)
+	})
+	d.router.GET("/api/history", func(c *gin.Context) {
+		if sessions, ok := d.historySessions(c); ok {
+			c.JSON(http.StatusOK, sessions)
+		}
+	})
+	d.router.GET("/api/history.ics", func(c *gin.Context) {
+		sessions, ok := d.historySessions(c)
+		if !ok {
+			return
+		}
+		var buf bytes.Buffer
+		if err := history.WriteICS(&buf, sessions); err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="goje.ics"`)
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+	})
+	d.router.GET("/api/timer/stream", d.handleStream(nil))
+	d.router.GET("/api/ws", d.handleWebsocket)
+	d.router.GET("/api/clients", func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Hub.Clients())
+	})
+	d.router.GET("/api/outbound", func(c *gin.Context) {
+		if d.Outbound == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "not a client of an outbound server"})
+			return
+		}
+		c.JSON(http.StatusOK, d.Outbound.Status())
+	})
+	d.router.GET("/api/participants", func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Participants.List())
+	})
+	d.router.PUT("/api/participants/:id", func(c *gin.Context) {
+		var req struct{ Name, Task string }
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		if req.Name == "" {
+			req.Name = c.Param("id")
+		}
+		participant, err := d.Participants.Update(c.Param("id"), secretOf(c), req.Name, req.Task)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"Error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, participant)
+	})
+	d.router.DELETE("/api/participants/:id", func(c *gin.Context) {
+		removed, err := d.Participants.Remove(c.Param("id"), secretOf(c))
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"Error": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "participant isn't present"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	d.router.GET("/api/actions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Participants.Actions())
+	})
+	d.router.GET("/api/sync", func(c *gin.Context) {
+		if d.Sync == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "not a member of a sync group"})
+			return
+		}
+		c.JSON(http.StatusOK, d.Sync.Status())
+	})
+	d.router.POST("/api/sync", func(c *gin.Context) {
+		if d.Sync == nil {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "not a member of a sync group"})
+			return
+		}
+		var msg peersync.Message
+		if err := c.ShouldBindJSON(&msg); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		d.mu.Lock()
+		response, err := d.Sync.Handle(msg)
+		d.mu.Unlock()
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"Error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+const (
+	// time allowed for writing an event to an SSE client. stalled clients are
+	// dropped after this
+	sseWriteWait = 10 * time.Second
+	// time that browsers wait before reconnecting to the stream
+	sseRetry = 3 * time.Second
+)
+
+// handleStream streams events to an SSE client. transform (if not nil) is
+// applied on each event's payload before sending it. clients that send
+// Last-Event-ID (as a header, or a last-event-id query) get the events they've
+// missed, if they're still in the hub's replay buffer. a comment is sent after
+// every d.Keepalive without events, so proxies wouldn't drop the connection
+func (d *Daemon) handleStream(transform func(any) any) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		participant, err := d.join(c)
+		if err != nil {
+			abortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		if participant != "" {
+			defer d.Participants.Leave(participant)
+		}
 		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
 		c.Header("Connection", "keep-alive")
 		c.Header("Transfer-Encoding", "chunked")
-		client := make(chan Event, 1)
-		client <- ChangeEvent(d.Timer)
-		d.lastId++
-		id := d.lastId
-		d.Clients.Store(id, client)
-		defer func() {
-			d.Clients.Delete(id)
-			close(client)
-		}()
+		// disables response buffering of nginx
+		c.Header("X-Accel-Buffering", "no")
+		last_event_id, resume := lastEventId(c)
+		client := d.Hub.Subscribe("sse", c.Request, last_event_id, resume, ChangeEvent(lockedSnapshot(d.Timer)))
+		defer d.Hub.Unsubscribe(client)
+		controller := http.NewResponseController(c.Writer)
+		retry := uint(sseRetry.Milliseconds())
 		c.Stream(func(w io.Writer) bool {
-			if event, ok := <-client; ok {
-				c.SSEvent(event.Name, event.Payload)
-				return true
+			ctx := c.Request.Context()
+			if d.Keepalive > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d.Keepalive)
+				defer cancel()
 			}
-			return false
+			event, err := client.Next(ctx)
+			controller.SetWriteDeadline(time.Now().Add(sseWriteWait))
+			if err == context.DeadlineExceeded && c.Request.Context().Err() == nil {
+				_, err = io.WriteString(w, ": keepalive\n\n")
+				return err == nil
+			}
+			if err != nil {
+				if err == ErrEvicted {
+					slog.Warn("evicted a slow SSE client", "address", client.Address)
+				}
+				return false
+			}
+			payload := event.Payload
+			if transform != nil {
+				payload = transform(payload)
+			}
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(event.Id, 10),
+				Event: event.Name,
+				Retry: retry,
+				Data:  payload,
+			})
+			// only sent once
+			retry = 0
+			return event.Name != "restart"
 		})
-	})
+	}
+}
+
+// join adds the client of a stream as a participant, if it identifies itself
+// with the participant or name queries. returns the participant's id, or
+// ErrNotOwner if the participant is claimed with another secret. viewers of
+// share links don't join
+func (d *Daemon) join(c *gin.Context) (string, error) {
+	if c.GetBool(sharedKey) {
+		return "", nil
+	}
+	id, name := participantOf(c), c.Query("name")
+	if id == "" {
+		id = name
+	}
+	if id != "" {
+		if err := d.Participants.Join(id, secretOf(c), name, c.Query("task")); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// lastEventId returns the id of the last event a resuming client has got
+func lastEventId(c *gin.Context) (uint64, bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last-event-id")
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	return id, err == nil
+}
+
+// historySessions returns the recorded sessions, filtered by the optional
+// "since" query (RFC 3339). writes the error response if not ok
+func (d *Daemon) historySessions(c *gin.Context) ([]history.Session, bool) {
+	if d.History == nil {
+		abortWithError(c, http.StatusNotFound, fmt.Errorf("history isn't recorded"))
+		return nil, false
+	}
+	sessions := d.History.Sessions()
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return nil, false
+		}
+		sessions = history.Since(sessions, t)
+	}
+	return sessions, true
 }
 
-func (d *Daemon) handlePostTimer(c *gin.Context) {
-	prev_mode := d.Timer.State.Mode
-	if err := c.BindJSON(d.Timer); err == nil {
-		if prev_mode != d.Timer.State.Mode {
-			d.Timer.Reset()
+// handlePostTimer applies the json body on the timer. fields that aren't
+// present in the body are left unchanged. the body is decoded into a copy of
+// the timer, and only the fields that clients can change are copied from it,
+// after they're validated
+func (d *Daemon) handlePostTimer(c *gin.Context) bool {
+	changed := snapshot(d.Timer)
+	if err := c.ShouldBindBodyWith(changed, binding.JSON); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return false
+	}
+	if err := validatePostedTimer(changed); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return false
+	}
+	if d.Voting != nil {
+		// skips, resets and switches of mode need consensus
+		if proposal, ok := proposalOfChange(d.Timer, changed); ok && d.propose(c, proposal, false) {
+			return false
 		}
-		if !d.Timer.Config.Hooks.OnSet.Run(d.Timer) {
-			d.Timer.Config.Hooks.OnChange.Run(d.Timer)
+		// the remaining duration of a stale timer isn't applied, as increasing
+		// it needs consensus
+		changed.State.Duration = min(changed.State.Duration, d.Timer.State.Duration)
+	}
+	config := d.Timer.Config
+	config.Sessions = changed.Config.Sessions
+	config.Duration = changed.Config.Duration
+	config.Paused = changed.Config.Paused
+	config.GoalPomodoros = changed.Config.GoalPomodoros
+	config.GoalFocus = changed.Config.GoalFocus
+	d.Timer.State.FinishedSessions = changed.State.FinishedSessions
+	d.Timer.State.Task = changed.State.Task
+	d.Timer.State.Duration = changed.State.Duration
+	if changed.State.Mode != d.Timer.State.Mode {
+		d.Timer.SetMode(changed.State.Mode)
+	}
+	// paused is applied with Pause, so the pause hooks run
+	if changed.State.Paused != d.Timer.State.Paused {
+		d.Timer.Pause(changed.State.Paused)
+	}
+	d.Timer.Changed()
+	d.respondTimer(c)
+	return true
+}
+
+// validatePostedTimer validates the fields of a posted timer, that are applied
+// on the timer
+func validatePostedTimer(pt *timer.PomodoroTimer) error {
+	if pt.State.Mode < 0 || pt.State.Mode >= timer.MODE_MAX {
+		return fmt.Errorf("invalid mode %d", pt.State.Mode)
+	}
+	if pt.State.Duration < 0 {
+		return fmt.Errorf("duration can't be negative")
+	}
+	for mode, duration := range pt.Config.Duration {
+		if duration <= 0 {
+			return fmt.Errorf("duration of %s should be positive", timer.PomodoroTimerMode(mode).SnakeCase())
 		}
-		c.JSON(http.StatusOK, d.Timer)
 	}
+	if pt.Config.Sessions == 0 {
+		return fmt.Errorf("sessions can't be zero")
+	}
+	if pt.Config.GoalFocus < 0 {
+		return fmt.Errorf("goal focus can't be negative")
+	}
+	return nil
 }
 
 func (d *Daemon) WebguiRoutes(custom_css_file string) {
 	static, _ := fs.Sub(embed_fs, "webgui-preact/dist/assets")
-	d.engine.StaticFS("/assets", http.FS(static))
+	d.router.StaticFS("/assets", http.FS(static))
 	if custom_css_file != "" {
-		d.engine.StaticFile("/custom.css", custom_css_file)
+		d.router.StaticFile("/custom.css", custom_css_file)
 	}
 	data, _ := embed_fs.ReadFile("webgui-preact/dist/index.html")
-	d.engine.GET("/", func(c *gin.Context) {
+	data = withBase(data, d.BasePath)
+	d.router.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html;  charset=utf-8", data)
+	})
+	// read-only view of share links
+	d.router.GET("/share/:token", d.shared, func(c *gin.Context) {
 		c.Data(http.StatusOK, "text/html;  charset=utf-8", data)
 	})
 	favicon, _ := embed_fs.ReadFile("webgui-preact/dist/favicon.ico")
-	d.engine.GET("/favicon.ico", func(c *gin.Context) {
+	d.router.GET("/favicon.ico", func(c *gin.Context) {
 		c.Data(http.StatusOK, "image/x-icon", favicon)
 	})
 }
+
+// withBase adds a <base> element of basePath to the head of the page. urls of
+// the webgui are relative to it, so it works under any prefix (and in
+// /share/<token>)
+func withBase(page []byte, basePath string) []byte {
+	return bytes.Replace(page, []byte("<head>"), fmt.Appendf(nil, `<head><base href="%s/">`, basePath), 1)
+}
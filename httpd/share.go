@@ -0,0 +1,189 @@
+package httpd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// key of the gin context that is set on requests of share links
+const sharedKey = "goje-shared"
+
+// Share is a revocable link to a read-only view of the timer, at
+// /share/<Token>
+type Share struct {
+	Token string
+	// what the link is for ("wall display" for example)
+	Name    string
+	Created time.Time
+}
+
+// Shares are the share links that are valid
+type Shares struct {
+	// optional. path of a json file that the shares are kept in, so the links
+	// stay valid across restarts
+	Path string
+
+	mu     sync.Mutex
+	shares []Share
+	// closed when the share of the token is revoked
+	revoked map[string]chan struct{}
+}
+
+// NewShares returns the shares kept in the file at path, if it's not empty
+func NewShares(path string) (*Shares, error) {
+	s := &Shares{Path: path, revoked: map[string]chan struct{}{}}
+	if path == "" {
+		return s, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(content, &s.shares); err != nil {
+		return s, err
+	}
+	for _, share := range s.shares {
+		s.revoked[share.Token] = make(chan struct{})
+	}
+	return s, nil
+}
+
+// save writes the shares in the file, if there's one. s.mu should be held
+func (s *Shares) save() error {
+	if s.Path == "" {
+		return nil
+	}
+	content, _ := json.Marshal(s.shares)
+	return os.WriteFile(s.Path, content, 0o600)
+}
+
+// Create makes a share link with a random token
+func (s *Shares) Create(name string) (Share, error) {
+	share := Share{
+		Token:   base64.RawURLEncoding.EncodeToString(randomBytes(18)),
+		Name:    name,
+		Created: time.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shares = append(s.shares, share)
+	s.revoked[share.Token] = make(chan struct{})
+	return share, s.save()
+}
+
+// Revoke invalidates the link of token, and closes the streams that are
+// opened with it. returns false if there's no such link
+func (s *Shares) Revoke(token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.shares, func(share Share) bool { return share.Token == token })
+	if i == -1 {
+		return false, nil
+	}
+	s.shares = slices.Delete(s.shares, i, i+1)
+	close(s.revoked[token])
+	delete(s.revoked, token)
+	return true, s.save()
+}
+
+func (s *Shares) List() []Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.shares)
+}
+
+// valid returns a channel that's closed when the link of token is revoked. ok
+// is false if there's no such link
+func (s *Shares) valid(token string) (revoked <-chan struct{}, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked, ok = s.revoked[token]
+	return revoked, ok
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// shared is a middleware of the share routes. it rejects requests with a
+// token that isn't valid, and ends the request when the link is revoked
+func (d *Daemon) shared(c *gin.Context) {
+	revoked, ok := d.Shares.valid(c.Param("token"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"Error": "share link isn't valid"})
+		return
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-revoked:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	c.Request = c.Request.WithContext(ctx)
+	c.Set(sharedKey, true)
+	c.Next()
+}
+
+// ShareRoutes adds the routes of managing share links, and the read-only api
+// of the links at /share/<token>/api. the webgui of the links is added by
+// WebguiRoutes
+func (d *Daemon) ShareRoutes() {
+	d.router.GET("/api/shares", func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Shares.List())
+	})
+	d.router.POST("/api/shares", func(c *gin.Context) {
+		var req struct{ Name string }
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			return
+		}
+		share, err := d.Shares.Create(req.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, share)
+	})
+	d.router.DELETE("/api/shares/:token", func(c *gin.Context) {
+		ok, err := d.Shares.Revoke(c.Param("token"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"Error": "share link isn't found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// only reads the timer. there are no control routes under /share
+	share := d.router.Group("/share/:token/api", d.shared)
+	share.GET("/timer", d.locked(d.respondTimer))
+	share.GET("/timer/stream", d.handleStream(nil))
+	share.GET("/participants", func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Participants.List())
+	})
+	share.GET("/actions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, d.Participants.Actions())
+	})
+}
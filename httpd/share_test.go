@@ -0,0 +1,92 @@
+package httpd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShareLinks(t *testing.T) {
+	d := newTestDaemon()
+	d.ShareRoutes()
+	d.WebguiRoutes("")
+	w := request(d, "POST", "/api/shares", `{"Name": "wall display"}`)
+	var share Share
+	if err := json.Unmarshal(w.Body.Bytes(), &share); err != nil || w.Code != http.StatusCreated || share.Token == "" {
+		t.Fatalf("share link isn't created: %d %s", w.Code, w.Body)
+	}
+	for _, item := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/share/" + share.Token, http.StatusOK},
+		{"GET", "/share/" + share.Token + "/api/timer", http.StatusOK},
+		{"GET", "/share/" + share.Token + "/api/participants", http.StatusOK},
+		{"GET", "/share/invalid", http.StatusNotFound},
+		{"GET", "/share/invalid/api/timer", http.StatusNotFound},
+		{"POST", "/share/" + share.Token + "/api/timer/pause", http.StatusNotFound},
+		{"POST", "/share/" + share.Token + "/api/timer", http.StatusNotFound},
+	} {
+		if w := request(d, item.method, item.path, ""); w.Code != item.status {
+			t.Fatalf("%s %s responded %d. expected %d", item.method, item.path, w.Code, item.status)
+		}
+	}
+	if d.Timer.State.Paused != d.Timer.Config.Paused {
+		t.Fatalf("timer has changed through a share link")
+	}
+	if w := request(d, "DELETE", "/api/shares/"+share.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("share link isn't revoked: %d %s", w.Code, w.Body)
+	}
+	if w := request(d, "GET", "/share/"+share.Token+"/api/timer", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("revoked share link is still valid: %d", w.Code)
+	}
+}
+
+func TestRevokeClosesStream(t *testing.T) {
+	d := newTestDaemon()
+	d.ShareRoutes()
+	share, _ := d.Shares.Create("")
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/share/" + share.Token + "/api/timer/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(done)
+	}()
+	d.Shares.Revoke(share.Token)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("stream of the revoked share link isn't closed")
+	}
+}
+
+func TestSharesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shares.json")
+	shares, err := NewShares(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := shares.Create("kept")
+	revoked, _ := shares.Create("revoked")
+	shares.Revoke(revoked.Token)
+	shares, err = NewShares(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := shares.List(); len(list) != 1 || list[0].Token != kept.Token {
+		t.Fatalf("shares in the file: %+v", list)
+	}
+	if _, ok := shares.valid(kept.Token); !ok {
+		t.Fatalf("share link of the file isn't valid")
+	}
+}
@@ -0,0 +1,223 @@
+package httpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions are how the http daemon serves https. it serves plain http if
+// neither the static certificate nor ACME is set
+type TLSOptions struct {
+	// static certificate. reloaded when the files change
+	Certfile string
+	Keyfile  string
+	// get certificates of Domains from an ACME CA (Let's Encrypt by default),
+	// with the tls-alpn-01 challenge
+	Acme    bool
+	Domains []string
+	// directory url of the ACME CA
+	Directory string
+	// directory that certificates and the account key are cached in
+	CacheDir string
+	// optional. contact email of the ACME account
+	Email string
+	// optional. pem file of root certificates to trust the ACME CA with (of a
+	// test CA like pebble for example)
+	CAFile string
+	// optional. address of a plain http server for the http-01 challenge. it
+	// redirects other requests to https
+	HttpAddress string
+	// optional. pem file of the CAs of client certificates. clients are
+	// required to have a certificate signed by them when it's set
+	ClientCA string
+}
+
+// Enabled reports whether the daemon serves https
+func (o *TLSOptions) Enabled() bool {
+	return o.Acme || (o.Certfile != "" && o.Keyfile != "")
+}
+
+// Validate reports the errors of the options, before the daemon runs
+func (o *TLSOptions) Validate() error {
+	if o.ClientCA != "" {
+		if !o.Enabled() {
+			return errors.New("client-ca requires https")
+		}
+		if _, err := loadCertPool(o.ClientCA); err != nil {
+			return err
+		}
+	}
+	if o.Acme {
+		if len(o.Domains) == 0 {
+			return errors.New("acme requires at least a domain")
+		}
+		return nil
+	}
+	if (o.Certfile == "") != (o.Keyfile == "") {
+		return errors.New("both certfile and keyfile are required for https")
+	}
+	if o.Enabled() {
+		_, err := tls.LoadX509KeyPair(o.Certfile, o.Keyfile)
+		return err
+	}
+	return nil
+}
+
+// config returns the tls config of the options, and the handler of the
+// http-01 challenge (nil without ACME). the static certificate is reloaded
+// until ctx is done
+func (o *TLSOptions) config(ctx context.Context) (*tls.Config, http.Handler, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if o.ClientCA != "" {
+		pool, err := loadCertPool(o.ClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if o.Acme {
+		manager, err := o.manager()
+		if err != nil {
+			return nil, nil, err
+		}
+		config.GetCertificate = manager.GetCertificate
+		config.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		return config, manager.HTTPHandler(nil), nil
+	}
+	reloader, err := newCertReloader(o.Certfile, o.Keyfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	go reloader.watch(ctx)
+	config.GetCertificate = reloader.GetCertificate
+	return config, nil, nil
+}
+
+// loadCertPool returns a pool of the certificates of the pem file at path
+func loadCertPool(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificates are found in %s", path)
+	}
+	return pool, nil
+}
+
+func (o *TLSOptions) manager() (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: o.Directory}
+	if o.CAFile != "" {
+		pool, err := loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(o.Domains...),
+		Email:      o.Email,
+		Client:     client,
+	}
+	if o.CacheDir != "" {
+		if err := os.MkdirAll(o.CacheDir, 0o700); err != nil {
+			return nil, err
+		}
+		manager.Cache = autocert.DirCache(o.CacheDir)
+	}
+	return manager, nil
+}
+
+// certReloader serves a certificate from files, reloading it when they change
+type certReloader struct {
+	certfile, keyfile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certfile, keyfile string) (*certReloader, error) {
+	r := &certReloader{certfile: certfile, keyfile: keyfile}
+	_, err := r.load()
+	return r, err
+}
+
+// load loads the certificate from the files. changed is false if it's the same
+// as the current one
+func (r *certReloader) load() (changed bool, err error) {
+	cert, err := tls.LoadX509KeyPair(r.certfile, r.keyfile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed = r.cert == nil || !bytes.Equal(r.cert.Certificate[0], cert.Certificate[0])
+	r.cert = &cert
+	return changed, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// watch reloads the certificate when its files change, until ctx is done.
+// directories of the files are watched, as renewals usually replace the files
+// (or the symlinks to them) instead of writing them
+func (r *certReloader) watch(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("watching the certificate failed", "err", err)
+		return
+	}
+	defer watcher.Close()
+	for _, dir := range []string{filepath.Dir(r.certfile), filepath.Dir(r.keyfile)} {
+		if err := watcher.Add(dir); err != nil {
+			slog.Error("watching the certificate failed", "dir", dir, "err", err)
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			slog.Error("watching the certificate failed", "err", err)
+		case event := <-watcher.Events:
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			// the key might not be written yet. the error is logged, and the
+			// previous certificate is kept until the next change
+			changed, err := r.load()
+			if err != nil {
+				slog.Warn("reloading the certificate failed", "err", err)
+				continue
+			}
+			if changed {
+				slog.Info("reloaded the certificate", "certfile", r.certfile)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package httpd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate of name in dir, replacing the
+// files like renewals do
+func writeCert(t *testing.T, dir, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, block := range map[string]*pem.Block{
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+	} {
+		tmp := filepath.Join(dir, "."+file)
+		if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "old.example")
+	r, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.watch(ctx)
+	// lets the watcher start
+	time.Sleep(50 * time.Millisecond)
+	writeCert(t, dir, "new.example")
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		cert, _ := r.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leaf.Subject.CommonName == "new.example" {
+			return
+		}
+	}
+	t.Fatalf("certificate isn't reloaded")
+}
+
+func TestTLSOptionsValidate(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "goje.example")
+	for _, item := range []struct {
+		options TLSOptions
+		valid   bool
+	}{
+		{TLSOptions{}, true},
+		{TLSOptions{Acme: true}, false},
+		{TLSOptions{Acme: true, Domains: []string{"goje.example"}}, true},
+		{TLSOptions{Certfile: filepath.Join(dir, "cert.pem")}, false},
+		{TLSOptions{Certfile: filepath.Join(dir, "cert.pem"), Keyfile: filepath.Join(dir, "key.pem")}, true},
+		{TLSOptions{Certfile: filepath.Join(dir, "missing.pem"), Keyfile: filepath.Join(dir, "key.pem")}, false},
+	} {
+		if err := item.options.Validate(); (err == nil) != item.valid {
+			t.Fatalf("options %+v. err: %v", item.options, err)
+		}
+	}
+}
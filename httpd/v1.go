@@ -0,0 +1,478 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nimaaskarian/goje/consensus"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// Duration is a time.Duration that is written as a string in json ("25m0s").
+// its read from either a string or a number of nanoseconds
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type DailyResponse struct {
+	Pomodoros     uint     `json:"pomodoros"`
+	Focus         Duration `json:"focus"`
+	GoalPomodoros uint     `json:"goal_pomodoros"`
+	GoalFocus     Duration `json:"goal_focus"`
+	GoalReached   bool     `json:"goal_reached"`
+	Streak        uint     `json:"streak"`
+}
+
+// TimerResponse is the timer as its exposed in /api/v1
+type TimerResponse struct {
+	// snake_case name of the mode ("pomodoro", "short_break" or "long_break")
+	Mode string `json:"mode"`
+	// human readable name of the mode
+	ModeName         string              `json:"mode_name"`
+	Remaining        Duration            `json:"remaining"`
+	Paused           bool                `json:"paused"`
+	FinishedSessions uint                `json:"finished_sessions"`
+	Sessions         uint                `json:"sessions"`
+	Durations        map[string]Duration `json:"durations"`
+	Task             string              `json:"task"`
+	Daily            DailyResponse       `json:"daily"`
+	// version of the state. also sent as ETag, to be used in If-Match
+	Version uint64 `json:"version"`
+}
+
+func NewTimerResponse(pt *timer.PomodoroTimer) TimerResponse {
+	durations := make(map[string]Duration, timer.MODE_MAX)
+	for mode := range timer.MODE_MAX {
+		durations[mode.SnakeCase()] = Duration(pt.Config.Duration[mode])
+	}
+	return TimerResponse{
+		Mode:             pt.State.Mode.SnakeCase(),
+		ModeName:         pt.State.Mode.String(),
+		Remaining:        Duration(pt.State.Duration),
+		Paused:           pt.State.Paused,
+		FinishedSessions: pt.State.FinishedSessions,
+		Sessions:         pt.Config.Sessions,
+		Durations:        durations,
+		Task:             pt.State.Task,
+		Version:          pt.State.Version,
+		Daily: DailyResponse{
+			Pomodoros:     pt.State.Daily.Pomodoros,
+			Focus:         Duration(pt.State.Daily.Focus),
+			GoalPomodoros: pt.Config.GoalPomodoros,
+			GoalFocus:     Duration(pt.Config.GoalFocus),
+			GoalReached:   pt.State.Daily.GoalReached,
+			Streak:        pt.State.Daily.Streak,
+		},
+	}
+}
+
+// ClientResponse is a connected SSE or websocket client
+type ClientResponse struct {
+	Id uint64 `json:"id"`
+	// "sse" or "websocket"
+	Kind      string    `json:"kind"`
+	Address   string    `json:"address"`
+	UserAgent string    `json:"user_agent"`
+	Connected time.Time `json:"connected"`
+	// count of the events waiting to be sent to the client
+	Queued int `json:"queued"`
+}
+
+// ParticipantResponse is a present participant of the shared session
+type ParticipantResponse struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// what the participant is working on
+	Task        string    `json:"task"`
+	Joined      time.Time `json:"joined"`
+	Connections int       `json:"connections"`
+}
+
+// ActionResponse is a pause, resume, skip or reset, and who did it
+type ActionResponse struct {
+	Time time.Time `json:"time"`
+	// "pause", "resume", "skip" or "reset"
+	Action string `json:"action"`
+	// snake_case name of the mode after the action
+	Mode string `json:"mode"`
+	// id of the participant. empty if the request wasn't identified
+	Participant string `json:"participant"`
+	Name        string `json:"name"`
+}
+
+type PauseRequest struct {
+	Paused *bool `json:"paused"`
+}
+
+type SeekRequest struct {
+	Duration *Duration `json:"duration"`
+	// add duration to the remaining duration instead of setting it
+	Relative bool `json:"relative"`
+}
+
+type ModeRequest struct {
+	Mode string `json:"mode"`
+}
+
+type SessionsRequest struct {
+	Finished *uint `json:"finished"`
+	Total    *uint `json:"total"`
+}
+
+type TaskRequest struct {
+	Task string `json:"task"`
+}
+
+// TimerPatch is a partial update of the timer. only the present fields are
+// applied
+type TimerPatch struct {
+	Mode             *string             `json:"mode"`
+	Remaining        *Duration           `json:"remaining"`
+	Paused           *bool               `json:"paused"`
+	FinishedSessions *uint               `json:"finished_sessions"`
+	Sessions         *uint               `json:"sessions"`
+	Durations        map[string]Duration `json:"durations"`
+	Task             *string             `json:"task"`
+}
+
+var errMixedPatch = errors.New("a patch that switches the mode or increases the remaining duration needs consensus, and can't have other fields")
+
+// proposal returns the proposal of the patch, if it switches the mode or
+// increases the remaining duration. such patches can't have other fields, as
+// they're applied only when the proposal is approved
+func (patch *TimerPatch) proposal(pt *timer.PomodoroTimer) (proposal consensus.Proposal, ok bool, err error) {
+	if patch.Mode != nil {
+		mode, err := parseMode(*patch.Mode)
+		if err != nil {
+			return proposal, false, err
+		}
+		if mode != pt.State.Mode {
+			proposal, err = consensus.NewProposal(consensus.Mode, 0, mode)
+			ok = true
+		}
+	}
+	if !ok && patch.Remaining != nil && time.Duration(*patch.Remaining) > pt.State.Duration {
+		proposal, err = consensus.NewProposal(consensus.Seek, time.Duration(*patch.Remaining), 0)
+		ok = true
+	}
+	if !ok || err != nil {
+		return proposal, ok, err
+	}
+	others := patch.Paused != nil || patch.FinishedSessions != nil || patch.Sessions != nil || len(patch.Durations) != 0 || patch.Task != nil
+	if others || (proposal.Action == consensus.Mode && patch.Remaining != nil) {
+		return proposal, false, errMixedPatch
+	}
+	return proposal, true, nil
+}
+
+// apply validates the patch, and applies it on the timer only if its valid
+func (patch *TimerPatch) apply(pt *timer.PomodoroTimer) error {
+	mode := pt.State.Mode
+	if patch.Mode != nil {
+		var err error
+		if mode, err = parseMode(*patch.Mode); err != nil {
+			return err
+		}
+	}
+	durations := pt.Config.Duration
+	for name, duration := range patch.Durations {
+		mode, err := parseMode(name)
+		if err != nil {
+			return err
+		}
+		if duration <= 0 {
+			return fmt.Errorf("duration of %s should be positive", name)
+		}
+		durations[mode] = time.Duration(duration)
+	}
+	if patch.Sessions != nil && *patch.Sessions == 0 {
+		return fmt.Errorf("sessions can't be zero")
+	}
+	if patch.Remaining != nil && *patch.Remaining < 0 {
+		return fmt.Errorf("remaining can't be negative")
+	}
+
+	pt.Config.Duration = durations
+	if patch.Sessions != nil {
+		pt.Config.Sessions = *patch.Sessions
+	}
+	if patch.FinishedSessions != nil {
+		pt.State.FinishedSessions = *patch.FinishedSessions
+	}
+	if patch.Task != nil {
+		pt.State.Task = *patch.Task
+	}
+	if mode != pt.State.Mode {
+		pt.SetMode(mode)
+	}
+	if patch.Remaining != nil {
+		pt.SeekTo(time.Duration(*patch.Remaining))
+	}
+	if patch.Paused != nil && *patch.Paused != pt.State.Paused {
+		pt.Pause(*patch.Paused)
+	}
+	pt.Changed()
+	return nil
+}
+
+func parseMode(input string) (timer.PomodoroTimerMode, error) {
+	for mode := range timer.MODE_MAX {
+		if mode.SnakeCase() == input {
+			return mode, nil
+		}
+	}
+	modes := make([]string, 0, timer.MODE_MAX)
+	for mode := range timer.MODE_MAX {
+		modes = append(modes, mode.SnakeCase())
+	}
+	return 0, fmt.Errorf("invalid mode %q. mode should be one of %s", input, strings.Join(modes, ", "))
+}
+
+func abortWithError(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: err.Error()})
+}
+
+// bindV1 binds the request's json body to req, and writes a 400 response if it
+// fails
+func bindV1(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func (d *Daemon) respondV1(c *gin.Context) {
+	c.Header("ETag", d.etag())
+	c.JSON(http.StatusOK, NewTimerResponse(d.Timer))
+}
+
+type route struct {
+	method, path, summary string
+	// type of request body. nil if request has no body
+	request  any
+	response any
+	handler  gin.HandlerFunc
+}
+
+func (d *Daemon) v1Routes() []route {
+	// proposal is the action that needs consensus. empty if none
+	timerAction := func(summary, path, proposal string, action func()) route {
+		return route{http.MethodPost, path, summary, nil, TimerResponse{}, func(c *gin.Context) {
+			if proposal != "" && d.propose(c, proposalOf(proposal), true) {
+				return
+			}
+			action()
+			d.respondV1(c)
+		}}
+	}
+	return append([]route{
+		{http.MethodGet, "/timer", "get the timer", nil, TimerResponse{}, d.locked(d.respondV1)},
+		{http.MethodPatch, "/timer", "partially update the timer. only the present fields are applied", TimerPatch{}, TimerResponse{}, func(c *gin.Context) {
+			var patch TimerPatch
+			if !bindV1(c, &patch) {
+				return
+			}
+			if d.Voting != nil {
+				proposal, ok, err := patch.proposal(d.Timer)
+				if err != nil {
+					abortWithError(c, http.StatusBadRequest, err)
+					return
+				}
+				if ok && d.propose(c, proposal, true) {
+					return
+				}
+			}
+			if err := patch.apply(d.Timer); err != nil {
+				abortWithError(c, http.StatusBadRequest, err)
+				return
+			}
+			d.respondV1(c)
+		}},
+		{http.MethodGet, "/timer/stream", "stream of timer events (server-sent events with the timer as data)", nil, TimerResponse{}, d.handleStream(func(payload any) any {
+			if pt, ok := payload.(*timer.PomodoroTimer); ok {
+				return NewTimerResponse(pt)
+			}
+			return payload
+		})},
+		{http.MethodGet, "/clients", "connected SSE and websocket clients", nil, []ClientResponse{}, func(c *gin.Context) {
+			clients := d.Hub.Clients()
+			res := make([]ClientResponse, 0, len(clients))
+			for _, client := range clients {
+				res = append(res, ClientResponse(client))
+			}
+			c.JSON(http.StatusOK, res)
+		}},
+		{http.MethodGet, "/participants", "present participants of the shared session", nil, []ParticipantResponse{}, func(c *gin.Context) {
+			participants := d.Participants.List()
+			res := make([]ParticipantResponse, 0, len(participants))
+			for _, p := range participants {
+				res = append(res, ParticipantResponse{p.Id, p.Name, p.Task, p.Joined, p.Connections})
+			}
+			c.JSON(http.StatusOK, res)
+		}},
+		{http.MethodGet, "/actions", "recent pauses, resumes, skips and resets, and the participants who did them", nil, []ActionResponse{}, func(c *gin.Context) {
+			actions := d.Participants.Actions()
+			res := make([]ActionResponse, 0, len(actions))
+			for _, a := range actions {
+				res = append(res, ActionResponse{a.Time, a.Action, a.Mode.SnakeCase(), a.Participant, a.Name})
+			}
+			c.JSON(http.StatusOK, res)
+		}},
+		{http.MethodPost, "/timer/pause", "pause or unpause the timer", PauseRequest{}, TimerResponse{}, func(c *gin.Context) {
+			var req PauseRequest
+			if !bindV1(c, &req) {
+				return
+			}
+			if req.Paused == nil {
+				abortWithError(c, http.StatusBadRequest, fmt.Errorf("paused is required"))
+				return
+			}
+			d.Timer.Pause(*req.Paused)
+			d.respondV1(c)
+		}},
+		{http.MethodPost, "/timer/seek", "set the remaining duration, or add to it if relative", SeekRequest{}, TimerResponse{}, func(c *gin.Context) {
+			var req SeekRequest
+			if !bindV1(c, &req) {
+				return
+			}
+			if req.Duration == nil {
+				abortWithError(c, http.StatusBadRequest, fmt.Errorf("duration is required"))
+				return
+			}
+			if req.Relative {
+				// extending the mode needs consensus
+				if *req.Duration > 0 {
+					proposal, _ := consensus.NewProposal(consensus.Extend, time.Duration(*req.Duration), 0)
+					if d.propose(c, proposal, true) {
+						return
+					}
+				}
+				d.Timer.SeekAdd(time.Duration(*req.Duration))
+			} else if *req.Duration < 0 {
+				abortWithError(c, http.StatusBadRequest, fmt.Errorf("duration can't be negative unless relative"))
+				return
+			} else {
+				// so does seeking past the remaining duration
+				if time.Duration(*req.Duration) > d.Timer.State.Duration {
+					proposal, _ := consensus.NewProposal(consensus.Seek, time.Duration(*req.Duration), 0)
+					if d.propose(c, proposal, true) {
+						return
+					}
+				}
+				d.Timer.SeekTo(time.Duration(*req.Duration))
+			}
+			d.respondV1(c)
+		}},
+		{http.MethodPut, "/timer/mode", "set the mode of timer, resetting it", ModeRequest{}, TimerResponse{}, func(c *gin.Context) {
+			var req ModeRequest
+			if !bindV1(c, &req) {
+				return
+			}
+			mode, err := parseMode(req.Mode)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, err)
+				return
+			}
+			// setting the current mode resets it
+			proposal := proposalOf(consensus.Reset)
+			if mode != d.Timer.State.Mode {
+				proposal, _ = consensus.NewProposal(consensus.Mode, 0, mode)
+			}
+			if d.propose(c, proposal, true) {
+				return
+			}
+			d.Timer.SetMode(mode)
+			d.respondV1(c)
+		}},
+		{http.MethodPut, "/timer/sessions", "set the finished sessions and/or total sessions before a long break", SessionsRequest{}, TimerResponse{}, func(c *gin.Context) {
+			var req SessionsRequest
+			if !bindV1(c, &req) {
+				return
+			}
+			if req.Finished == nil && req.Total == nil {
+				abortWithError(c, http.StatusBadRequest, fmt.Errorf("either finished or total is required"))
+				return
+			}
+			if req.Total != nil && *req.Total == 0 {
+				abortWithError(c, http.StatusBadRequest, fmt.Errorf("total can't be zero"))
+				return
+			}
+			if req.Finished != nil {
+				d.Timer.State.FinishedSessions = *req.Finished
+			}
+			if req.Total != nil {
+				d.Timer.Config.Sessions = *req.Total
+			}
+			d.Timer.Changed()
+			d.respondV1(c)
+		}},
+		{http.MethodPut, "/timer/task", "set what is being worked on", TaskRequest{}, TimerResponse{}, func(c *gin.Context) {
+			var req TaskRequest
+			if !bindV1(c, &req) {
+				return
+			}
+			d.Timer.State.Task = req.Task
+			d.Timer.Changed()
+			d.respondV1(c)
+		}},
+		timerAction("skip to the next mode", "/timer/next", consensus.Next, d.Timer.SwitchNextMode),
+		timerAction("go back to the previous mode", "/timer/prev", consensus.Prev, d.Timer.SwitchPrevMode),
+		timerAction("reset the current mode", "/timer/reset", consensus.Reset, d.Timer.Reset),
+		timerAction("start a new cycle", "/timer/init", consensus.Init, d.Timer.Init),
+	}, d.v1ConsensusRoutes()...)
+}
+
+// V1Routes sets up the versioned api at /api/v1, and its openapi document at
+// /api/v1/openapi.json. changes honor the If-Match header, responding 409
+// Conflict if it doesn't match the timer's version
+func (d *Daemon) V1Routes() {
+	group := d.router.Group("/api/v1")
+	routes := d.v1Routes()
+	for _, r := range routes {
+		if r.method == http.MethodGet {
+			group.Handle(r.method, r.path, r.handler)
+		} else {
+			group.Handle(r.method, r.path, d.precondition, r.handler)
+		}
+	}
+	spec := openapiSpec(d.BasePath+"/api/v1", routes)
+	group.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
+}
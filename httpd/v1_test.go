@@ -0,0 +1,212 @@
+package httpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func newTestDaemon() *Daemon {
+	config := timer.DefaultConfig
+	d := &Daemon{
+		Timer: &timer.PomodoroTimer{Config: &config},
+		Hub:   NewHub(DEFAULT_QUEUE_SIZE, DEFAULT_REPLAY_SIZE),
+	}
+	d.Timer.Init()
+	d.Init()
+	d.SetupEvents()
+	d.JsonRoutes()
+	d.V1Routes()
+	return d
+}
+
+func request(d *Daemon, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	d.engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestV1Endpoints(t *testing.T) {
+	d := newTestDaemon()
+	for _, item := range []struct {
+		method, path, body string
+		status             int
+		check              func(TimerResponse) bool
+	}{
+		{"GET", "/api/v1/timer", "", http.StatusOK, func(r TimerResponse) bool { return r.Mode == "pomodoro" }},
+		{"POST", "/api/v1/timer/pause", `{"paused": true}`, http.StatusOK, func(r TimerResponse) bool { return r.Paused }},
+		{"POST", "/api/v1/timer/pause", `{}`, http.StatusBadRequest, nil},
+		{"POST", "/api/v1/timer/seek", `{"duration": "10m"}`, http.StatusOK, func(r TimerResponse) bool { return r.Remaining == Duration(10*time.Minute) }},
+		{"POST", "/api/v1/timer/seek", `{"duration": "-1m", "relative": true}`, http.StatusOK, func(r TimerResponse) bool { return r.Remaining == Duration(9*time.Minute) }},
+		{"POST", "/api/v1/timer/seek", `{"duration": "soon"}`, http.StatusBadRequest, nil},
+		{"PUT", "/api/v1/timer/mode", `{"mode": "long_break"}`, http.StatusOK, func(r TimerResponse) bool { return r.Mode == "long_break" && r.Remaining == r.Durations["long_break"] }},
+		{"PUT", "/api/v1/timer/mode", `{"mode": "lunch"}`, http.StatusBadRequest, nil},
+		{"PUT", "/api/v1/timer/sessions", `{"finished": 3}`, http.StatusOK, func(r TimerResponse) bool { return r.FinishedSessions == 3 }},
+		{"PUT", "/api/v1/timer/sessions", `{}`, http.StatusBadRequest, nil},
+		{"PUT", "/api/v1/timer/task", `{"task": "tests"}`, http.StatusOK, func(r TimerResponse) bool { return r.Task == "tests" }},
+		{"POST", "/api/v1/timer/init", "", http.StatusOK, func(r TimerResponse) bool { return r.Mode == "pomodoro" && r.FinishedSessions == 0 }},
+	} {
+		w := request(d, item.method, item.path, item.body)
+		if w.Code != item.status {
+			t.Fatalf("%s %s %s responded %d. expected %d: %s", item.method, item.path, item.body, w.Code, item.status, w.Body)
+		}
+		if item.status != http.StatusOK {
+			var res ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Error == "" {
+				t.Fatalf("%s %s %s didn't respond with an error body: %s", item.method, item.path, item.body, w.Body)
+			}
+			continue
+		}
+		var res TimerResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if !item.check(res) {
+			t.Fatalf("%s %s %s responded unexpectedly: %s", item.method, item.path, item.body, w.Body)
+		}
+	}
+}
+
+func TestPostTimerBadRequest(t *testing.T) {
+	d := newTestDaemon()
+	for _, body := range []string{
+		`{"State": `,
+		`{"State": {"Mode": 7}}`,
+		`{"State": {"Duration": -1}, "Config": {"Sessions": 8}}`,
+		`{"Config": {"Sessions": 0}}`,
+		`{"Config": {"Duration": [0, 1, 1]}}`,
+	} {
+		if w := request(d, "POST", "/api/timer", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("POST /api/timer %s responded %d", body, w.Code)
+		}
+	}
+	if d.Timer.State.Mode != timer.Pomodoro || d.Timer.Config.Sessions != 4 || d.Timer.Config.Duration[timer.Pomodoro] != 25*time.Minute {
+		t.Fatalf("invalid body changed the timer: %+v %+v", &d.Timer.State, d.Timer.Config)
+	}
+}
+
+func TestPostTimerFields(t *testing.T) {
+	d := newTestDaemon()
+	version := d.Timer.State.Version
+	body := `{"State": {"Task": "x", "Version": 9, "Daily": {"Pomodoros": 9}}, "Config": {"Sessions": 6, "DurationPerTick": 1, "DayBoundary": 1}}`
+	if w := request(d, "POST", "/api/timer", body); w.Code != http.StatusOK {
+		t.Fatalf("POST /api/timer %s responded %d %s", body, w.Code, w.Body)
+	}
+	if d.Timer.State.Task != "x" || d.Timer.Config.Sessions != 6 {
+		t.Fatalf("posted fields aren't applied: %+v %+v", &d.Timer.State, d.Timer.Config)
+	}
+	// only the fields that clients can change are applied
+	if d.Timer.Config.DurationPerTick != time.Second || d.Timer.Config.DayBoundary != 0 || d.Timer.State.Daily.Pomodoros != 0 || d.Timer.State.Version != version+1 {
+		t.Fatalf("posted fields that clients can't change are applied: %+v %+v", &d.Timer.State, d.Timer.Config)
+	}
+}
+
+func TestOpenapiSpec(t *testing.T) {
+	d := newTestDaemon()
+	w := request(d, "GET", "/api/v1/openapi.json", "")
+	var spec struct {
+		Paths      map[string]map[string]any
+		Components struct {
+			Schemas map[string]any
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range d.v1Routes() {
+		path, _ := openapiPath(r.path)
+		if _, ok := spec.Paths[path][strings.ToLower(r.method)]; !ok {
+			t.Fatalf("%s %s isn't documented", r.method, r.path)
+		}
+	}
+	for _, name := range []string{"TimerResponse", "DailyResponse", "ErrorResponse", "SeekRequest"} {
+		if spec.Components.Schemas[name] == nil {
+			t.Fatalf("schema %s is missing", name)
+		}
+	}
+}
+
+func TestOptimisticConcurrency(t *testing.T) {
+	d := newTestDaemon()
+	etag := request(d, "GET", "/api/v1/timer", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag in response")
+	}
+	patch := func(path, body, if_match string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", if_match)
+		d.engine.ServeHTTP(w, req)
+		return w
+	}
+	w := patch("/api/v1/timer", `{"task": "first", "finished_sessions": 2}`, etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch with the current version responded %d: %s", w.Code, w.Body)
+	}
+	if d.Timer.State.Task != "first" || d.Timer.State.FinishedSessions != 2 || d.Timer.State.Paused {
+		t.Fatalf("patch isn't applied as expected: %q %d %t", d.Timer.State.Task, d.Timer.State.FinishedSessions, d.Timer.State.Paused)
+	}
+	if w = patch("/api/v1/timer", `{"task": "stale"}`, etag); w.Code != http.StatusConflict {
+		t.Fatalf("patch with a stale version responded %d", w.Code)
+	}
+	if w = patch("/api/timer", `{"State": {"Task": "stale"}}`, etag); w.Code != http.StatusConflict {
+		t.Fatalf("legacy patch with a stale version responded %d", w.Code)
+	}
+	if d.Timer.State.Task != "first" {
+		t.Fatalf("stale patch is applied: %q", d.Timer.State.Task)
+	}
+	etag = w.Header().Get("ETag")
+	if w = patch("/api/timer", `{"State": {"Task": "second", "Version": 0}}`, etag); w.Code != http.StatusOK {
+		t.Fatalf("legacy patch with the current version responded %d: %s", w.Code, w.Body)
+	}
+	if d.Timer.State.Task != "second" || d.Timer.State.FinishedSessions != 2 {
+		t.Fatalf("legacy patch isn't applied partially: %q %d", d.Timer.State.Task, d.Timer.State.FinishedSessions)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Fatal("version isn't bumped after a change")
+	}
+	if w = patch("/api/v1/timer", `{"mode": "pomodoro", "sessions": 0}`, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid patch responded %d", w.Code)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	config := timer.DefaultConfig
+	d := &Daemon{
+		Timer:    &timer.PomodoroTimer{Config: &config},
+		Hub:      NewHub(DEFAULT_QUEUE_SIZE, DEFAULT_REPLAY_SIZE),
+		BasePath: "goje/",
+	}
+	d.Timer.Init()
+	d.Init()
+	d.JsonRoutes()
+	d.V1Routes()
+	d.WebguiRoutes("")
+	for _, item := range []struct {
+		path   string
+		status int
+	}{
+		{"/goje/api/timer", http.StatusOK},
+		{"/goje/api/v1/timer", http.StatusOK},
+		{"/goje/", http.StatusOK},
+		{"/goje", http.StatusMovedPermanently},
+		{"/api/timer", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+	} {
+		if w := request(d, "GET", item.path, ""); w.Code != item.status {
+			t.Fatalf("GET %s responded %d. expected %d", item.path, w.Code, item.status)
+		}
+	}
+	page := withBase([]byte("<html><head><title>Goje</title></head></html>"), d.BasePath)
+	if !strings.Contains(string(page), `<head><base href="/goje/">`) {
+		t.Fatalf("base of the page: %s", page)
+	}
+}
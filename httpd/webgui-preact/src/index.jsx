@@ -1,14 +1,25 @@
 import { render } from "preact";
 import { useEffect, useMemo, useState } from "preact/hooks";
 import { Settings } from "./settings";
-import { Button } from "./utils";
-import { postTimer, timerModeString } from "./timer";
+import { Button, formatDuration, ns_in_m } from "./utils";
+import {
+    api,
+    participant,
+    postTimer,
+    propose,
+    shareToken,
+    timerModeString,
+    vote,
+} from "./timer";
 import { sendNotification } from "./utils";
 
 import "./style.css";
 
 /**
  * @typedef {import("./timer.js").Timer} Timer
+ * @typedef {import("./timer.js").Participant} Participant
+ * @typedef {import("./timer.js").Action} Action
+ * @typedef {import("./timer.js").Proposal} Proposal
  */
 
 export function App() {
@@ -17,25 +28,79 @@ export function App() {
     const [settingsEnabled, setSettingsEnabled] = useState(false);
     const [notificationEnabled, setNotificationEnabled] = useState(false);
 
-    const sse = useMemo(() => {
+    const [sse, setSse] = useState(undefined);
+    /** @type {[OutboundStatus, (status: OutboundStatus) => void]} */
+    const [outbound, setOutbound] = useState(undefined);
+    /** @type {[Participant[], (participants: Participant[]) => void]} */
+    const [participants, setParticipants] = useState([]);
+    /** @type {[Action, (action: Action) => void]} */
+    const [lastAction, setLastAction] = useState(undefined);
+    /** @type {[Proposal, (proposal: Proposal) => void]} */
+    const [proposal, setProposal] = useState(undefined);
+    // whether changes need consensus of the participants
+    const [consensus, setConsensus] = useState(false);
+
+    useEffect(() => {
         setNotificationEnabled(localStorage.getItem("notification") === "true");
-        const sse = new EventSource("/api/timer/stream");
-        ["pause", "change", "start", "end"].forEach((event) => {
-            sse.addEventListener(event, (e) => {
-                setTimer(JSON.parse(e.data));
-            });
-        });
-        sse.addEventListener("restart", () => {
-            window.location.reload(true);
-        });
-        sse.onerror = (_) => {
-            setTimer(null);
-        };
-        window.addEventListener("beforeunload", () => {
-            sse.close();
-        });
-        return sse;
+        setSse(connect(setSse, setTimer));
+        fetch(`${api}/participants`)
+            .then((res) => res.json())
+            .then(setParticipants, () => {});
+        fetch(`${api}/actions`)
+            .then((res) => res.json())
+            .then((actions) => setLastAction(actions.at(-1)), () => {});
+        if (shareToken) {
+            // share links are read-only
+            return;
+        }
+        // only goje client has an outbound server
+        fetch("api/outbound")
+            .then((res) => (res.ok ? res.json() : undefined))
+            .then(setOutbound, () => {});
+        fetch("api/proposals")
+            .then((res) => (res.ok ? res.json() : undefined))
+            .then((proposals) => {
+                if (proposals) {
+                    setConsensus(true);
+                    setProposal(proposals.at(-1));
+                }
+            }, () => {});
     }, []);
+    useEffect(() => {
+        if (!sse) {
+            return;
+        }
+        const participantsHandler = (e) => setParticipants(JSON.parse(e.data));
+        const actionHandler = (e) => setLastAction(JSON.parse(e.data));
+        const proposalHandler = (e) => {
+            setConsensus(true);
+            setProposal(JSON.parse(e.data));
+        };
+        sse.addEventListener("participants", participantsHandler);
+        sse.addEventListener("action", actionHandler);
+        sse.addEventListener("proposal", proposalHandler);
+        return () => {
+            sse.removeEventListener("participants", participantsHandler);
+            sse.removeEventListener("action", actionHandler);
+            sse.removeEventListener("proposal", proposalHandler);
+        };
+    }, [sse]);
+    useEffect(() => {
+        if (!sse) {
+            return;
+        }
+        const handler = (e) => setOutbound(JSON.parse(e.data));
+        sse.addEventListener("outbound", handler);
+        return () => sse.removeEventListener("outbound", handler);
+    }, [sse]);
+    useEffect(() => {
+        if (!sse) {
+            return;
+        }
+        const close = () => sse.close();
+        window.addEventListener("beforeunload", close);
+        return () => window.removeEventListener("beforeunload", close);
+    }, [sse]);
     useEffect(() => {
         if (!sse) {
             return;
@@ -46,14 +111,22 @@ export function App() {
                 `${timerModeString(timer.State.Mode)} has ${e.type}ed`
             );
         };
+        const goalNotificationHandler = (e) => {
+            const timer = JSON.parse(e.data);
+            sendNotification(
+                `Daily goal reached! Streak: ${timer.State.Daily.Streak} days`
+            );
+        };
         localStorage.setItem("notification", String(notificationEnabled));
         if (notificationEnabled) {
             sse.addEventListener("start", notificationHandler);
             sse.addEventListener("end", notificationHandler);
+            sse.addEventListener("goal", goalNotificationHandler);
             return () => {
                 ["start", "end"].forEach((item) =>
                     sse.removeEventListener(item, notificationHandler)
                 );
+                sse.removeEventListener("goal", goalNotificationHandler);
             };
         }
     }, [sse, notificationEnabled]);
@@ -66,89 +139,123 @@ export function App() {
                     (settingsEnabled ? " overflow-hidden" : "")
                 }
             >
-                <Settings
-                    onClose={() => setSettingsEnabled(false)}
-                    timer={timer}
-                    hidden={!settingsEnabled}
-                    notification={notificationEnabled}
-                    setNotification={setNotificationEnabled}
+                {!shareToken && (
+                    <Settings
+                        onClose={() => setSettingsEnabled(false)}
+                        timer={timer}
+                        hidden={!settingsEnabled}
+                        notification={notificationEnabled}
+                        setNotification={setNotificationEnabled}
+                    />
+                )}
+                <OutboundIndicator status={outbound} />
+                <Participants
+                    participants={participants}
+                    lastAction={lastAction}
                 />
-                <button
-                    id="settings-button"
-                    title="open settings"
-                    aria-label="open settings"
-                    onClick={() => setSettingsEnabled(true)}
-                    class="absolute top-4 right-4 p-2 rounded dark:bg-zinc-800 bg-white shadow-sm hover:shadow-md transition ease-in-out duration-150 hover:text-zinc-600 hover:dark:text-zinc-300 cursor-pointer z-0"
-                >
-                    {cog_icon}
-                </button>
+                {!shareToken && (
+                    <ProposalPrompt
+                        proposal={proposal}
+                        participants={participants}
+                    />
+                )}
+                {!shareToken && (
+                    <button
+                        id="settings-button"
+                        title="open settings"
+                        aria-label="open settings"
+                        onClick={() => setSettingsEnabled(true)}
+                        class="absolute top-4 right-4 p-2 rounded dark:bg-zinc-800 bg-white shadow-sm hover:shadow-md transition ease-in-out duration-150 hover:text-zinc-600 hover:dark:text-zinc-300 cursor-pointer z-0"
+                    >
+                        {cog_icon}
+                    </button>
+                )}
                 <div
                     id="timer-wrapper"
                     class="min-w-60 text-center dark:bg-zinc-800 bg-white rounded-lg p-4 flex gap-4 flex-col shadow-sm hover:shadow-md transition ease-in-out duration-150"
                 >
                     <ModeSelection timer={timer} />
+                    <TaskInput timer={timer} />
                     <div
                         id="timer-sessions-wrapper"
                         class="flex flex-row justify-center gap-2"
                     >
-                        <Button
-                            title="-1 finished sessions"
-                            onClick={() => {
-                                if (timer.State.FinishedSessions > 0) {
-                                    timer.State.FinishedSessions--;
-                                }
-                                postTimer(timer);
-                            }}
-                        >
-                            {minus_icon}
-                        </Button>
+                        {!shareToken && (
+                            <Button
+                                title="-1 finished sessions"
+                                onClick={() => {
+                                    if (timer.State.FinishedSessions > 0) {
+                                        timer.State.FinishedSessions--;
+                                    }
+                                    postTimer(timer);
+                                }}
+                            >
+                                {minus_icon}
+                            </Button>
+                        )}
                         {timer.State.FinishedSessions}/{timer.Config.Sessions}
-                        <Button
-                            title="+1 finished sessions"
-                            onClick={() => {
-                                timer.State.FinishedSessions++;
-                                postTimer(timer);
-                            }}
-                        >
-                            {plus_icon}
-                        </Button>
+                        {!shareToken && (
+                            <Button
+                                title="+1 finished sessions"
+                                onClick={() => {
+                                    timer.State.FinishedSessions++;
+                                    postTimer(timer);
+                                }}
+                            >
+                                {plus_icon}
+                            </Button>
+                        )}
                     </div>
 
+                    <DailyProgress timer={timer} />
                     <TimerCircle timer={timer} />
-                    <div
-                        id="timer-control-wrapper"
-                        class="flex justify-center gap-4"
-                    >
-                        <Button
-                            id="timer-control-prev"
-                            title="Previous mode"
-                            onClick={() => {
-                                postTimer(timer, "/prevmode");
-                            }}
+                    {!shareToken && (
+                        <div
+                            id="timer-control-wrapper"
+                            class="flex justify-center gap-4"
                         >
-                            {prev_icon}
-                        </Button>
-                        <Button
-                            id="timer-control-pause"
-                            title={`${
-                                timer.State.Paused ? "Resume" : "Pause"
-                            } timer`}
-                            onClick={() => {
-                                postTimer(timer, "/pause");
-                            }}
-                        >
-                            {timer.State.Paused ? play_icon : pause_icon}
-                        </Button>
-                        <Button
-                            id="timer-control-next"
-                            title="Next mode"
-                            onClick={() => {
-                                postTimer(timer, "/nextmode");
-                            }}
-                        >
-                            {next_icon}
-                        </Button>
-                    </div>
+                            <Button
+                                id="timer-control-prev"
+                                title="Previous mode"
+                                onClick={() => {
+                                    postTimer(timer, "/prevmode");
+                                }}
+                            >
+                                {prev_icon}
+                            </Button>
+                            <Button
+                                id="timer-control-pause"
+                                title={`${
+                                    timer.State.Paused ? "Resume" : "Pause"
+                                } timer`}
+                                onClick={() => {
+                                    postTimer(timer, "/pause");
+                                }}
+                            >
+                                {timer.State.Paused ? play_icon : pause_icon}
+                            </Button>
+                            <Button
+                                id="timer-control-next"
+                                title="Next mode"
+                                onClick={() => {
+                                    postTimer(timer, "/nextmode");
+                                }}
+                            >
+                                {next_icon}
+                            </Button>
+                            {consensus && (
+                                <Button
+                                    id="timer-control-extend"
+                                    title="Propose extending the mode by 5 minutes"
+                                    onClick={() => {
+                                        propose("extend", 5 * ns_in_m);
+                                    }}
+                                >
+                                    +5m
+                                </Button>
+                            )}
+                        </div>
+                    )}
                 </div>
             </div>
         );
@@ -160,13 +267,203 @@ export function App() {
                 class="h-full flex flex-col justify-center items-center bg-zinc-200 text-zinc-900 dark:text-white dark:bg-zinc-900"
             >
                 <span class="flex flex-row gap-1 items-center">
-                    Goje isn't running <img src="/assets/goje-sad-32x32.png" />
+                    Goje isn't running <img src="assets/goje-sad-32x32.png" />
                 </span>
             </div>
         );
     }
 }
 
+/**
+ * connects to the event stream. browsers reconnect on their own (resuming from
+ * the last event), but give up if the server responds with an error (a proxy
+ * while goje is restarting for example). in that case we reconnect ourselves
+ * @param {string} lastEventId - id of the last event got, to resume from
+ * @returns {EventSource}
+ */
+function connect(setSse, setTimer, lastEventId = "") {
+    const query = new URLSearchParams();
+    if (lastEventId) {
+        query.set("last-event-id", lastEventId);
+    }
+    const self = participant();
+    if (self.name) {
+        query.set("participant", self.id);
+        query.set("secret", self.secret);
+        query.set("name", self.name);
+        query.set("task", self.task);
+    }
+    const sse = new EventSource(`${api}/timer/stream?${query}`);
+    ["pause", "change", "start", "end", "goal"].forEach((event) => {
+        sse.addEventListener(event, (e) => {
+            lastEventId = e.lastEventId;
+            setTimer(JSON.parse(e.data));
+        });
+    });
+    sse.addEventListener("restart", () => {
+        window.location.reload(true);
+    });
+    sse.onerror = (_) => {
+        setTimer(null);
+        if (sse.readyState === EventSource.CLOSED) {
+            setTimeout(() => setSse(connect(setSse, setTimer, lastEventId)), 3000);
+        }
+    };
+    return sse;
+}
+
+/**
+ * @typedef {Object} OutboundStatus
+ * @property {string} Address - address of the outbound server
+ * @property {Boolean} Connected - is the client connected to the server?
+ * @property {string} Since - since when the client is (dis)connected
+ * @property {string} [Error] - last error of the connection
+ * @property {number} Pending - count of local changes not sent to the server yet
+ */
+
+function OutboundIndicator(p) {
+    /** @type {OutboundStatus} */
+    const status = p.status;
+    if (!status) {
+        return;
+    }
+    return (
+        <div
+            id="outbound-indicator"
+            title={
+                status.Connected
+                    ? `Synced with ${status.Address}`
+                    : `${status.Address} is unreachable since ${new Date(
+                          status.Since
+                      ).toLocaleTimeString()}: ${status.Error}`
+            }
+            class="absolute top-4 left-4 p-2 rounded dark:bg-zinc-800 bg-white shadow-sm text-sm flex items-center gap-2"
+        >
+            <span
+                class={
+                    "inline-block size-2 rounded-full " +
+                    (status.Connected ? "bg-green-500" : "bg-red-500")
+                }
+            />
+            {status.Connected
+                ? "Synced"
+                : `Offline${
+                      status.Pending ? ` · ${status.Pending} pending` : ""
+                  }`}
+        </div>
+    );
+}
+
+const action_verbs = {
+    pause: "paused",
+    resume: "resumed",
+    skip: "skipped",
+    reset: "reset",
+};
+
+function Participants(p) {
+    /** @type {Participant[]} */
+    const participants = p.participants;
+    /** @type {Action} */
+    const action = p.lastAction;
+    if (!participants.length && !action) {
+        return;
+    }
+    return (
+        <div
+            id="participants"
+            class="absolute bottom-4 left-4 p-2 rounded dark:bg-zinc-800 bg-white shadow-sm text-sm flex flex-col gap-1 max-w-64"
+        >
+            {participants.map((participant) => (
+                <div
+                    class="flex items-center gap-2"
+                    title={`joined at ${new Date(
+                        participant.Joined
+                    ).toLocaleTimeString()}`}
+                >
+                    <span class="inline-block size-2 rounded-full bg-green-500" />
+                    <span class="font-bold">{participant.Name}</span>
+                    {participant.Task && (
+                        <span class="truncate">{participant.Task}</span>
+                    )}
+                </div>
+            ))}
+            {action && (
+                <div id="last-action" class="text-zinc-500">
+                    {action.Name || "someone"} {action_verbs[action.Action]}{" "}
+                    {timerModeString(action.Mode)} at{" "}
+                    {new Date(action.Time).toLocaleTimeString()}
+                </div>
+            )}
+        </div>
+    );
+}
+
+const proposal_verbs = {
+    next: "skipping to the next mode",
+    prev: "going back to the previous mode",
+    reset: "resetting the timer",
+    extend: "extending the mode",
+    mode: "switching the mode",
+    seek: "setting the remaining time",
+    init: "starting a new cycle",
+};
+
+function ProposalPrompt(p) {
+    /** @type {Proposal} */
+    const proposal = p.proposal;
+    /** @type {Participant[]} */
+    const participants = p.participants;
+    if (!proposal || proposal.Status !== "open") {
+        return;
+    }
+    const self = participant();
+    const voted =
+        proposal.Approvals.includes(self.id) ||
+        proposal.Rejections.includes(self.id);
+    const proposer =
+        participants.find((item) => item.Id === proposal.Proposer)?.Name ||
+        "someone";
+    let what = proposal_verbs[proposal.Action];
+    if (proposal.Action === "extend") {
+        what += ` by ${formatDuration(proposal.Duration)}`;
+    } else if (proposal.Action === "mode") {
+        what += ` to ${timerModeString(proposal.Mode)}`;
+    } else if (proposal.Action === "seek") {
+        what += ` to ${formatDuration(proposal.Duration)}`;
+    }
+    return (
+        <div
+            id="proposal"
+            class="absolute top-4 left-1/2 -translate-x-1/2 p-3 rounded dark:bg-zinc-800 bg-white shadow-md text-sm flex flex-col gap-2 items-center"
+        >
+            <span>
+                <span class="font-bold">{proposer}</span> proposes {what}
+            </span>
+            <span class="text-zinc-500">
+                {proposal.Approvals.length}/{proposal.Needed} approvals,
+                expires at {new Date(proposal.Expires).toLocaleTimeString()}
+            </span>
+            {!voted && (
+                <div class="flex gap-2">
+                    <Button
+                        id="proposal-approve"
+                        onClick={() => vote(proposal.Id, true)}
+                    >
+                        Approve
+                    </Button>
+                    <Button
+                        id="proposal-reject"
+                        onClick={() => vote(proposal.Id, false)}
+                    >
+                        Reject
+                    </Button>
+                </div>
+            )}
+        </div>
+    );
+}
+
 function TimerCircle(p) {
     const progress = useMemo(() => {
         if (p.timer) {
@@ -187,20 +484,65 @@ function TimerCircle(p) {
                 id="timer-inner-circle"
                 class="flex gap-2 justify-center items-center bg-white dark:bg-zinc-800"
             >
-                <Button
-                    title="Reset timer"
-                    onClick={() => {
-                        postTimer(p.timer, "/reset");
-                    }}
-                >
-                    {restart_icon}
-                </Button>
+                {!shareToken && (
+                    <Button
+                        title="Reset timer"
+                        onClick={() => {
+                            postTimer(p.timer, "/reset");
+                        }}
+                    >
+                        {restart_icon}
+                    </Button>
+                )}
                 <Timer timer={p.timer} />
             </div>
         </div>
     );
 }
 
+function DailyProgress(p) {
+    const daily = p.timer.State.Daily;
+    const config = p.timer.Config;
+    if (!config.GoalPomodoros && !config.GoalFocus && !daily.Pomodoros) {
+        return;
+    }
+    return (
+        <div
+            id="daily-progress"
+            title="Daily progress"
+            class={
+                "text-sm" + (daily.GoalReached ? " font-bold" : "")
+            }
+        >
+            {daily.Pomodoros}
+            {config.GoalPomodoros ? `/${config.GoalPomodoros}` : ""} today
+            {" · "}
+            {formatDuration(daily.Focus - (daily.Focus % ns_in_m)) || "0m"}
+            {config.GoalFocus ? `/${formatDuration(config.GoalFocus)}` : ""}
+            {daily.Streak ? ` · ${daily.Streak} day streak` : ""}
+        </div>
+    );
+}
+
+function TaskInput(p) {
+    return (
+        <input
+            id="timer-task"
+            aria-label="Task"
+            title="Task"
+            type="text"
+            placeholder="What are you working on?"
+            value={p.timer.State.Task}
+            readOnly={!!shareToken}
+            class="dark:bg-zinc-900 bg-zinc-200 p-2 rounded"
+            onChange={(e) => {
+                p.timer.State.Task = e.target.value;
+                postTimer(p.timer);
+            }}
+        />
+    );
+}
+
 function ModeSelection(p) {
     const modeOptions = useMemo(() => {
         return [0, 1, 2].map((mode) => (
@@ -219,6 +561,7 @@ function ModeSelection(p) {
             aria-label="Timer mode"
             title="Timer mode"
             value={p.timer.State.Mode}
+            disabled={!!shareToken}
             class="dark:bg-zinc-900 bg-zinc-200 p-2 rounded"
             onChange={(e) => {
                 p.timer.State.Mode = parseInt(e.target.value);
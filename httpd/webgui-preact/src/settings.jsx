@@ -1,6 +1,6 @@
 import { useEffect, useMemo, useState } from 'preact/hooks';
 import { Radio, Button, parseDuration, formatDuration } from "./utils"
-import { postTimer, timerModeString } from "./timer"
+import { participant, postTimer, timerModeString } from "./timer"
 import { sendNotification } from "./utils"
 
   function updateNotifications() {
@@ -51,9 +51,58 @@ export function Settings(p) {
               onChange={(e) => p.timer.Config.Sessions = parseInt(e.target.value)}
             />
           </div>
+          <div>
+            <label htmlFor="timer-config-goal-pomodoros">Daily goal (pomodoros)</label>
+            <input id="timer-config-goal-pomodoros"
+              class="rounded p-2 text-md bg-zinc-200 dark:bg-zinc-700 w-full"
+              type="text" value={p.timer.Config.GoalPomodoros}
+              onChange={(e) => p.timer.Config.GoalPomodoros = parseInt(e.target.value) || 0}
+            />
+          </div>
+          <div>
+            <label htmlFor="timer-config-goal-focus">Daily goal (focus time)</label>
+            <input id="timer-config-goal-focus"
+              class="rounded p-2 text-md bg-zinc-200 dark:bg-zinc-700 w-full"
+              type="text" value={formatDuration(p.timer.Config.GoalFocus)}
+              onChange={(e) => p.timer.Config.GoalFocus = parseDuration(e.target.value)}
+            />
+          </div>
           <Radio id="timer-config-paused" checked={p.timer.Config.Paused} onChange={() => p.timer.Config.Paused = !p.timer.Config.Paused}>
             is timer initially paused
           </Radio>
+          <div>
+            <label htmlFor="participant-name">Your name (to join as a participant)</label>
+            <input id="participant-name"
+              class="rounded p-2 text-md bg-zinc-200 dark:bg-zinc-700 w-full"
+              type="text" value={participant().name}
+              onChange={(e) => {
+                localStorage.setItem("participant-name", e.target.value.trim())
+                // reconnects to the stream as the participant
+                window.location.reload()
+              }}
+            />
+          </div>
+          <div>
+            <label htmlFor="participant-task">What you're working on</label>
+            <input id="participant-task"
+              class="rounded p-2 text-md bg-zinc-200 dark:bg-zinc-700 w-full"
+              type="text" value={participant().task}
+              onChange={(e) => {
+                localStorage.setItem("participant-task", e.target.value)
+                const self = participant()
+                if (self.name) {
+                  fetch(`api/participants/${self.id}`, {
+                    method: "PUT",
+                    headers: {
+                      "Content-Type": "application/json",
+                      "X-Goje-Participant-Secret": self.secret,
+                    },
+                    body: JSON.stringify({ Name: self.name, Task: self.task }),
+                  })
+                }
+              }}
+            />
+          </div>
           <Radio id="webgui-notification" checked={p.notification} onChange={(e) => {
             p.setNotification(!p.notification);
             if (!p.notification) {
@@ -62,6 +111,7 @@ export function Settings(p) {
           }}>
             send notifications
           </Radio>
+          <ShareLinks />
           <input type="button" value={buttonValue}
     onClick={(e)=> {
      postTimer(p.timer, "/save-settings-to-file") 
@@ -78,6 +128,52 @@ export function Settings(p) {
   );
 }
 
+/**
+ * read-only links of the timer, that can be revoked
+ */
+function ShareLinks() {
+  /** @type {[import("./timer.js").Share[], (shares: import("./timer.js").Share[]) => void]} */
+  const [shares, setShares] = useState([])
+  const [name, setName] = useState("")
+  const update = () => fetch("api/shares").then((res) => res.json()).then(setShares, () => {})
+  useEffect(() => { update() }, [])
+  return (
+    <div id="share-links" class="flex flex-col gap-2">
+      <label htmlFor="share-name">Read-only share links</label>
+      {shares.map((share) => {
+        const url = new URL(`share/${share.Token}`, document.baseURI).href
+        return (
+          <div class="flex items-center gap-2 text-sm">
+            <a href={url} target="_blank" class="truncate grow underline" title={url}>{share.Name || share.Token}</a>
+            <Button title="revoke the link" onClick={(e) => {
+              // doesn't submit the settings
+              e.preventDefault()
+              fetch(`api/shares/${share.Token}`, { method: "DELETE" }).then(update)
+            }}>{close_icon}</Button>
+          </div>
+        )
+      })}
+      <div class="flex gap-2">
+        <input id="share-name"
+          class="rounded p-2 text-md bg-zinc-200 dark:bg-zinc-700 w-full"
+          type="text" placeholder="wall display" value={name}
+          onChange={(e) => setName(e.target.value)}
+        />
+        <input type="button" value="share"
+          onClick={() => {
+            fetch("api/shares", {
+              method: "POST",
+              headers: { "Content-Type": "application/json" },
+              body: JSON.stringify({ Name: name }),
+            }).then(update)
+            setName("")
+          }}
+          class="cursor-pointer p-2 rounded transition ease-in-out duration-300 dark:bg-zinc-900 dark:hover:text-zinc-300 hover:text-zinc-700 bg-zinc-200" />
+      </div>
+    </div>
+  )
+}
+
 const close_icon = <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" strokeWidth={1.5} stroke="currentColor" class="size-6">
   <path strokeLinecap="round" strokeLinejoin="round" d="M6 18 18 6M6 6l12 12" />
 </svg>
@@ -1,15 +1,143 @@
+/**
+ * path of the page, relative to the base path that goje is served under (the
+ * <base> element). urls of the webgui are relative, so goje works under any
+ * prefix
+ */
+const relativePath = window.location.pathname.slice(
+  new URL(document.baseURI).pathname.length
+)
+
+/**
+ * token of the share link that the webgui is opened with. the view is
+ * read-only if it's set
+ * @type {string|undefined}
+ */
+export const shareToken = relativePath.match(/^share\/([^/]+)/)?.[1]
+
+/** base of the api. share links have their own read-only api */
+export const api = shareToken ? `share/${shareToken}/api` : "api"
+
 /**
  * @param {Timer} timer - timer to post to
  * @param {string} endpoint - anything to be added to /api/timer. must start with "/"
 */
 export function postTimer(timer, endpoint="") {
+  if (shareToken) {
+    return
+  }
   let xhr = new XMLHttpRequest();
-  xhr.open("POST", '/api/timer' + endpoint, true);
+  xhr.open("POST", 'api/timer' + endpoint, true);
   xhr.setRequestHeader("Content-Type", "application/json; charset=UTF-8")
+  // the change is rejected if the timer has changed since this version
+  xhr.setRequestHeader("If-Match", `"${timer.State.Version}"`)
+  const self = participant()
+  if (self.name) {
+    // so pauses, skips and resets are attributed to us
+    xhr.setRequestHeader("X-Goje-Participant", self.id)
+    xhr.setRequestHeader("X-Goje-Participant-Secret", self.secret)
+  }
   xhr.responseType = 'json'
   xhr.send(JSON.stringify(timer));
 }
 
+/**
+ * @typedef {Object} Participant
+ * @property {string} Id - id of the participant
+ * @property {string} Name - display name of the participant
+ * @property {string} Task - what the participant is working on
+ * @property {string} Joined - when the participant has joined
+ * @property {number} Connections - count of connected streams of the participant
+ */
+
+/**
+ * @typedef {Object} Action
+ * @property {string} Time - when the action was made
+ * @property {string} Action - "pause", "resume", "skip" or "reset"
+ * @property {TimerMode} Mode - mode of the timer after the action
+ * @property {string} [Participant] - id of the participant who made the action
+ * @property {string} [Name] - name of the participant who made the action
+ */
+
+/**
+ * @typedef {Object} Proposal
+ * @property {number} Id - id of the proposal
+ * @property {string} Action - "next", "prev", "reset", "extend", "mode", "seek" or "init"
+ * @property {number} [Duration] - nanoseconds to extend the mode by, or to seek to
+ * @property {TimerMode} [Mode] - mode to switch to
+ * @property {string} Proposer - id of the participant who proposed it
+ * @property {string[]} Approvals - ids of the participants who approved it
+ * @property {string[]} Rejections - ids of the participants who rejected it
+ * @property {number} Needed - count of approvals needed
+ * @property {string} Expires - when the proposal expires
+ * @property {string} Status - "open", "approved", "rejected" or "expired"
+ */
+
+/**
+ * @param {string} path - anything to be added to /api/proposals
+ * @param {Object} body
+ */
+function postProposals(path, body) {
+  const self = participant()
+  return fetch('api/proposals' + path, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json; charset=UTF-8",
+      "X-Goje-Participant": self.id,
+      "X-Goje-Participant-Secret": self.secret,
+    },
+    body: JSON.stringify(body),
+  })
+}
+
+/**
+ * proposes an action, that is applied when enough participants approve it
+ * @param {string} action - "next", "prev", "reset", "extend", "mode", "seek" or "init"
+ * @param {number} [duration] - nanoseconds to extend the mode by
+ */
+export function propose(action, duration = 0) {
+  return postProposals("", { Action: action, Duration: duration })
+}
+
+/**
+ * @param {number} id - id of the proposal
+ * @param {boolean} approve
+ */
+export function vote(id, approve) {
+  return postProposals(`/${id}/vote`, { Approve: approve })
+}
+
+/**
+ * @typedef {Object} Share
+ * @property {string} Token - token of the link, at /share/<Token>
+ * @property {string} Name - what the link is for
+ * @property {string} Created - when the link was created
+ */
+
+/**
+ * identity of this browser in shared sessions. the name is empty unless the
+ * user has set one, in which case we don't join as a participant. the secret
+ * claims the participant, so others can't act as us
+ * @returns {{id: string, secret: string, name: string, task: string}}
+ */
+export function participant() {
+  let id = localStorage.getItem("participant")
+  if (!id) {
+    id = Math.random().toString(36).slice(2, 10)
+    localStorage.setItem("participant", id)
+  }
+  let secret = localStorage.getItem("participant-secret")
+  if (!secret) {
+    const bytes = crypto.getRandomValues(new Uint8Array(16))
+    secret = Array.from(bytes, (b) => b.toString(16).padStart(2, "0")).join("")
+    localStorage.setItem("participant-secret", secret)
+  }
+  return {
+    id,
+    secret,
+    name: localStorage.getItem("participant-name") || "",
+    task: localStorage.getItem("participant-task") || "",
+  }
+}
 
 /**
  * @param {TimerMode} mode
@@ -38,6 +166,17 @@ export function timerModeString(mode) {
  * @property {Duration[]} Duration - default duration of each mode (an array of 3)
  * @property {number} Sessions - count of sessions per timer
  * @property {Boolean} Paused - would timer be paused at the start of a timer?
+ * @property {number} GoalPomodoros - daily goal of finished pomodoros (0 means no goal)
+ * @property {Duration} GoalFocus - daily goal of time spent in pomodoros (0 means no goal)
+ */
+
+/**
+ * @typedef {Object} DailyProgress
+ * @property {string} Day - start of the day this progress belongs to
+ * @property {number} Pomodoros - pomodoros finished today
+ * @property {Duration} Focus - time spent in pomodoros today
+ * @property {Boolean} GoalReached - is the daily goal reached?
+ * @property {number} Streak - consecutive days that the goal was reached
  */
 
 /**
@@ -47,5 +186,8 @@ export function timerModeString(mode) {
  * @property {TimerMode} Mode - current timer mode
  * @property {Boolean} Paused - is timer paused right now?
  * @property {number} FinishedSessions - number of finished sessions
+ * @property {DailyProgress} Daily - progress toward the daily goal
+ * @property {string} Task - what is being worked on
+ * @property {number} Version - version of the state, that changes are based on
  */
 
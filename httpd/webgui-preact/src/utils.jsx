@@ -31,7 +31,7 @@ export function Button(props) {
 
 const ns_in_ms = 1_000_000
 const ns_in_s = 1_000_000_000
-const ns_in_m = ns_in_s * 60
+export const ns_in_m = ns_in_s * 60
 const ns_in_h = ns_in_m * 60
 
 /**
@@ -79,7 +79,7 @@ export function parseDuration(duration) {
 export function sendNotification(body) {
   let notif = {
       body, 
-      icon: window.location.origin+"/assets/goje-512x512.png",
+      icon: new URL("assets/goje-512x512.png", document.baseURI).href,
     }
   console.log(notif)
     const n = new Notification("Goje", notif)
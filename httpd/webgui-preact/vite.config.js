@@ -3,6 +3,8 @@ import preact from '@preact/preset-vite';
 import tailwindcss from '@tailwindcss/vite'
 // https://vitejs.dev/config/
 export default defineConfig({
+  // relative urls, so the build works under any base path
+  base: "./",
 	plugins: [
     preact(),
     tailwindcss(),
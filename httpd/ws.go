@@ -0,0 +1,189 @@
+package httpd
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/nimaaskarian/goje/tcpd"
+)
+
+const (
+	// time allowed for the client to respond to a ping
+	wsPongWait = 60 * time.Second
+	// pings are sent with this period. must be less than wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+	// time allowed for writing a message to the client
+	wsWriteWait = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// WsCommand is a command sent by a websocket client. commands are either sent
+// as this json object, or as a plain text line of the tcpd command language
+type WsCommand struct {
+	// optional. copied into the command's acknowledgement
+	Id      string `json:"id,omitempty"`
+	Command string `json:"command"`
+}
+
+// WsMessage is a message sent to websocket clients. its either an event of
+// the timer (same as the events of /api/timer/stream) or an acknowledgement of
+// a command
+type WsMessage struct {
+	Event string `json:"event"`
+	Data  any    `json:"data,omitempty"`
+	// id of the event, to be sent as last-event-id query when reconnecting.
+	// for "ack" messages, id of the acknowledged command
+	Id     string `json:"id,omitempty"`
+	Ok     bool   `json:"ok,omitempty"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleWebsocket streams the events to a websocket client, and runs its
+// commands
+func (d *Daemon) handleWebsocket(c *gin.Context) {
+	participant, err := d.join(c)
+	if err != nil {
+		abortWithError(c, http.StatusForbidden, err)
+		return
+	}
+	if participant != "" {
+		defer d.Participants.Leave(participant)
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.Warn("upgrading to websocket failed", "err", err)
+		return
+	}
+	defer conn.Close()
+	acks := make(chan WsMessage, 1)
+	// closed when the reader returns
+	done := make(chan struct{})
+	// closed when the writer returns
+	quit := make(chan struct{})
+	defer close(quit)
+	last_event_id, resume := lastEventId(c)
+	client := d.Hub.Subscribe("websocket", c.Request, last_event_id, resume, ChangeEvent(lockedSnapshot(d.Timer)))
+	defer d.Hub.Unsubscribe(client)
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for {
+			event, err := client.Next(c.Request.Context())
+			if err != nil {
+				if err == ErrEvicted {
+					slog.Warn("evicted a slow websocket client", "address", client.Address)
+				}
+				return
+			}
+			select {
+			case events <- event:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(done)
+		d.readWebsocket(conn, participant, readOnly(c), acks, quit)
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		var msg WsMessage
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			msg = WsMessage{Event: event.Name, Id: strconv.FormatUint(event.Id, 10), Data: event.Payload}
+		case msg = <-acks:
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			slog.Warn("writing to websocket failed", "err", err)
+			return
+		}
+		if msg.Event == "restart" {
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "restart"), time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+// readWebsocket runs the commands of a websocket client, and sends their
+// acknowledgements to acks. commands of read-only clients are rejected.
+// returns when the connection or quit is closed
+func (d *Daemon) readWebsocket(conn *websocket.Conn, participant string, read_only bool, acks chan<- WsMessage, quit <-chan struct{}) {
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("reading from websocket failed", "err", err)
+			}
+			return
+		}
+		var ack WsMessage
+		var command WsCommand
+		if text := strings.TrimSpace(string(data)); strings.HasPrefix(text, "{") {
+			err = json.Unmarshal(data, &command)
+		} else {
+			command.Command = text
+		}
+		switch {
+		case err != nil:
+			ack = WsMessage{Event: "ack", Error: err.Error()}
+		case read_only:
+			ack = WsMessage{Event: "ack", Id: command.Id, Error: "client can only read"}
+		default:
+			ack = d.runWsCommand(command, participant)
+		}
+		select {
+		case acks <- ack:
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (d *Daemon) runWsCommand(command WsCommand, participant string) WsMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.Timer.State.Mu.Lock()
+	defer d.Timer.State.Mu.Unlock()
+	defer d.Act(participant)()
+	ack := WsMessage{Event: "ack", Id: command.Id}
+	session := tcpd.Session{Timer: d.Timer, Voting: d.Voting, Participant: participant}
+	_, out, err := session.Parse(strings.TrimSpace(command.Command))
+	if err != nil {
+		ack.Error = err.Error()
+	} else {
+		ack.Ok = true
+		ack.Output = out
+	}
+	return ack
+}
@@ -0,0 +1,60 @@
+package httpd
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebsocket(t *testing.T) {
+	d := newTestDaemon()
+	d.SetupEvents()
+	server := httptest.NewServer(d.engine)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// reads messages until an ack, and returns it
+	ack := func() WsMessage {
+		for {
+			var msg WsMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Event == "ack" {
+				return msg
+			}
+		}
+	}
+	var msg WsMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Event != "change" {
+		t.Fatalf("first message isn't a change event: %+v %v", msg, err)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("pause 1"))
+	if msg := ack(); !msg.Ok {
+		t.Fatalf("text command isn't acknowledged: %+v", msg)
+	}
+	if !d.Timer.State.Paused {
+		t.Fatal("text command isn't applied")
+	}
+	conn.WriteJSON(WsCommand{Id: "7", Command: "task"})
+	if msg := ack(); !msg.Ok || msg.Id != "7" || msg.Output != "\n" {
+		t.Fatalf("json command isn't acknowledged with its output: %+v", msg)
+	}
+	conn.WriteJSON(WsCommand{Id: "8", Command: "seek soon"})
+	if msg := ack(); msg.Ok || msg.Id != "8" || msg.Error == "" {
+		t.Fatalf("invalid command isn't acknowledged with an error: %+v", msg)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("{not json"))
+	if msg := ack(); msg.Ok || msg.Error == "" {
+		t.Fatalf("invalid json isn't acknowledged with an error: %+v", msg)
+	}
+}
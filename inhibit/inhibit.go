@@ -0,0 +1,98 @@
+package inhibit
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const DEFAULT_WHAT = "idle:sleep"
+
+// Inhibitor holds a systemd-logind inhibitor lock while a pomodoro is
+// running, and releases it on breaks and pauses. logind only lives on the
+// system bus, so this uses the shared system bus connection of godbus
+type Inhibitor struct {
+	dbus *dbus.Conn
+	what string
+	mu   sync.Mutex
+	// file descriptor of the lock. closing it releases the lock
+	lock *os.File
+}
+
+func NewInhibitor(what string) (in *Inhibitor, err error) {
+	if what == "" {
+		what = DEFAULT_WHAT
+	}
+	in = &Inhibitor{what: what}
+	if in.dbus, err = dbus.SystemBus(); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// Acquire takes the inhibitor lock. does nothing if the lock is already held
+func (in *Inhibitor) Acquire() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.lock != nil {
+		return nil
+	}
+	var fd dbus.UnixFD
+	obj := in.dbus.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	call := obj.Call("org.freedesktop.login1.Manager.Inhibit", 0, in.what, "goje", "a pomodoro is running", "block")
+	if err := call.Store(&fd); err != nil {
+		return err
+	}
+	in.lock = os.NewFile(uintptr(fd), "goje-inhibit")
+	slog.Info("inhibitor lock taken", "what", in.what)
+	return nil
+}
+
+// Release releases the inhibitor lock. does nothing if the lock isn't held
+func (in *Inhibitor) Release() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.lock == nil {
+		return nil
+	}
+	err := in.lock.Close()
+	in.lock = nil
+	slog.Info("inhibitor lock released", "what", in.what)
+	return err
+}
+
+// Update takes or releases the lock based on the timer's current state
+func (in *Inhibitor) Update(pt *timer.PomodoroTimer) {
+	var err error
+	if pt.State.Mode == timer.Pomodoro && !pt.State.Paused {
+		err = in.Acquire()
+	} else {
+		err = in.Release()
+	}
+	if err != nil {
+		slog.Error("updating inhibitor lock failed", "err", err)
+	}
+}
+
+func (in *Inhibitor) release(pt *timer.PomodoroTimer) {
+	if err := in.Release(); err != nil {
+		slog.Error("releasing inhibitor lock failed", "err", err)
+	}
+}
+
+func (in *Inhibitor) AddEventWatchers(config *timer.TimerConfig) {
+	config.Hooks.OnModeStart.Append(in.Update)
+	config.Hooks.OnPause.Append(in.Update)
+	config.Hooks.OnModeEnd.Append(func(pt *timer.PomodoroTimer) {
+		// only a pomodoro's end releases the lock. a break's end is followed by
+		// a pomodoro start, which would race with releasing here
+		if pt.State.Mode == timer.Pomodoro {
+			in.release(pt)
+		}
+	})
+	config.Hooks.OnQuit.Append(in.release)
+}
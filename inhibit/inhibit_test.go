@@ -0,0 +1,203 @@
+package inhibit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`
+
+// privateBus runs a dbus-daemon for the test, and returns its address
+func privateBus(t *testing.T) string {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon isn't available")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	content := fmt.Sprintf(busConfig, filepath.Join(dir, "bus"))
+	if err := os.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skip("running dbus-daemon failed:", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// fakeLogind hands out inhibitor locks as the write end of pipes. a lock is
+// released when the read end of its pipe reaches EOF
+type fakeLogind struct {
+	mu    sync.Mutex
+	locks []*os.File
+	what  []string
+	// write ends that are sent, and are still open on this side
+	sent []*os.File
+}
+
+func (l *fakeLogind) Inhibit(what, who, why, mode string) (dbus.UnixFD, *dbus.Error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, dbus.MakeFailedError(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.locks = append(l.locks, r)
+	l.what = append(l.what, what)
+	l.sent = append(l.sent, w)
+	return dbus.UnixFD(w.Fd()), nil
+}
+
+// received closes this side's copies of the sent write ends. the descriptors
+// are duplicated when sent, so call it once the inhibitor has received them
+// (Acquire or Update has returned). the inhibitor's copies are the only ones
+// left then
+func (l *fakeLogind) received() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, w := range l.sent {
+		w.Close()
+	}
+	l.sent = nil
+}
+
+func (l *fakeLogind) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.locks)
+}
+
+// held reports whether the i-th lock is still held
+func (l *fakeLogind) held(t *testing.T, i int) bool {
+	l.mu.Lock()
+	lock := l.locks[i]
+	l.mu.Unlock()
+	lock.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	_, err := lock.Read(make([]byte, 1))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	return false
+}
+
+func newTestInhibitor(t *testing.T) (*Inhibitor, *fakeLogind) {
+	address := privateBus(t)
+	server := connect(t, address)
+	logind := &fakeLogind{}
+	t.Cleanup(logind.received)
+	if err := server.Export(logind, "/org/freedesktop/login1", "org.freedesktop.login1.Manager"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.RequestName("org.freedesktop.login1", dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+	return &Inhibitor{dbus: connect(t, address), what: DEFAULT_WHAT}, logind
+}
+
+func TestInhibitor(t *testing.T) {
+	in, logind := newTestInhibitor(t)
+	if err := in.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	logind.received()
+	// acquiring a held lock does nothing
+	if err := in.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	logind.received()
+	if logind.count() != 1 || logind.what[0] != DEFAULT_WHAT {
+		t.Fatalf("%d locks are taken (%v). expected one", logind.count(), logind.what)
+	}
+	if !logind.held(t, 0) {
+		t.Fatal("lock is released after being acquired")
+	}
+	if err := in.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if logind.held(t, 0) {
+		t.Fatal("lock is held after being released")
+	}
+	if err := in.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInhibitorUpdate(t *testing.T) {
+	in, logind := newTestInhibitor(t)
+	config := timer.DefaultConfig
+	pt := &timer.PomodoroTimer{Config: &config}
+	pt.Init()
+
+	in.Update(pt)
+	logind.received()
+	if logind.count() != 1 || !logind.held(t, 0) {
+		t.Fatal("lock isn't taken on a running pomodoro")
+	}
+	pt.State.Paused = true
+	in.Update(pt)
+	logind.received()
+	if logind.held(t, 0) {
+		t.Fatal("lock is held on a paused pomodoro")
+	}
+	pt.State.Paused = false
+	pt.State.Mode = timer.ShortBreak
+	in.Update(pt)
+	logind.received()
+	if logind.count() != 1 {
+		t.Fatal("lock is taken on a break")
+	}
+	pt.State.Mode = timer.Pomodoro
+	in.Update(pt)
+	logind.received()
+	if logind.count() != 2 || !logind.held(t, 1) {
+		t.Fatal("lock isn't taken again on the next pomodoro")
+	}
+}
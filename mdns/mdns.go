@@ -0,0 +1,410 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	PORT   = 5353
+	DOMAIN = "local."
+	// time to live of the records, in seconds
+	TTL = 120
+)
+
+var group = net.IPv4(224, 0, 0, 251)
+
+// Service is an instance of a DNS-SD service
+type Service struct {
+	// name of the instance ("goje on laptop"). dots are replaced with dashes
+	Instance string
+	// type of the service ("_goje._tcp")
+	Service string
+	// host name of the instance. defaults to the system's host name
+	Host string
+	Port uint16
+	// addresses of the host. defaults to the addresses of the up interfaces
+	IPs []net.IP
+	// "key=value" pairs of the TXT record
+	Txt []string
+}
+
+// Value returns value of key in the service's TXT record
+func (s *Service) Value(key string) (string, bool) {
+	for _, pair := range s.Txt {
+		if k, v, _ := strings.Cut(pair, "="); k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Address returns the first address of the service as "ip:port"
+func (s *Service) Address() string {
+	if len(s.IPs) == 0 {
+		return ""
+	}
+	return net.JoinHostPort(s.IPs[0].String(), strconv.Itoa(int(s.Port)))
+}
+
+// Listen sets the port and addresses of the service to the ones of a listening
+// "host:port" address. addresses are left to the defaults if it listens on all
+// interfaces
+func (s *Service) Listen(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return err
+	}
+	s.Port = uint16(value)
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		s.IPs = []net.IP{ip}
+	} else if ip == nil && host != "" {
+		if s.IPs, err = net.LookupIP(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) serviceName() string {
+	return s.Service + "." + DOMAIN
+}
+
+func (s *Service) instanceName() string {
+	label := strings.ReplaceAll(s.Instance, ".", "-")
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label + "." + s.serviceName()
+}
+
+func (s *Service) hostName() string {
+	return strings.TrimSuffix(s.Host, ".") + "." + DOMAIN
+}
+
+// fill sets the defaults of host and ips
+func (s *Service) fill() error {
+	if s.Host == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		s.Host, _, _ = strings.Cut(host, ".")
+	}
+	if len(s.IPs) == 0 {
+		s.IPs = localIPs()
+	}
+	return nil
+}
+
+// localIPs returns the ipv4 addresses of the up interfaces. loopback addresses
+// are only returned if there are no others
+func localIPs() (ips []net.IP) {
+	var loopback []net.IP
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			if ipnet.IP.IsLoopback() {
+				loopback = append(loopback, ipnet.IP.To4())
+			} else {
+				ips = append(ips, ipnet.IP.To4())
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return loopback
+	}
+	return ips
+}
+
+// Responder answers the mDNS queries for its services
+type Responder struct {
+	services []Service
+	conn     *net.UDPConn
+}
+
+// NewResponder joins the mDNS multicast group, to answer queries for services
+func NewResponder(services ...Service) (*Responder, error) {
+	for i := range services {
+		if err := services[i].fill(); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{IP: group, Port: PORT})
+	if err != nil {
+		return nil, err
+	}
+	return &Responder{services: services, conn: conn}, nil
+}
+
+// Run answers the queries until ctx is done
+func (r *Responder) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		r.conn.Close()
+	}()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				slog.Warn("reading mdns query failed", "err", err)
+			}
+			return
+		}
+		response, err := r.answer(buf[:n], from.Port != PORT)
+		if err != nil || response == nil {
+			continue
+		}
+		to := &net.UDPAddr{IP: group, Port: PORT}
+		if from.Port != PORT {
+			// legacy unicast query (rfc 6762, section 6.7)
+			to = from
+		}
+		if _, err := r.conn.WriteToUDP(response, to); err != nil {
+			slog.Warn("writing mdns response failed", "err", err)
+		}
+	}
+}
+
+// answer returns the response to the query. nil if none of the services are
+// asked for
+func (r *Responder) answer(query []byte, unicast bool) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil, err
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+	var answers, additionals []dnsmessage.Resource
+	for _, q := range questions {
+		name := q.Name.String()
+		for i := range r.services {
+			s := &r.services[i]
+			switch {
+			case matches(q, name, "_services._dns-sd._udp."+DOMAIN, dnsmessage.TypePTR):
+				answers = append(answers, ptr("_services._dns-sd._udp."+DOMAIN, s.serviceName()))
+			case matches(q, name, s.serviceName(), dnsmessage.TypePTR):
+				answers = append(answers, ptr(s.serviceName(), s.instanceName()))
+				additionals = append(additionals, s.records()...)
+			case matches(q, name, s.instanceName(), dnsmessage.TypeSRV), matches(q, name, s.instanceName(), dnsmessage.TypeTXT):
+				answers = append(answers, s.records()...)
+			}
+		}
+	}
+	if len(answers) == 0 {
+		return nil, nil
+	}
+	response := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	if unicast {
+		response.Header.ID = header.ID
+		response.Questions = questions
+	}
+	return response.Pack()
+}
+
+func matches(q dnsmessage.Question, name, want string, typ dnsmessage.Type) bool {
+	return strings.EqualFold(name, want) && (q.Type == typ || q.Type == dnsmessage.TypeALL)
+}
+
+func ptr(name, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: header(name, dnsmessage.TypePTR),
+		Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(target)},
+	}
+}
+
+func header(name string, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  typ,
+		Class: dnsmessage.ClassINET,
+		TTL:   TTL,
+	}
+}
+
+// records returns the SRV, TXT and A records of the service
+func (s *Service) records() []dnsmessage.Resource {
+	txt := s.Txt
+	if len(txt) == 0 {
+		// a TXT record can't be empty
+		txt = []string{""}
+	}
+	records := []dnsmessage.Resource{
+		{
+			Header: header(s.instanceName(), dnsmessage.TypeSRV),
+			Body:   &dnsmessage.SRVResource{Port: s.Port, Target: dnsmessage.MustNewName(s.hostName())},
+		},
+		{
+			Header: header(s.instanceName(), dnsmessage.TypeTXT),
+			Body:   &dnsmessage.TXTResource{TXT: txt},
+		},
+	}
+	for _, ip := range s.IPs {
+		if ip4 := ip.To4(); ip4 != nil {
+			records = append(records, dnsmessage.Resource{
+				Header: header(s.hostName(), dnsmessage.TypeA),
+				Body:   &dnsmessage.AResource{A: [4]byte(ip4)},
+			})
+		}
+	}
+	return records
+}
+
+// Browse queries the network for instances of service ("_goje._tcp"), and
+// returns the ones that answer within timeout
+func Browse(ctx context.Context, service string, timeout time.Duration) ([]Service, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	packed, err := newQuery(service)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	if ctx_deadline, ok := ctx.Deadline(); ok && ctx_deadline.Before(deadline) {
+		deadline = ctx_deadline
+	}
+	conn.SetReadDeadline(deadline)
+	// queries are sent twice, in case the first one is lost
+	go func() {
+		for range 2 {
+			conn.WriteToUDP(packed, &net.UDPAddr{IP: group, Port: PORT})
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-time.After(timeout / 3):
+			}
+		}
+	}()
+
+	found := map[string]*Service{}
+	var order []string
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		for _, s := range parseResponse(buf[:n], service+"."+DOMAIN) {
+			if len(s.IPs) == 0 {
+				s.IPs = []net.IP{from.IP}
+			}
+			if _, ok := found[s.Instance]; !ok {
+				order = append(order, s.Instance)
+			}
+			found[s.Instance] = s
+		}
+	}
+	services := make([]Service, 0, len(order))
+	for _, instance := range order {
+		services = append(services, *found[instance])
+	}
+	return services, nil
+}
+
+// newQuery returns a query for PTR records of service
+func newQuery(service string) ([]byte, error) {
+	name, err := dnsmessage.NewName(service + "." + DOMAIN)
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return query.Pack()
+}
+
+// parseResponse returns the instances of service in the response
+func parseResponse(response []byte, service string) []*Service {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(response); err != nil || !msg.Header.Response {
+		return nil
+	}
+	records := append(msg.Answers, msg.Additionals...)
+	instances := map[string]*Service{}
+	var order []string
+	for _, record := range records {
+		if body, ok := record.Body.(*dnsmessage.PTRResource); ok && strings.EqualFold(record.Header.Name.String(), service) {
+			name := body.PTR.String()
+			if _, ok := instances[name]; !ok {
+				order = append(order, name)
+			}
+			instances[name] = &Service{
+				Instance: strings.TrimSuffix(name, "."+service),
+				Service:  strings.TrimSuffix(service, "."+DOMAIN),
+			}
+		}
+	}
+	hosts := map[string][]net.IP{}
+	for _, record := range records {
+		name := strings.ToLower(record.Header.Name.String())
+		switch body := record.Body.(type) {
+		case *dnsmessage.AResource:
+			ip := net.IP(body.A[:])
+			if !slices.ContainsFunc(hosts[name], ip.Equal) {
+				hosts[name] = append(hosts[name], ip)
+			}
+		}
+	}
+	var services []*Service
+	for _, name := range order {
+		s := instances[name]
+		for _, record := range records {
+			if !strings.EqualFold(record.Header.Name.String(), name) {
+				continue
+			}
+			switch body := record.Body.(type) {
+			case *dnsmessage.SRVResource:
+				s.Port = body.Port
+				s.Host = strings.TrimSuffix(body.Target.String(), "."+DOMAIN)
+				s.IPs = hosts[strings.ToLower(body.Target.String())]
+			case *dnsmessage.TXTResource:
+				for _, pair := range body.TXT {
+					if pair != "" {
+						s.Txt = append(s.Txt, pair)
+					}
+				}
+			}
+		}
+		if s.Port != 0 {
+			services = append(services, s)
+		}
+	}
+	return services
+}
@@ -0,0 +1,81 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAnswer(t *testing.T) {
+	s := Service{
+		Instance: "goje on laptop.home",
+		Service:  "_goje._tcp",
+		Host:     "laptop",
+		Port:     7900,
+		IPs:      []net.IP{net.IPv4(192, 168, 1, 2)},
+		Txt:      []string{"version=v1", "group=team"},
+	}
+	r := &Responder{services: []Service{s}}
+	query, err := newQuery("_goje._tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := r.answer(query, true)
+	if err != nil || response == nil {
+		t.Fatalf("no answer for the service's query: %v", err)
+	}
+	services := parseResponse(response, "_goje._tcp."+DOMAIN)
+	if len(services) != 1 {
+		t.Fatalf("found %d services. expected 1", len(services))
+	}
+	got := services[0]
+	if got.Instance != "goje on laptop-home" || got.Port != 7900 || got.Address() != "192.168.1.2:7900" {
+		t.Fatalf("found service: %+v", got)
+	}
+	if group, _ := got.Value("group"); group != "team" {
+		t.Fatalf("group of TXT record is %q", group)
+	}
+
+	query, _ = newQuery("_other._tcp")
+	if response, _ := r.answer(query, true); response != nil {
+		t.Fatal("answered the query of another service")
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	r, err := NewResponder(Service{Instance: "test", Service: "_goje-test._tcp", Port: 7900})
+	if err != nil {
+		t.Skip("can't join the multicast group:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+	services, err := Browse(ctx, "_goje-test._tcp", 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) == 0 {
+		t.Skip("no multicast on this network")
+	}
+	if services[0].Instance != "test" || services[0].Port != 7900 {
+		t.Fatalf("found service: %+v", services[0])
+	}
+}
+
+func TestListen(t *testing.T) {
+	var s Service
+	if err := s.Listen("127.0.0.1:7900"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Port != 7900 || s.Address() != "127.0.0.1:7900" {
+		t.Fatalf("service of a listening address: %+v", s)
+	}
+	s = Service{}
+	if err := s.Listen(":7800"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Port != 7800 || len(s.IPs) != 0 {
+		t.Fatalf("service listening on all interfaces: %+v", s)
+	}
+}
@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// content type of the prometheus text exposition format
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+type Label struct {
+	Name, Value string
+}
+
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+type metric struct {
+	name, help, typ string
+	collect         func() []Sample
+}
+
+// Registry holds metrics and writes them in the prometheus text exposition
+// format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(name, help, typ string, collect func() []Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, metric{name, help, typ, collect})
+}
+
+// GaugeFunc registers a gauge that its value is read from f on each scrape
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(name, help, "gauge", func() []Sample {
+		return []Sample{{Value: f()}}
+	})
+}
+
+// GaugeVecFunc registers a gauge that its samples are read from f on each
+// scrape
+func (r *Registry) GaugeVecFunc(name, help string, f func() []Sample) {
+	r.register(name, help, "gauge", f)
+}
+
+// Counter registers and returns a counter with the given label names
+func (r *Registry) Counter(name, help string, label_names ...string) *Counter {
+	c := &Counter{labelNames: label_names, values: map[string]*counterValue{}}
+	r.register(name, help, "counter", c.collect)
+	return c
+}
+
+type counterValue struct {
+	labels []Label
+	value  float64
+}
+
+type Counter struct {
+	labelNames []string
+	mu         sync.Mutex
+	values     map[string]*counterValue
+}
+
+// Inc increments the counter with the label values, in the order of the
+// counter's label names
+func (c *Counter) Inc(label_values ...string) {
+	if len(label_values) != len(c.labelNames) {
+		panic(fmt.Sprintf("counter expects %d label values, got %d", len(c.labelNames), len(label_values)))
+	}
+	key := strings.Join(label_values, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	if !ok {
+		value = &counterValue{labels: make([]Label, len(label_values))}
+		for i, name := range c.labelNames {
+			value.labels[i] = Label{name, label_values[i]}
+		}
+		c.values[key] = value
+	}
+	value.value++
+}
+
+func (c *Counter) collect() []Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, Sample{c.values[key].labels, c.values[key].value})
+	}
+	// counters without labels are exposed as zero before their first increment
+	if len(samples) == 0 && len(c.labelNames) == 0 {
+		samples = append(samples, Sample{})
+	}
+	return samples
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// WriteTo writes all the metrics in the prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", m.name, helpEscaper.Replace(m.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", m.name, m.typ)
+		for _, sample := range m.collect() {
+			b.WriteString(m.name)
+			if len(sample.Labels) != 0 {
+				b.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i != 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", label.Name, labelEscaper.Replace(label.Value))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(formatValue(sample.Value))
+			b.WriteByte('\n')
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
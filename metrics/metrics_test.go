@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.GaugeFunc("goje_test_gauge", "a test gauge", func() float64 { return 1.5 })
+	counter := r.Counter("goje_test_total", "a test counter", "mode")
+	counter.Inc("pomodoro")
+	counter.Inc("pomodoro")
+	counter.Inc(`short "break"`)
+	r.Counter("goje_test_unlabeled_total", "a counter without labels")
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP goje_test_gauge a test gauge
+# TYPE goje_test_gauge gauge
+goje_test_gauge 1.5
+# HELP goje_test_total a test counter
+# TYPE goje_test_total counter
+goje_test_total{mode="pomodoro"} 2
+goje_test_total{mode="short \"break\""} 1
+# HELP goje_test_unlabeled_total a counter without labels
+# TYPE goje_test_unlabeled_total counter
+goje_test_unlabeled_total 0
+`
+	if b.String() != expected {
+		t.Fatalf("unexpected output:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestTimerMetrics(t *testing.T) {
+	config := timer.DefaultConfig
+	config.DurationPerTick = time.Millisecond
+	pt := timer.PomodoroTimer{Config: &config}
+	pt.Init()
+	r := NewRegistry()
+	AddTimerMetrics(r, &pt)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// scrapes run while the timer ticks
+	go pt.Loop(ctx)
+	time.Sleep(10 * time.Millisecond)
+	var b strings.Builder
+	for range 5 {
+		r.WriteTo(&b)
+		time.Sleep(time.Millisecond)
+	}
+	pt.State.Mu.Lock()
+	pt.Pause(true)
+	pt.State.Mu.Unlock()
+	b.Reset()
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"goje_paused 1\n", "goje_pauses_total 1\n", `goje_mode{mode="pomodoro"} 1`} {
+		if !strings.Contains(b.String(), line) {
+			t.Fatalf("%q isn't in the metrics:\n%s", line, b.String())
+		}
+	}
+}
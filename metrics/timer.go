@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// locked returns f's result, read under the lock of the timer's state, as the
+// scrapes run out of the timer's loop
+func locked[T any](pt *timer.PomodoroTimer, f func() T) func() T {
+	return func() T {
+		pt.State.Mu.Lock()
+		defer pt.State.Mu.Unlock()
+		return f()
+	}
+}
+
+// AddTimerMetrics registers gauges of the timer's state, and counters that
+// are incremented by the timer's hooks
+func AddTimerMetrics(r *Registry, pt *timer.PomodoroTimer) {
+	r.GaugeVecFunc("goje_info", "information about goje", func() []Sample {
+		return []Sample{{Labels: []Label{{"version", timer.VERSION}}, Value: 1}}
+	})
+	r.GaugeFunc("goje_remaining_seconds", "remaining duration of the current mode", locked(pt, func() float64 {
+		return pt.State.Duration.Seconds()
+	}))
+	r.GaugeVecFunc("goje_mode", "current mode of the timer (1 for the current mode, 0 for others)", locked(pt, func() []Sample {
+		samples := make([]Sample, 0, timer.MODE_MAX)
+		for mode := range timer.MODE_MAX {
+			samples = append(samples, Sample{
+				Labels: []Label{{"mode", mode.SnakeCase()}},
+				Value:  boolValue(pt.State.Mode == mode),
+			})
+		}
+		return samples
+	}))
+	r.GaugeFunc("goje_paused", "whether the timer is paused", locked(pt, func() float64 {
+		return boolValue(pt.State.Paused)
+	}))
+	r.GaugeFunc("goje_finished_sessions", "finished sessions toward the next long break", locked(pt, func() float64 {
+		return float64(pt.State.FinishedSessions)
+	}))
+	r.GaugeFunc("goje_daily_pomodoros", "pomodoros finished today", locked(pt, func() float64 {
+		return float64(pt.State.Daily.Pomodoros)
+	}))
+	r.GaugeFunc("goje_daily_focus_seconds", "time spent in pomodoros today", locked(pt, func() float64 {
+		return pt.State.Daily.Focus.Seconds()
+	}))
+
+	completed := r.Counter("goje_modes_completed_total", "modes that reached their end", "mode")
+	skips := r.Counter("goje_skips_total", "modes skipped by user")
+	resets := r.Counter("goje_resets_total", "modes reset by user")
+	pauses := r.Counter("goje_pauses_total", "times that the timer is paused")
+	pt.Config.Hooks.OnModeEnd.Append(func(pt *timer.PomodoroTimer) {
+		completed.Inc(pt.State.Mode.SnakeCase())
+	})
+	pt.Config.Hooks.OnSkip.Append(func(pt *timer.PomodoroTimer) {
+		skips.Inc()
+	})
+	pt.Config.Hooks.OnReset.Append(func(pt *timer.PomodoroTimer) {
+		resets.Inc()
+	})
+	// runs under the lock of the timer's state, that it reads
+	pt.Config.Hooks.OnPause.AppendSync(func(pt *timer.PomodoroTimer) {
+		if pt.State.Paused {
+			pauses.Inc()
+		}
+	})
+}
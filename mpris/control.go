@@ -0,0 +1,255 @@
+package mpris
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// prefix of the bus names of mpris players
+const BUS_PREFIX = "org.mpris.MediaPlayer2."
+
+// players of goje itself, that are never controlled
+const GOJE_NAME = BUS_PREFIX + "goje"
+
+// actions on the other players, when a mode starts
+const (
+	// pauses the players that are playing
+	ActionPause = "pause"
+	// plays the players that goje has paused
+	ActionPlay = "play"
+	// lowers the volume of the players to the lowered volume. its restored
+	// when a mode with another action starts
+	ActionLower = "lower"
+	// leaves the players as they are
+	ActionNone = "none"
+)
+
+var Actions = []string{ActionPause, ActionPlay, ActionLower, ActionNone}
+
+const DEFAULT_LOWERED_VOLUME = 0.3
+
+type ControllerOpts struct {
+	// connection to the session bus. dbus.SessionBus() if nil
+	Conn *dbus.Conn
+	// actions of the pomodoros and the breaks. ActionNone if empty
+	OnPomodoro, OnBreak string
+	// fraction of the volume that ActionLower lowers it to
+	LoweredVolume float64
+	// bus names of the players that are controlled, with or without BUS_PREFIX.
+	// a name matches its instances too ("firefox" matches
+	// "org.mpris.MediaPlayer2.firefox.instance_1_2"). every player if empty
+	Include []string
+	// bus names of the players that aren't controlled, as in Include
+	Exclude []string
+}
+
+// Controller pauses, plays or lowers the volume of the other mpris players on
+// the bus, when a pomodoro or a break starts
+type Controller struct {
+	dbus *dbus.Conn
+	opts ControllerOpts
+	mu   sync.Mutex
+	// players that goje has paused
+	paused []string
+	// volumes of the players that goje has lowered, before they were lowered
+	volumes map[string]float64
+}
+
+func NewController(opts ControllerOpts) (c *Controller, err error) {
+	c = &Controller{dbus: opts.Conn, volumes: map[string]float64{}}
+	if err := c.SetOpts(opts); err != nil {
+		return nil, err
+	}
+	if c.dbus == nil {
+		if c.dbus, err = dbus.SessionBus(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// SetOpts changes the options of the controller, on a reload of config. the
+// players that it has paused or lowered are kept, so the next actions restore
+// them. opts.Conn is ignored
+func (c *Controller) SetOpts(opts ControllerOpts) error {
+	for _, action := range []*string{&opts.OnPomodoro, &opts.OnBreak} {
+		if *action == "" {
+			*action = ActionNone
+		}
+		if !slices.Contains(Actions, *action) {
+			return fmt.Errorf("invalid mpris action %q. expected one of %s", *action, strings.Join(Actions, ", "))
+		}
+	}
+	if opts.LoweredVolume == 0 {
+		opts.LoweredVolume = DEFAULT_LOWERED_VOLUME
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts = opts
+	return nil
+}
+
+// matches reports whether name (with or without BUS_PREFIX) is name or one of
+// its instances
+func matches(names []string, name string) bool {
+	return slices.ContainsFunc(names, func(n string) bool {
+		n = BUS_PREFIX + strings.TrimPrefix(n, BUS_PREFIX)
+		return name == n || strings.HasPrefix(name, n+".")
+	})
+}
+
+// Players returns the bus names of the players that are controlled
+func (c *Controller) Players() ([]string, error) {
+	var names []string
+	if err := c.dbus.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil, err
+	}
+	var players []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, BUS_PREFIX) || matches([]string{GOJE_NAME}, name) {
+			continue
+		}
+		if len(c.opts.Include) != 0 && !matches(c.opts.Include, name) {
+			continue
+		}
+		if matches(c.opts.Exclude, name) {
+			continue
+		}
+		players = append(players, name)
+	}
+	slices.Sort(players)
+	return players, nil
+}
+
+func (c *Controller) player(name string) dbus.BusObject {
+	return c.dbus.Object(name, "/org/mpris/MediaPlayer2")
+}
+
+// Apply runs action on the players. volumes that goje has lowered are restored
+// by the actions other than ActionLower
+func (c *Controller) Apply(action string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	players, err := c.Players()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if action != ActionLower {
+		errs = append(errs, c.restoreVolumes())
+	}
+	for _, name := range players {
+		switch action {
+		case ActionPause:
+			errs = append(errs, c.pause(name))
+		case ActionPlay:
+			errs = append(errs, c.play(name))
+		case ActionLower:
+			errs = append(errs, c.lower(name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Controller) pause(name string) error {
+	player := c.player(name)
+	status, err := player.GetProperty("org.mpris.MediaPlayer2.Player.PlaybackStatus")
+	if err != nil {
+		return err
+	}
+	if status.Value() != string(PlaybackStatusPlaying) {
+		return nil
+	}
+	if err := player.Call("org.mpris.MediaPlayer2.Player.Pause", 0).Err; err != nil {
+		return err
+	}
+	slog.Info("paused mpris player", "name", name)
+	if !slices.Contains(c.paused, name) {
+		c.paused = append(c.paused, name)
+	}
+	return nil
+}
+
+// play plays the player if goje has paused it
+func (c *Controller) play(name string) error {
+	i := slices.Index(c.paused, name)
+	if i == -1 {
+		return nil
+	}
+	c.paused = slices.Delete(c.paused, i, i+1)
+	if err := c.player(name).Call("org.mpris.MediaPlayer2.Player.Play", 0).Err; err != nil {
+		return err
+	}
+	slog.Info("played mpris player", "name", name)
+	return nil
+}
+
+func (c *Controller) lower(name string) error {
+	if _, ok := c.volumes[name]; ok {
+		return nil
+	}
+	player := c.player(name)
+	variant, err := player.GetProperty("org.mpris.MediaPlayer2.Player.Volume")
+	if err != nil {
+		return err
+	}
+	volume, ok := variant.Value().(float64)
+	if !ok {
+		return fmt.Errorf("volume of %s isn't a double: %s", name, variant.Signature())
+	}
+	lowered := volume * c.opts.LoweredVolume
+	if err := player.SetProperty("org.mpris.MediaPlayer2.Player.Volume", dbus.MakeVariant(lowered)); err != nil {
+		return err
+	}
+	slog.Info("lowered volume of mpris player", "name", name, "from", volume, "to", lowered)
+	c.volumes[name] = volume
+	return nil
+}
+
+// restoreVolumes restores the volumes that goje has lowered. c.mu should be
+// held
+func (c *Controller) restoreVolumes() error {
+	var errs []error
+	for name, volume := range c.volumes {
+		// players that are gone are forgotten too
+		delete(c.volumes, name)
+		if err := c.player(name).SetProperty("org.mpris.MediaPlayer2.Player.Volume", dbus.MakeVariant(volume)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Info("restored volume of mpris player", "name", name, "to", volume)
+	}
+	return errors.Join(errs...)
+}
+
+// Update runs the action of the timer's mode
+func (c *Controller) Update(pt *timer.PomodoroTimer) {
+	c.mu.Lock()
+	action := c.opts.OnBreak
+	if pt.State.Mode == timer.Pomodoro {
+		action = c.opts.OnPomodoro
+	}
+	c.mu.Unlock()
+	if err := c.Apply(action); err != nil {
+		slog.Error("controlling mpris players failed", "action", action, "err", err)
+	}
+}
+
+func (c *Controller) AddEventWatchers(config *timer.TimerConfig) {
+	config.Hooks.OnModeStart.Append(c.Update)
+	config.Hooks.OnQuit.Append(func(pt *timer.PomodoroTimer) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err := c.restoreVolumes(); err != nil {
+			slog.Error("restoring volumes of mpris players failed", "err", err)
+		}
+	})
+}
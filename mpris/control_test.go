@@ -0,0 +1,221 @@
+package mpris
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`
+
+// privateBus runs a dbus-daemon for the test, and returns its address
+func privateBus(t *testing.T) string {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon isn't available")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	content := fmt.Sprintf(busConfig, filepath.Join(dir, "bus"))
+	if err := os.WriteFile(config, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skip("running dbus-daemon failed:", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// fakePlayer is an mpris player with only its playback status and volume
+type fakePlayer struct {
+	props *prop.Properties
+}
+
+func (p *fakePlayer) Play() *dbus.Error {
+	p.props.SetMust("org.mpris.MediaPlayer2.Player", "PlaybackStatus", string(PlaybackStatusPlaying))
+	return nil
+}
+
+func (p *fakePlayer) Pause() *dbus.Error {
+	p.props.SetMust("org.mpris.MediaPlayer2.Player", "PlaybackStatus", string(PlaybackStatusPaused))
+	return nil
+}
+
+func (p *fakePlayer) status() string {
+	return p.props.GetMust("org.mpris.MediaPlayer2.Player", "PlaybackStatus").(string)
+}
+
+func (p *fakePlayer) volume() float64 {
+	return p.props.GetMust("org.mpris.MediaPlayer2.Player", "Volume").(float64)
+}
+
+func newFakePlayer(t *testing.T, address, name string, status PlaybackStatus) *fakePlayer {
+	conn := connect(t, address)
+	p := &fakePlayer{}
+	var err error
+	p.props, err = prop.Export(conn, "/org/mpris/MediaPlayer2", map[string]map[string]*prop.Prop{
+		"org.mpris.MediaPlayer2.Player": {
+			"PlaybackStatus": newProp(string(status), nil),
+			"Volume":         newProp(1.0, nil),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(p, "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player"); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("requesting %s failed: %v", name, err)
+	}
+	return p
+}
+
+func TestController(t *testing.T) {
+	address := privateBus(t)
+	podcast := newFakePlayer(t, address, BUS_PREFIX+"podcast", PlaybackStatusPlaying)
+	music := newFakePlayer(t, address, BUS_PREFIX+"music.instance2", PlaybackStatusPaused)
+	browser := newFakePlayer(t, address, BUS_PREFIX+"browser", PlaybackStatusPlaying)
+	goje := newFakePlayer(t, address, GOJE_NAME+".instance1", PlaybackStatusPlaying)
+
+	c, err := NewController(ControllerOpts{
+		Conn:       connect(t, address),
+		OnPomodoro: ActionPause,
+		OnBreak:    ActionPlay,
+		Exclude:    []string{"browser"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	players, err := c.Players()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{BUS_PREFIX + "music.instance2", BUS_PREFIX + "podcast"}; !slices.Equal(players, expected) {
+		t.Fatalf("players are %q, expected %q", players, expected)
+	}
+
+	pt := &timer.PomodoroTimer{Config: &timer.TimerConfig{}}
+	pt.State.Mode = timer.Pomodoro
+	c.Update(pt)
+	if podcast.status() != string(PlaybackStatusPaused) {
+		t.Fatal("podcast isn't paused on pomodoro")
+	}
+	if browser.status() != string(PlaybackStatusPlaying) || goje.status() != string(PlaybackStatusPlaying) {
+		t.Fatal("excluded players are paused")
+	}
+	pt.State.Mode = timer.ShortBreak
+	c.Update(pt)
+	if podcast.status() != string(PlaybackStatusPlaying) {
+		t.Fatal("podcast isn't played on break")
+	}
+	// only players that goje has paused are played
+	if music.status() != string(PlaybackStatusPaused) {
+		t.Fatal("music that was paused before is played")
+	}
+}
+
+func TestControllerLower(t *testing.T) {
+	address := privateBus(t)
+	podcast := newFakePlayer(t, address, BUS_PREFIX+"podcast", PlaybackStatusPlaying)
+	music := newFakePlayer(t, address, BUS_PREFIX+"music", PlaybackStatusPlaying)
+
+	c, err := NewController(ControllerOpts{
+		Conn:          connect(t, address),
+		OnPomodoro:    ActionLower,
+		LoweredVolume: 0.5,
+		Include:       []string{BUS_PREFIX + "music"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// lowering twice doesn't lower the lowered volume
+	for range 2 {
+		if err := c.Apply(ActionLower); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if music.volume() != 0.5 || podcast.volume() != 1 {
+		t.Fatalf("volumes are %v and %v after lowering", music.volume(), podcast.volume())
+	}
+	if err := c.Apply(ActionNone); err != nil {
+		t.Fatal(err)
+	}
+	if music.volume() != 1 {
+		t.Fatalf("volume is %v after restoring", music.volume())
+	}
+}
+
+func TestControllerSetOpts(t *testing.T) {
+	address := privateBus(t)
+	podcast := newFakePlayer(t, address, BUS_PREFIX+"podcast", PlaybackStatusPlaying)
+	c, err := NewController(ControllerOpts{Conn: connect(t, address), OnPomodoro: ActionPause})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := &timer.PomodoroTimer{Config: &timer.TimerConfig{}}
+	c.Update(pt)
+	if podcast.status() != string(PlaybackStatusPaused) {
+		t.Fatal("podcast isn't paused on pomodoro")
+	}
+	// as on a reload of config. the paused players aren't forgotten
+	if err := c.SetOpts(ControllerOpts{OnPomodoro: ActionPause, OnBreak: ActionPlay}); err != nil {
+		t.Fatal(err)
+	}
+	pt.State.Mode = timer.ShortBreak
+	c.Update(pt)
+	if podcast.status() != string(PlaybackStatusPlaying) {
+		t.Fatal("podcast that was paused before the reload isn't played")
+	}
+	if err := c.SetOpts(ControllerOpts{OnPomodoro: "stop"}); err == nil {
+		t.Fatal("invalid action is accepted")
+	}
+}
+
+func TestControllerInvalid(t *testing.T) {
+	if _, err := NewController(ControllerOpts{OnPomodoro: "stop"}); err == nil {
+		t.Fatal("invalid action is accepted")
+	}
+}
@@ -92,9 +92,29 @@ func MapFromTimer(pt *timer.PomodoroTimer) MetadataMap {
 		"mpris:trackid": dbus.ObjectPath(fmt.Sprintf("/org/goje/Mode/%d", pt.State.Mode)),
 		"mpris:length":  pt.State.Duration / time.Microsecond,
 		"xesam:title":   pt.State.Mode.String(),
+		"xesam:album":   DailyProgressString(pt),
 	}
 }
 
+// DailyProgressString returns the daily progress in a human readable way.
+// never empty, so its safe to put in MetadataMap
+func DailyProgressString(pt *timer.PomodoroTimer) string {
+	daily := pt.State.Daily
+	out := fmt.Sprintf("%d", daily.Pomodoros)
+	if pt.Config.GoalPomodoros != 0 {
+		out += fmt.Sprintf("/%d", pt.Config.GoalPomodoros)
+	}
+	out += " pomodoros today, " + daily.Focus.Round(time.Minute).String()
+	if pt.Config.GoalFocus != 0 {
+		out += "/" + pt.Config.GoalFocus.String()
+	}
+	out += " focus"
+	if daily.Streak != 0 {
+		out += fmt.Sprintf(", %d day streak", daily.Streak)
+	}
+	return out
+}
+
 func notImplemented(c *prop.Change) *dbus.Error {
 	return dbus.MakeFailedError(errors.New("Not implemented"))
 }
@@ -0,0 +1,433 @@
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+	"github.com/r3labs/sse/v2"
+)
+
+const (
+	DEFAULT_MIN_BACKOFF = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 30 * time.Second
+	// the stream is considered dead if nothing (not even a keepalive) is read
+	// from it for this long
+	DEFAULT_IDLE_TIMEOUT = time.Minute
+)
+
+// Status is the state of connection to the outbound server
+type Status struct {
+	Address   string
+	Connected bool
+	// since when the client is (dis)connected
+	Since time.Time
+	// last error of the connection, or of sending a change
+	Error string `json:",omitempty"`
+	// count of the local changes that aren't sent to the server yet
+	Pending uint64
+	// count of failed attempts to connect since the last disconnect
+	Attempts uint
+}
+
+// Client keeps a timer in sync with an outbound goje server. it follows the
+// server's event stream, and sends the local changes of the timer to the
+// server. while the server isn't reachable the timer runs locally, and the
+// client reconnects with an exponential backoff. actions that are made while
+// disconnected are queued, and replayed on the server's timer on reconnect.
+// changes made before the first connection are discarded
+type Client struct {
+	Address string
+	Http    *http.Client
+	// runs the event hooks of the timer for events of the server
+	Timer *timer.PomodoroTimer
+	// runs (synchronously) on every change of status
+	OnStatus   func(Status)
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// zero disables detection of idle streams
+	IdleTimeout time.Duration
+	// display name that the client joins the server's session as a participant
+	// with. it doesn't join if empty
+	Name string
+
+	// local changes are sent to the server only while connected. its separate
+	// from mu, as its checked by the timer while holding State.Mu
+	connected atomic.Bool
+	mu        sync.Mutex
+	status    Status
+	// version of the server's timer, that the local timer is based on
+	serverVersion uint64
+	// true until the first event after a (re)connect is handled
+	reconnected bool
+	// last state of the timer that is known to the server, or is queued
+	last    *snapshot
+	queue   []action
+	changed chan struct{}
+	backoff *backoff
+}
+
+func NewClient(address string, httpClient *http.Client, t *timer.PomodoroTimer) *Client {
+	return &Client{
+		Address:     address,
+		Http:        httpClient,
+		Timer:       t,
+		MinBackoff:  DEFAULT_MIN_BACKOFF,
+		MaxBackoff:  DEFAULT_MAX_BACKOFF,
+		IdleTimeout: DEFAULT_IDLE_TIMEOUT,
+		// a buffered channel of size 1, so changes coalesce
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// AddEventWatchers sends the local changes of the timer to the server while
+// connected, and queues them while disconnected. call it on every (re)load of
+// config
+func (c *Client) AddEventWatchers(config *timer.TimerConfig) {
+	config.Hooks.OnSet.Enabled = c.connected.Load
+	config.Hooks.OnSet.Append(func(*timer.PomodoroTimer) { c.wake() })
+	config.Hooks.OnChange.Append(c.record)
+	config.Hooks.OnPause.Append(c.record)
+}
+
+// wakes the sender up
+func (c *Client) wake() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the current status of connection
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statusLocked()
+}
+
+func (c *Client) statusLocked() Status {
+	status := c.status
+	status.Address = c.Address
+	status.Pending = uint64(len(c.queue))
+	c.Timer.State.Mu.Lock()
+	version := c.Timer.State.Version
+	c.Timer.State.Mu.Unlock()
+	if status.Connected && version > c.serverVersion {
+		status.Pending += version - c.serverVersion
+	}
+	return status
+}
+
+// setStatus changes the status with fn, and runs OnStatus
+func (c *Client) setStatus(fn func(*Status)) {
+	c.mu.Lock()
+	fn(&c.status)
+	c.connected.Store(c.status.Connected)
+	status := c.statusLocked()
+	c.mu.Unlock()
+	if c.OnStatus != nil {
+		c.OnStatus(status)
+	}
+}
+
+// Run follows the server's stream and sends the local changes until ctx is
+// done. the timer runs locally until the first connection
+func (c *Client) Run(ctx context.Context) {
+	c.backoff = &backoff{ctx: ctx, min: c.MinBackoff, max: c.MaxBackoff}
+	c.setStatus(func(s *Status) { s.Since = time.Now() })
+	go c.sender(ctx)
+
+	stream_address := c.Address + "/api/timer/stream"
+	if c.Name != "" {
+		stream_address += "?" + url.Values{"participant": {c.Name}, "name": {c.Name}}.Encode()
+	}
+	stream := sse.NewClient(stream_address)
+	stream.Connection = c.streamHttpClient()
+	stream.ReconnectStrategy = c.backoff
+	stream.OnConnect(func(*sse.Client) {
+		c.backoff.Reset()
+		c.mu.Lock()
+		c.reconnected = true
+		c.mu.Unlock()
+	})
+	stream.OnDisconnect(func(*sse.Client) {
+		c.disconnected(fmt.Errorf("stream is disconnected"))
+	})
+	stream.ReconnectNotify = func(err error, next time.Duration) {
+		slog.Warn("outbound server isn't reachable. reconnecting", "err", err, "in", next)
+		c.disconnected(err)
+		c.setStatus(func(s *Status) { s.Attempts++ })
+	}
+	// the stream client resumes from the last event's id when reconnecting, so
+	// missed events are replayed
+	if err := stream.SubscribeRawWithContext(ctx, c.handleEvent); err != nil && ctx.Err() == nil {
+		slog.Error("subscribing to the outbound server failed", "err", err)
+	}
+}
+
+// disconnected makes the timer run locally. its changes are queued
+func (c *Client) disconnected(err error) {
+	if c.connected.Load() {
+		slog.Warn("disconnected from the outbound server. running the timer locally", "err", err)
+	}
+	c.setStatus(func(s *Status) {
+		if s.Connected {
+			s.Since = time.Now()
+			s.Attempts = 0
+		}
+		s.Connected = false
+		s.Error = err.Error()
+	})
+}
+
+func (c *Client) handleEvent(msg *sse.Event) {
+	c.mu.Lock()
+	reconnected := c.reconnected
+	c.reconnected = false
+	queued := len(c.queue)
+	c.mu.Unlock()
+	if reconnected {
+		slog.Info("connected to the outbound server", "address", c.Address)
+		c.setStatus(func(s *Status) {
+			s.Connected = true
+			s.Since = time.Now()
+			s.Error = ""
+			s.Attempts = 0
+		})
+		if queued != 0 {
+			slog.Info("replaying the local actions on the outbound server", "count", queued)
+			c.wake()
+		}
+	}
+	switch string(msg.Event) {
+	case "change", "start", "end", "pause", "goal":
+	default:
+		// actions, proposals and the like don't carry the timer
+		return
+	}
+	var event struct {
+		State struct{ Version uint64 }
+	}
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		slog.Warn("invalid event from the outbound server", "err", err)
+		return
+	}
+	c.mu.Lock()
+	c.Timer.State.Mu.Lock()
+	defer c.Timer.State.Mu.Unlock()
+	json.Unmarshal(msg.Data, c.Timer)
+	last := snapshotOf(c.Timer)
+	c.serverVersion = event.State.Version
+	c.last = &last
+	c.mu.Unlock()
+	hooks := &c.Timer.Config.Hooks
+	switch string(msg.Event) {
+	case "change":
+		hooks.OnChange.Run(c.Timer)
+	case "end":
+		hooks.OnModeEnd.RunSync(c.Timer)
+	case "start":
+		hooks.OnModeStart.RunSync(c.Timer)
+	case "pause":
+		hooks.OnPause.Run(c.Timer)
+	case "goal":
+		hooks.OnGoalReached.Run(c.Timer)
+	}
+}
+
+// sender sends the queued actions, and the timer after local changes, to the
+// server. changes that are made while a request is in flight are coalesced,
+// and sent in the next request
+func (c *Client) sender(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.changed:
+		}
+		if !c.connected.Load() {
+			// sent on reconnect
+			continue
+		}
+		if err := c.replay(); err != nil {
+			slog.Error("replaying the local actions on the outbound server failed", "err", err)
+			c.setStatus(func(s *Status) { s.Error = err.Error() })
+			continue
+		}
+		if err := c.send(); err != nil {
+			slog.Error("sending the change to the outbound server failed", "err", err)
+			c.setStatus(func(s *Status) { s.Error = err.Error() })
+		}
+	}
+}
+
+// send patches the server's timer with the local timer, if the server's timer
+// hasn't changed since. otherwise the server's timer is applied locally
+func (c *Client) send() error {
+	c.mu.Lock()
+	version := c.serverVersion
+	c.mu.Unlock()
+	c.Timer.State.Mu.Lock()
+	content, _ := json.Marshal(c.Timer)
+	local_changes := c.Timer.State.Version != version
+	c.Timer.State.Mu.Unlock()
+	if !local_changes {
+		return nil
+	}
+	resp, err := c.patch("/api/timer", content, version)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var server timer.PomodoroTimer
+		if err := json.NewDecoder(resp.Body).Decode(&server); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.serverVersion = server.State.Version
+		c.Timer.State.Mu.Lock()
+		c.Timer.State.Version = server.State.Version
+		last := snapshotOf(c.Timer)
+		c.Timer.State.Mu.Unlock()
+		c.last = &last
+		c.mu.Unlock()
+		c.setStatus(func(s *Status) { s.Error = "" })
+		return nil
+	case http.StatusAccepted:
+		// the change is proposed to the participants, and applied when they
+		// approve it
+		slog.Info("outbound server requires consensus. the change is proposed")
+		return c.pull()
+	case http.StatusConflict:
+		slog.Warn("outbound server's timer has changed concurrently. discarding the local change")
+		return c.pull()
+	default:
+		return fmt.Errorf("outbound server rejected the change: %s", resp.Status)
+	}
+}
+
+// patch sends content as a PATCH request to path of the server. the request
+// is conditional on version, if its not zero
+func (c *Client) patch(path string, content []byte, version uint64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPatch, c.Address+path, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if version != 0 {
+		req.Header.Set("If-Match", fmt.Sprintf(`"%d"`, version))
+	}
+	if c.Name != "" {
+		req.Header.Set("X-Goje-Participant", c.Name)
+	}
+	return c.Http.Do(req)
+}
+
+// pull gets the server's timer, and applies it locally
+func (c *Client) pull() error {
+	resp, err := c.Http.Get(c.Address + "/api/timer")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("getting timer failed: %s", resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.Timer.State.Mu.Lock()
+	err = json.Unmarshal(content, c.Timer)
+	last := snapshotOf(c.Timer)
+	c.Timer.State.Mu.Unlock()
+	if err == nil {
+		c.serverVersion = last.Version
+		c.last = &last
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	c.Timer.State.Mu.Lock()
+	defer c.Timer.State.Mu.Unlock()
+	c.Timer.Config.Hooks.OnChange.Run(c.Timer)
+	return nil
+}
+
+// streamHttpClient returns a copy of c.Http, whose connections fail when
+// nothing is read from them for c.IdleTimeout
+func (c *Client) streamHttpClient() *http.Client {
+	transport, ok := c.Http.Transport.(*http.Transport)
+	if c.Http.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok || c.IdleTimeout == 0 {
+		return c.Http
+	}
+	transport = transport.Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &idleConn{Conn: conn, timeout: c.IdleTimeout}, nil
+	}
+	client := *c.Http
+	client.Transport = transport
+	return &client
+}
+
+// idleConn is a connection that its reads time out after being idle
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (conn *idleConn) Read(b []byte) (int, error) {
+	conn.SetReadDeadline(time.Now().Add(conn.timeout))
+	return conn.Conn.Read(b)
+}
+
+// backoff is an exponential backoff, that only gives up when ctx is done
+type backoff struct {
+	ctx      context.Context
+	mu       sync.Mutex
+	min, max time.Duration
+	next     time.Duration
+}
+
+func (b *backoff) NextBackOff() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ctx.Err() != nil {
+		// stops retrying
+		return -1
+	}
+	if b.next == 0 {
+		b.next = b.min
+	}
+	current := b.next
+	b.next = min(b.next*2, b.max)
+	return current
+}
+
+func (b *backoff) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next = 0
+}
@@ -0,0 +1,216 @@
+package outbound_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/outbound"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// server is an outbound goje server, that can be stopped and started again on
+// the same address
+type server struct {
+	daemon  *httpd.Daemon
+	address string
+	http    *http.Server
+}
+
+func newServer(t *testing.T) *server {
+	config := timer.DefaultConfig
+	s := &server{daemon: &httpd.Daemon{
+		Timer: &timer.PomodoroTimer{Config: &config},
+		Hub:   httpd.NewHub(httpd.DEFAULT_QUEUE_SIZE, httpd.DEFAULT_REPLAY_SIZE),
+	}}
+	s.daemon.Timer.Init()
+	s.daemon.Init()
+	s.daemon.SetupEvents()
+	s.daemon.JsonRoutes()
+	s.daemon.V1Routes()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.address = listener.Addr().String()
+	s.serve(listener)
+	t.Cleanup(s.stop)
+	return s
+}
+
+func (s *server) serve(listener net.Listener) {
+	s.http = &http.Server{Handler: s.daemon.Handler()}
+	go s.http.Serve(listener)
+}
+
+func (s *server) stop() {
+	s.http.Close()
+}
+
+func (s *server) start(t *testing.T) {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.serve(listener)
+}
+
+func newClient(t *testing.T, address string) *outbound.Client {
+	config := timer.DefaultConfig
+	pt := &timer.PomodoroTimer{Config: &config}
+	pt.Init()
+	client := outbound.NewClient("http://"+address, &http.Client{}, pt)
+	client.AddEventWatchers(&config)
+	client.MinBackoff = 10 * time.Millisecond
+	client.MaxBackoff = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go client.Run(ctx)
+	return client
+}
+
+// get returns the server's timer through its api, as the timer isn't safe to
+// read while the server handles requests
+func (s *server) get(t *testing.T) (res httpd.TimerResponse) {
+	recorder := httptest.NewRecorder()
+	s.daemon.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/timer", nil))
+	if err := json.NewDecoder(recorder.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// patch changes the server's timer through its api. it works while the server
+// is stopped too
+func (s *server) patch(t *testing.T, body string) {
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/timer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	s.daemon.Handler().ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("patching server's timer: %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+// change changes the client's timer with fn, the way the client's inbound
+// servers do
+func change(client *outbound.Client, fn func(*timer.PomodoroTimer)) {
+	client.Timer.State.Mu.Lock()
+	defer client.Timer.State.Mu.Unlock()
+	fn(client.Timer)
+}
+
+func task(client *outbound.Client) string {
+	client.Timer.State.Mu.Lock()
+	defer client.Timer.State.Mu.Unlock()
+	return client.Timer.State.Task
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for range 200 {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestClientFollowsServer(t *testing.T) {
+	s := newServer(t)
+	client := newClient(t, s.address)
+	eventually(t, "connection", func() bool { return client.Status().Connected })
+
+	s.patch(t, `{"task": "server"}`)
+	eventually(t, "server's change", func() bool { return task(client) == "server" })
+
+	change(client, func(pt *timer.PomodoroTimer) {
+		pt.State.Task = "client"
+		pt.Changed()
+	})
+	eventually(t, "client's change", func() bool { return s.get(t).Task == "client" })
+}
+
+func TestClientIgnoresOtherEvents(t *testing.T) {
+	s := newServer(t)
+	client := newClient(t, s.address)
+	eventually(t, "connection", func() bool { return client.Status().Connected })
+
+	// action events don't carry the timer, nor its version
+	s.daemon.Participants.Record("alice", "skip", timer.Pomodoro)
+	time.Sleep(100 * time.Millisecond)
+	if pending := client.Status().Pending; pending != 0 {
+		t.Fatalf("%d changes are pending after an action event", pending)
+	}
+}
+
+func TestClientOffline(t *testing.T) {
+	s := newServer(t)
+	client := newClient(t, s.address)
+	eventually(t, "connection", func() bool { return client.Status().Connected })
+
+	s.stop()
+	eventually(t, "disconnection", func() bool { return !client.Status().Connected })
+	changed := make(chan struct{}, 1)
+	client.Timer.Config.Hooks.OnChange.Append(func(*timer.PomodoroTimer) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	change(client, func(pt *timer.PomodoroTimer) {
+		pt.State.Task = "offline"
+		pt.Changed()
+	})
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("local change hooks didn't run while offline")
+	}
+	eventually(t, "queued change", func() bool {
+		status := client.Status()
+		return status.Pending != 0 && status.Error != ""
+	})
+
+	s.start(t)
+	eventually(t, "offline change on server", func() bool { return s.get(t).Task == "offline" })
+	eventually(t, "no pending changes", func() bool { return client.Status().Pending == 0 })
+}
+
+func TestClientReplaysActions(t *testing.T) {
+	s := newServer(t)
+	client := newClient(t, s.address)
+	eventually(t, "connection", func() bool { return client.Status().Connected })
+
+	s.stop()
+	eventually(t, "disconnection", func() bool { return !client.Status().Connected })
+	change(client, func(pt *timer.PomodoroTimer) { pt.Pause(true) })
+	eventually(t, "queued pause", func() bool { return client.Status().Pending == 1 })
+	change(client, func(pt *timer.PomodoroTimer) {
+		pt.State.Task = "offline"
+		pt.Changed()
+	})
+	eventually(t, "queued task", func() bool { return client.Status().Pending == 2 })
+
+	// changes of the server meanwhile are kept, and the actions are applied on
+	// top of them
+	s.patch(t, `{"mode": "short_break"}`)
+	s.start(t)
+	eventually(t, "replayed actions", func() bool {
+		res := s.get(t)
+		return res.Task == "offline" && res.Paused && res.Mode == "short_break"
+	})
+	eventually(t, "no pending changes", func() bool { return client.Status().Pending == 0 })
+	eventually(t, "server's timer", func() bool {
+		client.Timer.State.Mu.Lock()
+		defer client.Timer.State.Mu.Unlock()
+		return client.Timer.State.Mode == timer.ShortBreak && client.Timer.State.Paused
+	})
+}
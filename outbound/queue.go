@@ -0,0 +1,131 @@
+package outbound
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// SEEK_TOLERANCE is how much the remaining duration of a local change can
+// differ from the ticked remaining duration of the previous change, without
+// being considered a seek
+const SEEK_TOLERANCE = 2 * time.Second
+
+// snapshot is the part of timer's state that local actions change
+type snapshot struct {
+	Mode             timer.PomodoroTimerMode
+	Duration         time.Duration
+	FinishedSessions uint
+	Paused           bool
+	Task             string
+	Version          uint64
+	// when the snapshot is taken
+	At time.Time
+}
+
+// snapshotOf returns the snapshot of pt. lock pt.State.Mu before calling it
+func snapshotOf(pt *timer.PomodoroTimer) snapshot {
+	return snapshot{
+		Mode:             pt.State.Mode,
+		Duration:         pt.State.Duration,
+		FinishedSessions: pt.State.FinishedSessions,
+		Paused:           pt.State.Paused,
+		Task:             pt.State.Task,
+		Version:          pt.State.Version,
+		At:               time.Now(),
+	}
+}
+
+// action is a local action, as a partial update of the server's timer (PATCH
+// /api/v1/timer)
+type action map[string]any
+
+// actionsTo returns the actions that change prev to next. a switch of mode or
+// a seek is an action of its own, as the server may need consensus for it
+func (prev *snapshot) actionsTo(next snapshot) (actions []action) {
+	expected := prev.Duration
+	if !prev.Paused {
+		expected -= next.At.Sub(prev.At)
+	}
+	others := action{}
+	if next.Mode != prev.Mode {
+		actions = append(actions, action{"mode": next.Mode.SnakeCase()})
+	} else {
+		if diff := next.Duration - expected; diff > SEEK_TOLERANCE || diff < -SEEK_TOLERANCE {
+			actions = append(actions, action{"remaining": next.Duration.String()})
+		}
+		if next.FinishedSessions != prev.FinishedSessions {
+			others["finished_sessions"] = next.FinishedSessions
+		}
+	}
+	if next.Paused != prev.Paused {
+		others["paused"] = next.Paused
+	}
+	if next.Task != prev.Task {
+		others["task"] = next.Task
+	}
+	if len(others) != 0 {
+		actions = append(actions, others)
+	}
+	return actions
+}
+
+// record queues the local change of pt as actions, while disconnected
+func (c *Client) record(pt *timer.PomodoroTimer) {
+	if c.connected.Load() {
+		return
+	}
+	pt.State.Mu.Lock()
+	next := snapshotOf(pt)
+	pt.State.Mu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// changes before the first connection, or of the server's events, aren't
+	// queued
+	if c.last == nil || next.Version <= c.last.Version {
+		return
+	}
+	c.queue = append(c.queue, c.last.actionsTo(next)...)
+	c.last = &next
+}
+
+// replay sends the queued actions to the server in order, and applies the
+// server's timer locally afterwards. actions that the server rejects are
+// discarded
+func (c *Client) replay() error {
+	c.mu.Lock()
+	queued := len(c.queue)
+	c.mu.Unlock()
+	if queued == 0 {
+		return nil
+	}
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.mu.Unlock()
+			return c.pull()
+		}
+		action := c.queue[0]
+		c.mu.Unlock()
+		content, _ := json.Marshal(action)
+		resp, err := c.patch("/api/v1/timer", content, 0)
+		if err != nil {
+			// stays queued, and is replayed on the next reconnect
+			return err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusAccepted:
+			slog.Info("outbound server requires consensus. the local action is proposed", "action", string(content))
+		default:
+			slog.Warn("outbound server rejected the local action. discarding it", "action", string(content), "status", resp.Status)
+		}
+		c.mu.Lock()
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+	}
+}
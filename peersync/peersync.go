@@ -0,0 +1,451 @@
+package peersync
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nimaaskarian/goje/mdns"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const (
+	DEFAULT_INTERVAL = 5 * time.Second
+	// dns-sd service type that sync groups are advertised as
+	SERVICE = "_goje-sync._tcp"
+	// discovered peers are forgotten after failing this many times in a row
+	MAX_FAILURES = 3
+)
+
+var ErrGroupMismatch = errors.New("peer is in another sync group")
+
+// Entry is the state of the shared timer. the entry with the greater logical
+// clock wins (last writer wins). ties are broken by the node ids
+type Entry struct {
+	// lamport clock of the change
+	Clock uint64
+	// id of the node that made the change
+	Node string
+	// wall time of the change. used for catching up with the time that has
+	// passed since, when the timer isn't paused
+	At               time.Time
+	Mode             timer.PomodoroTimerMode
+	Duration         time.Duration
+	Paused           bool
+	FinishedSessions uint
+	Sessions         uint
+	Task             string
+}
+
+// Newer reports whether e wins over other
+func (e Entry) Newer(other Entry) bool {
+	if e.Clock != other.Clock {
+		return e.Clock > other.Clock
+	}
+	return e.Node > other.Node
+}
+
+// Message is exchanged between peers, in both directions of a request
+type Message struct {
+	Node  string
+	Group string
+	// http address of the sender, for its peers to add. optional
+	Address string
+	Entry   Entry
+	// http addresses of the peers that the sender knows. members of the group
+	// learn about each other through these
+	Peers []string
+}
+
+// Peer is a member of the sync group
+type Peer struct {
+	// http address of the peer
+	Address string
+	Node    string
+	// peers from the config are never forgotten
+	Static   bool
+	LastSeen time.Time `json:",omitzero"`
+	Error    string    `json:",omitempty"`
+	failures int
+}
+
+// Syncer keeps a timer in sync with the other members of its sync group
+type Syncer struct {
+	Node  string
+	Group string
+	// http address that the peers can reach this node at. optional
+	Address string
+	// scheme of the addresses of discovered peers ("http" or "https")
+	Scheme   string
+	Timer    *timer.PomodoroTimer
+	Http     *http.Client
+	Interval time.Duration
+
+	mu    sync.Mutex
+	clock uint64
+	entry Entry
+	// version of the timer when it was last synced. a greater version means a
+	// local change
+	version uint64
+	// false until the first exchange with a peer. a joining node adopts the
+	// group's timer, instead of overwriting it with its own
+	joined bool
+	peers  map[string]*Peer
+	// addresses that turned out to be this node, or another address of a known
+	// peer. they aren't added as peers again
+	aliases map[string]bool
+}
+
+// NewNodeId returns a random node id
+func NewNodeId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func NewSyncer(node, group string, t *timer.PomodoroTimer, peers []string) *Syncer {
+	s := &Syncer{
+		Node:     node,
+		Group:    group,
+		Scheme:   "http",
+		Timer:    t,
+		Http:     &http.Client{Timeout: 5 * time.Second},
+		Interval: DEFAULT_INTERVAL,
+		peers:    map[string]*Peer{},
+		aliases:  map[string]bool{},
+	}
+	for _, address := range peers {
+		s.peers[address] = &Peer{Address: address, Static: true}
+	}
+	t.State.Mu.Lock()
+	s.version = t.State.Version
+	s.entry = s.entryOf(0)
+	t.State.Mu.Unlock()
+	return s
+}
+
+// entryOf returns the timer's current state as an entry. s.mu and
+// s.Timer.State.Mu should be held
+func (s *Syncer) entryOf(clock uint64) Entry {
+	return Entry{
+		Clock:            clock,
+		Node:             s.Node,
+		At:               time.Now(),
+		Mode:             s.Timer.State.Mode,
+		Duration:         s.Timer.State.Duration,
+		Paused:           s.Timer.State.Paused,
+		FinishedSessions: s.Timer.State.FinishedSessions,
+		Sessions:         s.Timer.Config.Sessions,
+		Task:             s.Timer.State.Task,
+	}
+}
+
+// AddEventWatchers watches the timer for local changes, to push them to peers
+func (s *Syncer) AddEventWatchers(config *timer.TimerConfig) {
+	watch := func(*timer.PomodoroTimer) {
+		if s.checkLocal() {
+			s.pushAll()
+		}
+	}
+	config.Hooks.OnChange.Append(watch)
+	config.Hooks.OnPause.Append(watch)
+	config.Hooks.OnModeStart.Append(watch)
+}
+
+// checkLocal makes a new entry if the timer has changed locally since it was
+// last synced
+func (s *Syncer) checkLocal() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Timer.State.Mu.Lock()
+	defer s.Timer.State.Mu.Unlock()
+	if s.Timer.State.Version == s.version {
+		return false
+	}
+	s.version = s.Timer.State.Version
+	s.clock++
+	s.entry = s.entryOf(s.clock)
+	return true
+}
+
+// merge applies entry on the timer if its newer than the current one. the
+// timer's loop ticks under its State.Mu, so it's held while applying
+func (s *Syncer) merge(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = max(s.clock, entry.Clock)
+	if !entry.Newer(s.entry) && (s.joined || entry.Clock == 0) {
+		s.joined = s.joined || entry.Clock != 0
+		return
+	}
+	s.joined = true
+	slog.Debug("applying entry of peer", "node", entry.Node, "clock", entry.Clock)
+	s.entry = entry
+	t := s.Timer
+	t.State.Mu.Lock()
+	defer t.State.Mu.Unlock()
+	if t.State.Mode != entry.Mode {
+		t.SetMode(entry.Mode)
+	}
+	if t.State.Paused != entry.Paused {
+		t.Pause(entry.Paused)
+	}
+	t.State.FinishedSessions = entry.FinishedSessions
+	t.State.Task = entry.Task
+	if entry.Sessions != 0 {
+		t.Config.Sessions = entry.Sessions
+	}
+	duration := entry.Duration
+	if !entry.Paused {
+		duration -= time.Since(entry.At)
+	}
+	t.SeekTo(max(duration, 0))
+	s.version = t.State.Version
+}
+
+func (s *Syncer) message() Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peers := make([]string, 0, len(s.peers))
+	for address := range s.peers {
+		peers = append(peers, address)
+	}
+	return Message{Node: s.Node, Group: s.Group, Address: s.Address, Entry: s.entry, Peers: peers}
+}
+
+// learn adds the peers that a peer knows about
+func (s *Syncer) learn(peers []string) {
+	for _, address := range peers {
+		if address != s.Address {
+			s.AddPeer(address)
+		}
+	}
+}
+
+// Handle merges the message of a peer, and returns the message to respond
+// with
+func (s *Syncer) Handle(msg Message) (Message, error) {
+	if msg.Group != s.Group {
+		return Message{}, ErrGroupMismatch
+	}
+	s.checkLocal()
+	if msg.Node != s.Node {
+		s.seen(msg.Address, msg.Node)
+	}
+	s.learn(msg.Peers)
+	s.merge(msg.Entry)
+	return s.message(), nil
+}
+
+// seen marks the node as alive. its address is added as a peer, unless the
+// node is known by another address
+func (s *Syncer) seen(address, node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peer, ok := s.peers[address]
+	if !ok {
+		for _, other := range s.peers {
+			if other.Node == node {
+				peer = other
+			}
+		}
+	}
+	if peer == nil {
+		if address == "" || s.aliases[address] {
+			return
+		}
+		slog.Info("sync peer joined", "address", address, "node", node)
+		peer = &Peer{Address: address}
+		s.peers[address] = peer
+	}
+	peer.Node = node
+	peer.LastSeen = time.Now()
+	peer.Error = ""
+	peer.failures = 0
+}
+
+// exchange sends the current entry to the peer, and merges its entry
+func (s *Syncer) exchange(address string) error {
+	content, _ := json.Marshal(s.message())
+	resp, err := s.Http.Post(address+"/api/sync", "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer responded %s", resp.Status)
+	}
+	var msg Message
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return err
+	}
+	if msg.Group != s.Group {
+		return ErrGroupMismatch
+	}
+	if msg.Node == s.Node {
+		return errAlias
+	}
+	s.mu.Lock()
+	for other, peer := range s.peers {
+		if other != address && peer.Node == msg.Node {
+			s.mu.Unlock()
+			return errAlias
+		}
+	}
+	if peer, ok := s.peers[address]; ok {
+		peer.Node = msg.Node
+	}
+	s.mu.Unlock()
+	s.learn(msg.Peers)
+	s.merge(msg.Entry)
+	return nil
+}
+
+var errAlias = errors.New("peer is this node itself, or another address of a known peer")
+
+// pushAll exchanges entries with every peer
+func (s *Syncer) pushAll() {
+	s.mu.Lock()
+	addresses := make([]string, 0, len(s.peers))
+	for address := range s.peers {
+		addresses = append(addresses, address)
+	}
+	s.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.exchange(address)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			peer, ok := s.peers[address]
+			if !ok {
+				return
+			}
+			if err == nil {
+				peer.LastSeen = time.Now()
+				peer.Error = ""
+				peer.failures = 0
+				return
+			}
+			peer.Error = err.Error()
+			peer.failures++
+			if err == errAlias && !peer.Static {
+				slog.Debug("ignoring alias of sync peer", "address", address)
+				s.aliases[address] = true
+				delete(s.peers, address)
+			} else if err == errAlias || (!peer.Static && peer.failures >= MAX_FAILURES) {
+				slog.Info("forgetting sync peer", "address", address, "err", err)
+				delete(s.peers, address)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// AddPeer adds a peer at the http address, if its not known already
+func (s *Syncer) AddPeer(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.peers[address]; !ok && !s.aliases[address] {
+		slog.Info("sync peer found", "address", address)
+		s.peers[address] = &Peer{Address: address}
+	}
+}
+
+// Peers returns the known peers, ordered by their address
+func (s *Syncer) Peers() []Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	peers := make([]Peer, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peers = append(peers, *peer)
+	}
+	slices.SortFunc(peers, func(a, b Peer) int {
+		return strings.Compare(a.Address, b.Address)
+	})
+	return peers
+}
+
+// Status is the state of the syncer, as its exposed in the api
+type Status struct {
+	Node  string
+	Group string
+	Entry Entry
+	Peers []Peer
+}
+
+func (s *Syncer) Status() Status {
+	msg := s.message()
+	return Status{Node: s.Node, Group: s.Group, Entry: msg.Entry, Peers: s.Peers()}
+}
+
+// Run exchanges entries with all the peers every s.Interval (anti-entropy),
+// until ctx is done
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.checkLocal()
+		s.pushAll()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Advertise advertises the node on the network with mdns, for other members of
+// its group to discover it. address is the "host:port" of the http daemon
+func (s *Syncer) Advertise(ctx context.Context, instance string, address string) error {
+	service := mdns.Service{
+		Instance: instance + " " + s.Node,
+		Service:  SERVICE,
+		Txt:      []string{"node=" + s.Node, "group=" + s.Group},
+	}
+	if err := service.Listen(address); err != nil {
+		return err
+	}
+	responder, err := mdns.NewResponder(service)
+	if err != nil {
+		return err
+	}
+	go responder.Run(ctx)
+	return nil
+}
+
+// Discover browses the network for other members of the group every
+// s.Interval*6, adding them as peers, until ctx is done
+func (s *Syncer) Discover(ctx context.Context) {
+	for {
+		services, err := mdns.Browse(ctx, SERVICE, time.Second)
+		if err != nil {
+			slog.Warn("discovering sync peers failed", "err", err)
+		}
+		for _, service := range services {
+			node, _ := service.Value("node")
+			group, _ := service.Value("group")
+			if node == s.Node || group != s.Group || service.Address() == "" {
+				continue
+			}
+			s.AddPeer(s.Scheme + "://" + service.Address())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.Interval * 6):
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package peersync_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/peersync"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func TestEntryNewer(t *testing.T) {
+	a := peersync.Entry{Clock: 2, Node: "a"}
+	b := peersync.Entry{Clock: 1, Node: "b"}
+	if !a.Newer(b) || b.Newer(a) {
+		t.Fatal("entry with the greater clock isn't newer")
+	}
+	b.Clock = 2
+	if a.Newer(b) || !b.Newer(a) {
+		t.Fatal("tie isn't broken by the node ids")
+	}
+}
+
+func newTimer() *timer.PomodoroTimer {
+	config := timer.DefaultConfig
+	pt := &timer.PomodoroTimer{Config: &config}
+	pt.Init()
+	return pt
+}
+
+func TestHandle(t *testing.T) {
+	pt := newTimer()
+	s := peersync.NewSyncer("b", "group", pt, nil)
+	if _, err := s.Handle(peersync.Message{Node: "a", Group: "other"}); err != peersync.ErrGroupMismatch {
+		t.Fatalf("message of another group returned %v", err)
+	}
+
+	// a joining node adopts the group's timer, even with a smaller node id
+	response, err := s.Handle(peersync.Message{Node: "a", Group: "group", Address: "http://a", Entry: peersync.Entry{
+		Clock: 1, Node: "a", At: time.Now(), Mode: timer.ShortBreak, Duration: time.Minute, Paused: true, Task: "joined",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.State.Mode != timer.ShortBreak || pt.State.Task != "joined" || pt.State.Duration != time.Minute {
+		t.Fatalf("entry isn't applied: mode %v, task %q, duration %v", pt.State.Mode, pt.State.Task, pt.State.Duration)
+	}
+	if response.Entry.Clock != 1 || response.Entry.Node != "a" {
+		t.Fatalf("response's entry: %+v", response.Entry)
+	}
+	if peers := s.Peers(); len(peers) != 1 || peers[0].Address != "http://a" || peers[0].Node != "a" {
+		t.Fatalf("sender isn't added as a peer: %+v", peers)
+	}
+
+	// local changes win over older entries
+	pt.State.Task = "local"
+	pt.Changed()
+	response, _ = s.Handle(peersync.Message{Node: "a", Group: "group", Entry: peersync.Entry{
+		Clock: 1, Node: "a", At: time.Now(), Task: "old",
+	}})
+	if pt.State.Task != "local" || response.Entry.Clock != 2 || response.Entry.Task != "local" {
+		t.Fatalf("older entry is applied: task %q, response %+v", pt.State.Task, response.Entry)
+	}
+}
+
+type member struct {
+	syncer *peersync.Syncer
+	timer  *timer.PomodoroTimer
+	server *httptest.Server
+}
+
+func newMember(t *testing.T, node string, peers ...string) *member {
+	pt := newTimer()
+	d := &httpd.Daemon{Timer: pt, Hub: httpd.NewHub(httpd.DEFAULT_QUEUE_SIZE, 0)}
+	d.Init()
+	d.JsonRoutes()
+	m := &member{timer: pt, server: httptest.NewServer(d.Handler())}
+	t.Cleanup(m.server.Close)
+	m.syncer = peersync.NewSyncer(node, "group", pt, peers)
+	m.syncer.Address = m.server.URL
+	m.syncer.Interval = 20 * time.Millisecond
+	m.syncer.AddEventWatchers(pt.Config)
+	d.Sync = m.syncer
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go m.syncer.Run(ctx)
+	return m
+}
+
+// setTask changes the task of m's timer, as a local change
+func (m *member) setTask(task string) {
+	m.timer.State.Mu.Lock()
+	defer m.timer.State.Mu.Unlock()
+	m.timer.State.Task = task
+	m.timer.Changed()
+}
+
+func (m *member) task() string {
+	m.timer.State.Mu.Lock()
+	defer m.timer.State.Mu.Unlock()
+	return m.timer.State.Task
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for range 200 {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestGroupConverges(t *testing.T) {
+	a := newMember(t, "a")
+	b := newMember(t, "b", a.server.URL)
+	eventually(t, "a to know b", func() bool { return len(a.syncer.Peers()) == 1 })
+	c := newMember(t, "c", b.server.URL)
+	eventually(t, "b to know c", func() bool { return len(b.syncer.Peers()) == 2 })
+
+	c.setTask("from c")
+	for name, m := range map[string]*member{"a": a, "b": b} {
+		eventually(t, "c's change on "+name, func() bool { return m.task() == "from c" })
+	}
+
+	// the group tolerates b going away, as a and c learn about each other
+	eventually(t, "a to know c", func() bool { return len(a.syncer.Peers()) == 2 })
+	b.server.Close()
+	a.setTask("from a")
+	eventually(t, "a's change on c", func() bool { return c.task() == "from a" })
+}
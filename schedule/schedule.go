@@ -0,0 +1,276 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+const (
+	// initializes the timer and unpauses it. also lifts a previous stop
+	Start = "start"
+	// lets the current cycle finish, but pauses the timer when a new cycle starts
+	Stop   = "stop"
+	Pause  = "pause"
+	Resume = "resume"
+	// a fixed break from At until Until (lunch for example). the break is a long
+	// break, so a new cycle starts after it
+	Break = "break"
+)
+
+const TIME_LAYOUT = "15:04"
+
+// Rule is a schedule rule in the config
+type Rule struct {
+	At    string `mapstructure:"at"`
+	Until string `mapstructure:"until,omitempty"`
+	// weekdays the rule is active at. "mon", "mon-fri", "weekdays" and
+	// "weekends" are all valid. empty means every day
+	Days   []string `mapstructure:"days,omitempty"`
+	Action string   `mapstructure:"action"`
+}
+
+type rule struct {
+	Rule
+	at, until time.Duration
+	days      [7]bool
+}
+
+// Action is a scheduled action at a specific time
+type Action struct {
+	Action string
+	At     time.Time
+	Until  time.Time `json:",omitzero"`
+}
+
+type Scheduler struct {
+	Timer *timer.PomodoroTimer
+	rules []rule
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseDays(input []string) (days [7]bool, err error) {
+	if len(input) == 0 {
+		for i := range days {
+			days[i] = true
+		}
+		return
+	}
+	for _, item := range input {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch item {
+		case "weekdays":
+			item = "mon-fri"
+		case "weekends":
+			days[time.Saturday] = true
+			days[time.Sunday] = true
+			continue
+		}
+		from, to, is_range := strings.Cut(item, "-")
+		start, ok := weekdays[from]
+		if !ok {
+			return days, fmt.Errorf("invalid weekday %q", from)
+		}
+		end := start
+		if is_range {
+			if end, ok = weekdays[to]; !ok {
+				return days, fmt.Errorf("invalid weekday %q", to)
+			}
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == end {
+				break
+			}
+		}
+	}
+	return
+}
+
+// parseTime parses "15:04" into a duration after midnight
+func parseTime(input string) (time.Duration, error) {
+	parsed, err := time.Parse(TIME_LAYOUT, input)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+func parseRule(r Rule) (parsed rule, err error) {
+	parsed.Rule = r
+	switch r.Action {
+	case Start, Stop, Pause, Resume, Break:
+	default:
+		return parsed, fmt.Errorf("invalid schedule action %q", r.Action)
+	}
+	if parsed.at, err = parseTime(r.At); err != nil {
+		return parsed, err
+	}
+	if r.Action == Break {
+		if r.Until == "" {
+			return parsed, fmt.Errorf("schedule action %q at %s needs an until time", r.Action, r.At)
+		}
+		if parsed.until, err = parseTime(r.Until); err != nil {
+			return parsed, err
+		}
+		if parsed.until <= parsed.at {
+			return parsed, fmt.Errorf("until (%s) should be after at (%s)", r.Until, r.At)
+		}
+	}
+	if parsed.days, err = parseDays(r.Days); err != nil {
+		return parsed, err
+	}
+	return parsed, nil
+}
+
+func NewScheduler(t *timer.PomodoroTimer, rules []Rule) (*Scheduler, error) {
+	s := &Scheduler{Timer: t}
+	for _, r := range rules {
+		parsed, err := parseRule(r)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, parsed)
+	}
+	return s, nil
+}
+
+// Next returns the first scheduled action strictly after now
+func (s *Scheduler) Next(now time.Time) (next Action, ok bool) {
+	y, m, d := now.Date()
+	for _, r := range s.rules {
+		// a week and a day is enough to find the next occurrence of any rule
+		for i := range 8 {
+			midnight := time.Date(y, m, d+i, 0, 0, 0, 0, now.Location())
+			if !r.days[midnight.Weekday()] {
+				continue
+			}
+			at := midnight.Add(r.at)
+			if !at.After(now) {
+				continue
+			}
+			if !ok || at.Before(next.At) {
+				next = Action{Action: r.Action, At: at}
+				if r.Action == Break {
+					next.Until = midnight.Add(r.until)
+				}
+				ok = true
+			}
+			break
+		}
+	}
+	return
+}
+
+// Last returns the last scheduled action at or before now, out of actions.
+// any action if actions is empty
+func (s *Scheduler) Last(now time.Time, actions ...string) (last Action, ok bool) {
+	y, m, d := now.Date()
+	for _, r := range s.rules {
+		if len(actions) != 0 && !slices.Contains(actions, r.Action) {
+			continue
+		}
+		for i := range 8 {
+			midnight := time.Date(y, m, d-i, 0, 0, 0, 0, now.Location())
+			if !r.days[midnight.Weekday()] {
+				continue
+			}
+			at := midnight.Add(r.at)
+			if at.After(now) {
+				continue
+			}
+			if !ok || at.After(last.At) {
+				last = Action{Action: r.Action, At: at}
+				if r.Action == Break {
+					last.Until = midnight.Add(r.until)
+				}
+				ok = true
+			}
+			break
+		}
+	}
+	return
+}
+
+// Stopped reports whether the timer is stopped at now. its stopped after a
+// stop action, until a start action. its recomputed from the rules, so its
+// the same across restarts and reloads of config
+func (s *Scheduler) Stopped(now time.Time) bool {
+	last, ok := s.Last(now, Start, Stop)
+	return ok && last.Action == Stop
+}
+
+// apply runs the action on the timer. State.Mu is held, as the timer ticks
+// under it. the requests of participants hold it too, so the action isn't
+// attributed to any of them
+func (s *Scheduler) apply(action Action) {
+	slog.Info("running scheduled action", "action", action.Action, "at", action.At)
+	t := s.Timer
+	t.State.Mu.Lock()
+	defer t.State.Mu.Unlock()
+	switch action.Action {
+	case Start:
+		t.Init()
+		t.Pause(false)
+	case Stop:
+		// new cycles are paused by the init hook, while stopped
+	case Pause:
+		t.Pause(true)
+	case Resume:
+		t.Pause(false)
+	case Break:
+		t.SetMode(timer.LongBreak)
+		t.SeekTo(time.Until(action.Until))
+		t.Pause(false)
+	}
+}
+
+// Run halts the current thread, applying the actions in their times until ctx
+// is Done. Use in a goroutine.
+func (s *Scheduler) Run(ctx context.Context) {
+	slog.Info("scheduler started")
+	for {
+		next, ok := s.Next(time.Now())
+		if !ok {
+			return
+		}
+		slog.Debug("next scheduled action", "action", next.Action, "at", next.At)
+		// wake up at least every minute; timers don't count the time that the
+		// machine is suspended
+		for now := time.Now(); now.Before(next.At); now = time.Now() {
+			t := time.NewTimer(min(next.At.Sub(now), time.Minute))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+		s.apply(next)
+	}
+}
+
+func (s *Scheduler) AddEventWatchers(config *timer.TimerConfig) {
+	config.Hooks.OnInit.Append(func(pt *timer.PomodoroTimer) {
+		pt.State.Mu.Lock()
+		defer pt.State.Mu.Unlock()
+		if s.Stopped(time.Now()) && !pt.State.Paused {
+			slog.Info("outside of scheduled working hours. not starting a new cycle")
+			pt.Pause(true)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func TestParseDays(t *testing.T) {
+	for _, item := range []struct {
+		input    []string
+		expected []time.Weekday
+	}{
+		{[]string{"mon-fri"}, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{[]string{"weekdays"}, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{[]string{"weekends"}, []time.Weekday{time.Saturday, time.Sunday}},
+		{[]string{"fri-mon"}, []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{[]string{"Tue", "thu"}, []time.Weekday{time.Tuesday, time.Thursday}},
+	} {
+		days, err := parseDays(item.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected [7]bool
+		for _, day := range item.expected {
+			expected[day] = true
+		}
+		if days != expected {
+			t.Fatalf("parsing %q resulted in %v. expected %v", item.input, days, expected)
+		}
+	}
+	if _, err := parseDays([]string{"someday"}); err == nil {
+		t.Fatal("parsing an invalid weekday didn't fail")
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	pt := timer.PomodoroTimer{Config: &timer.DefaultConfig}
+	for _, r := range []Rule{
+		{At: "09:00", Action: "dance"},
+		{At: "9am", Action: Start},
+		{At: "12:00", Action: Break},
+		{At: "12:00", Until: "11:00", Action: Break},
+	} {
+		if _, err := NewScheduler(&pt, []Rule{r}); err == nil {
+			t.Fatalf("invalid rule %+v didn't fail", r)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	pt := timer.PomodoroTimer{Config: &timer.DefaultConfig}
+	s, err := NewScheduler(&pt, []Rule{
+		{At: "09:00", Days: []string{"weekdays"}, Action: Start},
+		{At: "12:30", Until: "13:30", Days: []string{"weekdays"}, Action: Break},
+		{At: "18:00", Days: []string{"weekdays"}, Action: Stop},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2025-05-09 is a friday
+	friday := func(hour, min int) time.Time {
+		return time.Date(2025, 5, 9, hour, min, 0, 0, time.Local)
+	}
+	for _, item := range []struct {
+		now      time.Time
+		expected Action
+	}{
+		{friday(8, 0), Action{Action: Start, At: friday(9, 0)}},
+		{friday(9, 0), Action{Action: Break, At: friday(12, 30), Until: friday(13, 30)}},
+		{friday(13, 0), Action{Action: Stop, At: friday(18, 0)}},
+		{friday(19, 0), Action{Action: Start, At: time.Date(2025, 5, 12, 9, 0, 0, 0, time.Local)}},
+	} {
+		next, ok := s.Next(item.now)
+		if !ok {
+			t.Fatalf("no next action found at %s", item.now)
+		}
+		if next.Action != item.expected.Action || !next.At.Equal(item.expected.At) || !next.Until.Equal(item.expected.Until) {
+			t.Fatalf("next action at %s is %+v. expected %+v", item.now, next, item.expected)
+		}
+	}
+}
+
+func TestStopped(t *testing.T) {
+	pt := timer.PomodoroTimer{Config: &timer.DefaultConfig}
+	s, err := NewScheduler(&pt, []Rule{
+		{At: "09:00", Days: []string{"weekdays"}, Action: Start},
+		{At: "12:30", Until: "13:30", Days: []string{"weekdays"}, Action: Break},
+		{At: "18:00", Days: []string{"weekdays"}, Action: Stop},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2025-05-09 is a friday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2025, 5, day, hour, min, 0, 0, time.Local)
+	}
+	for _, item := range []struct {
+		now     time.Time
+		stopped bool
+	}{
+		{at(9, 8, 59), true},
+		{at(9, 9, 0), false},
+		{at(9, 13, 0), false},
+		{at(9, 18, 0), true},
+		// the weekend, after friday's stop
+		{at(11, 12, 0), true},
+		{at(12, 9, 30), false},
+	} {
+		if stopped := s.Stopped(item.now); stopped != item.stopped {
+			t.Fatalf("stopped at %s is %v. expected %v", item.now, stopped, item.stopped)
+		}
+	}
+	if last, ok := s.Last(at(9, 13, 0)); !ok || last.Action != Break || !last.Until.Equal(at(9, 13, 30)) {
+		t.Fatalf("last action is %+v", last)
+	}
+	empty, _ := NewScheduler(&pt, nil)
+	if empty.Stopped(at(9, 12, 0)) {
+		t.Fatal("timer without rules is stopped")
+	}
+}
+
+func TestApply(t *testing.T) {
+	config := timer.DefaultConfig
+	config.DurationPerTick = time.Millisecond
+	pt := timer.PomodoroTimer{Config: &config}
+	pt.Init()
+	s, _ := NewScheduler(&pt, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// actions are applied while the timer ticks
+	go pt.Loop(ctx)
+	time.Sleep(10 * time.Millisecond)
+	until := time.Now().Add(time.Hour)
+	s.apply(Action{Action: Break, Until: until})
+	s.apply(Action{Action: Pause})
+	pt.State.Mu.Lock()
+	defer pt.State.Mu.Unlock()
+	if pt.State.Mode != timer.LongBreak || !pt.State.Paused || pt.State.Duration < 59*time.Minute {
+		t.Fatalf("actions aren't applied: %s, paused: %v, remaining: %s", pt.State.Mode, pt.State.Paused, pt.State.Duration)
+	}
+}
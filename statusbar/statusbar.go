@@ -0,0 +1,279 @@
+// Package statusbar formats the timer in the native protocols of status bars
+package statusbar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// formats of the status bars
+const (
+	Waybar   = "waybar"
+	I3bar    = "i3bar"
+	Polybar  = "polybar"
+	Tmux     = "tmux"
+	Template = "template"
+)
+
+var Formats = []string{Waybar, I3bar, Polybar, Tmux, Template}
+
+const DEFAULT_TEMPLATE = "{{.ModeName}} {{.Remaining}}{{if .Paused}} (paused){{end}}"
+
+// name of the block of goje in the i3bar protocol
+const I3BAR_NAME = "goje"
+
+// colors of the modes, by their snake_case names
+var colors = map[string]string{
+	timer.Pomodoro.SnakeCase():   "#e06c75",
+	timer.ShortBreak.SnakeCase(): "#98c379",
+	timer.LongBreak.SnakeCase():  "#61afef",
+}
+
+// color of the paused timer
+const PAUSED_COLOR = "#888888"
+
+// Status is what the template of the text is applied on
+type Status struct {
+	// snake_case name of the mode ("pomodoro", "short_break" or "long_break")
+	Mode string
+	// human readable name of the mode
+	ModeName string
+	// remaining duration as mm:ss (h:mm:ss if its an hour or more)
+	Remaining string
+	Duration  time.Duration
+	Paused    bool
+	// percentage of the mode that has passed
+	Percentage       int
+	FinishedSessions uint
+	Sessions         uint
+	Task             string
+}
+
+func NewStatus(t *timer.PomodoroTimer) Status {
+	total := t.Config.Duration[t.State.Mode]
+	status := Status{
+		Mode:             t.State.Mode.SnakeCase(),
+		ModeName:         t.State.Mode.String(),
+		Remaining:        formatDuration(t.State.Duration),
+		Duration:         t.State.Duration,
+		Paused:           t.State.Paused,
+		FinishedSessions: t.State.FinishedSessions,
+		Sessions:         t.Config.Sessions,
+		Task:             t.State.Task,
+	}
+	if total > 0 {
+		status.Percentage = min(max(int(100-100*t.State.Duration/total), 0), 100)
+	}
+	return status
+}
+
+// formatDuration formats d as mm:ss, or h:mm:ss if its an hour or more
+func formatDuration(d time.Duration) string {
+	seconds := max(int(d.Seconds()), 0)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// Click is the action of a mouse button, the same as the actions of goje ctl
+type Click struct {
+	// button of the i3bar protocol, and polybar's action tags. 1 is the left
+	// button, 4 and 5 are scrolling up and down
+	Button   int
+	Action   string
+	Argument string
+}
+
+var Clicks = []Click{
+	{1, "pause", ""},
+	{2, "reset", ""},
+	{3, "next", ""},
+	{4, "seek", "+1m"},
+	{5, "seek", "-1m"},
+}
+
+// ClickOf returns the click of button. ok is false if the button has no action
+func ClickOf(button int) (click Click, ok bool) {
+	i := slices.IndexFunc(Clicks, func(c Click) bool { return c.Button == button })
+	if i == -1 {
+		return click, false
+	}
+	return Clicks[i], true
+}
+
+// Command returns the command line of the click, with ctl as the command of
+// goje ctl
+func (c Click) Command(ctl string) string {
+	if c.Argument == "" {
+		return ctl + " " + c.Action
+	}
+	return ctl + " " + c.Action + " -- " + c.Argument
+}
+
+// ParseI3barClick parses a line of the click events that i3bar sends. ok is
+// false for lines that aren't clicks on goje (the opening "[" for example)
+func ParseI3barClick(line []byte) (button int, ok bool) {
+	line = bytes.TrimLeft(bytes.TrimSpace(line), "[,")
+	var event struct {
+		Name   string
+		Button int
+	}
+	if err := json.Unmarshal(line, &event); err != nil || event.Name != I3BAR_NAME {
+		return 0, false
+	}
+	return event.Button, true
+}
+
+// Formatter writes the lines of a status bar
+type Formatter struct {
+	// one of Formats
+	Format string
+	// template of the text that the bar shows
+	Text *template.Template
+	// command of goje ctl, that the actions of polybar run. "goje ctl" by
+	// default
+	Ctl string
+}
+
+// NewFormatter returns the formatter of format, with the template of the
+// text. DEFAULT_TEMPLATE is used if text is empty
+func NewFormatter(format, text string) (*Formatter, error) {
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("invalid format %q. expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	if text == "" {
+		text = DEFAULT_TEMPLATE
+	}
+	tmpl, err := template.New(format).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Formatter{Format: format, Text: tmpl, Ctl: "goje ctl"}, nil
+}
+
+// Header returns what's written before the lines of a followed status. only
+// i3bar has a header
+func (f *Formatter) Header() string {
+	if f.Format != I3bar {
+		return ""
+	}
+	return `{"version":1,"click_events":true}` + "\n[\n"
+}
+
+// Line returns the line of the status, without the newline. nil status is
+// goje being unreachable
+func (f *Formatter) Line(status *Status) (string, error) {
+	var text string
+	if status != nil {
+		var buf strings.Builder
+		if err := f.Text.Execute(&buf, status); err != nil {
+			return "", err
+		}
+		text = buf.String()
+	}
+	switch f.Format {
+	case Waybar:
+		return f.waybar(status, text)
+	case I3bar:
+		return f.i3bar(status, text)
+	case Polybar:
+		return f.polybar(status, text), nil
+	case Tmux:
+		return tmux(status, text), nil
+	}
+	return text, nil
+}
+
+// class of waybar, and the color of the others
+func class(status *Status) (class []string, color string) {
+	if status == nil {
+		return []string{"offline"}, PAUSED_COLOR
+	}
+	class = []string{status.Mode}
+	color = colors[status.Mode]
+	if status.Paused {
+		class = append(class, "paused")
+		color = PAUSED_COLOR
+	}
+	return class, color
+}
+
+// Color returns the color of the status, as #rrggbb. nil status is goje
+// being unreachable
+func Color(status *Status) string {
+	_, color := class(status)
+	return color
+}
+
+func tooltip(status *Status) string {
+	if status == nil {
+		return "goje isn't reachable"
+	}
+	tooltip := fmt.Sprintf("%s: %s left\nsessions: %d/%d", status.ModeName, status.Remaining, status.FinishedSessions, status.Sessions)
+	if status.Task != "" {
+		tooltip += "\ntask: " + status.Task
+	}
+	return tooltip
+}
+
+func (f *Formatter) waybar(status *Status, text string) (string, error) {
+	class, _ := class(status)
+	out := struct {
+		Text       string   `json:"text"`
+		Alt        string   `json:"alt"`
+		Tooltip    string   `json:"tooltip"`
+		Class      []string `json:"class"`
+		Percentage int      `json:"percentage"`
+	}{Text: text, Tooltip: tooltip(status), Class: class}
+	if status != nil {
+		out.Alt = status.Mode
+		out.Percentage = status.Percentage
+	}
+	content, err := json.Marshal(out)
+	return string(content), err
+}
+
+// i3bar returns a status line of the i3bar protocol, as an element of its
+// infinite array
+func (f *Formatter) i3bar(status *Status, text string) (string, error) {
+	_, color := class(status)
+	block := struct {
+		Name     string `json:"name"`
+		FullText string `json:"full_text"`
+		Color    string `json:"color"`
+	}{I3BAR_NAME, text, color}
+	content, err := json.Marshal([]any{block})
+	return string(content) + ",", err
+}
+
+// polybar returns the text in polybar's color, with an action tag of each
+// click
+func (f *Formatter) polybar(status *Status, text string) string {
+	if status == nil {
+		return text
+	}
+	_, color := class(status)
+	// colons of the commands are escaped, as they end the tags
+	for _, click := range Clicks {
+		command := strings.ReplaceAll(click.Command(f.Ctl), ":", `\:`)
+		text = fmt.Sprintf("%%{A%d:%s:}%s%%{A}", click.Button, command, text)
+	}
+	return "%{F" + color + "}" + text + "%{F-}"
+}
+
+func tmux(status *Status, text string) string {
+	if status == nil {
+		return text
+	}
+	_, color := class(status)
+	// # starts the styles of tmux
+	return "#[fg=" + color + "]" + strings.ReplaceAll(text, "#", "##") + "#[default]"
+}
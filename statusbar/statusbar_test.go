@@ -0,0 +1,100 @@
+package statusbar
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func newStatus(paused bool) *Status {
+	config := timer.DefaultConfig
+	t := timer.PomodoroTimer{Config: &config}
+	t.Init()
+	t.State.Duration = 10 * time.Minute
+	t.State.Paused = paused
+	t.State.Task = "reviewing #42"
+	status := NewStatus(&t)
+	return &status
+}
+
+func TestNewStatus(t *testing.T) {
+	status := newStatus(false)
+	if status.Remaining != "10:00" || status.Percentage != 60 || status.Mode != "pomodoro" {
+		t.Fatalf("status: %+v", status)
+	}
+}
+
+func TestWaybar(t *testing.T) {
+	formatter, err := NewFormatter(Waybar, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := formatter.Line(newStatus(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Text       string
+		Alt        string
+		Tooltip    string
+		Class      []string
+		Percentage int
+	}
+	if err := json.Unmarshal([]byte(line), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Text != "Pomodoro 10:00 (paused)" || out.Alt != "pomodoro" || out.Percentage != 60 ||
+		strings.Join(out.Class, " ") != "pomodoro paused" || !strings.Contains(out.Tooltip, "task: reviewing #42") {
+		t.Fatalf("waybar: %s", line)
+	}
+	line, _ = formatter.Line(nil)
+	if !strings.Contains(line, `"class":["offline"]`) {
+		t.Fatalf("offline waybar: %s", line)
+	}
+}
+
+func TestI3bar(t *testing.T) {
+	formatter, err := NewFormatter(I3bar, "{{.Remaining}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(formatter.Header(), `{"version":1,"click_events":true}`) {
+		t.Fatalf("header: %q", formatter.Header())
+	}
+	line, _ := formatter.Line(newStatus(false))
+	if line != `[{"name":"goje","full_text":"10:00","color":"#e06c75"}],` {
+		t.Fatalf("i3bar: %s", line)
+	}
+	for input, want := range map[string]int{
+		`[`:                                  0,
+		`{"name":"goje","button":3,"x":10}`:  3,
+		`,{"name":"goje","button":1,"x":10}`: 1,
+		`,{"name":"clock","button":1}`:       0,
+	} {
+		if button, _ := ParseI3barClick([]byte(input)); button != want {
+			t.Fatalf("button of %s: %d, want %d", input, button, want)
+		}
+	}
+	if click, ok := ClickOf(5); !ok || click.Command("goje ctl") != "goje ctl seek -- -1m" {
+		t.Fatalf("click of scrolling down: %+v", click)
+	}
+}
+
+func TestPolybarAndTmux(t *testing.T) {
+	formatter, _ := NewFormatter(Polybar, "{{.Remaining}}")
+	formatter.Ctl = "/usr/bin/goje ctl"
+	line, _ := formatter.Line(newStatus(false))
+	if !strings.HasPrefix(line, "%{F#e06c75}%{A5:/usr/bin/goje ctl seek -- -1m:}") || !strings.Contains(line, "%{A1:/usr/bin/goje ctl pause:}10:00%{A}") {
+		t.Fatalf("polybar: %s", line)
+	}
+	formatter, _ = NewFormatter(Tmux, "{{.Task}}")
+	if line, _ := formatter.Line(newStatus(false)); line != "#[fg=#e06c75]reviewing ##42#[default]" {
+		t.Fatalf("tmux: %s", line)
+	}
+	if _, err := NewFormatter("dzen", ""); err == nil {
+		t.Fatal("invalid format is accepted")
+	}
+}
@@ -0,0 +1,104 @@
+package tcpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// AckError is the error that the daemon has responded to a command with
+// ("ACK {<command>} <message>")
+type AckError struct {
+	// command that has failed. empty if the command isn't found
+	Command string
+	Message string
+}
+
+func (e AckError) Error() string {
+	if e.Command == "" {
+		return e.Message
+	}
+	return e.Command + ": " + e.Message
+}
+
+// parseAck parses an "ACK {<command>} <message>" line
+func parseAck(line string) AckError {
+	rest := strings.TrimPrefix(line, "ACK ")
+	if strings.HasPrefix(rest, "{") {
+		if end := strings.Index(rest, "}"); end != -1 {
+			return AckError{Command: rest[1:end], Message: strings.TrimSpace(rest[end+1:])}
+		}
+	}
+	return AckError{Message: rest}
+}
+
+// Client is a connection to a tcp daemon, that runs commands on it one at a
+// time
+type Client struct {
+	// version of goje that the daemon has greeted with
+	Version string
+
+	conn   net.Conn
+	reader *bufio.Reader
+	// time that each command (and the greeting) has to be responded in. no
+	// limit if zero
+	timeout time.Duration
+}
+
+// Dial connects to the daemon at address, and reads its greeting. timeout
+// applies to connecting, and to each response of the daemon
+func Dial(address string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	c.setDeadline()
+	greeting, err := c.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	version, ok := strings.CutPrefix(strings.TrimSpace(greeting), "OK goje ")
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("%s isn't a goje daemon: %q", address, greeting)
+	}
+	c.Version = version
+	return c, nil
+}
+
+// Command runs the command, and returns its output (without the final "OK").
+// the error is an AckError if the daemon has rejected the command
+func (c *Client) Command(command string) (string, error) {
+	c.setDeadline()
+	if _, err := fmt.Fprintln(c.conn, command); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return out.String(), err
+		}
+		switch {
+		case line == "OK\n":
+			return out.String(), nil
+		case strings.HasPrefix(line, "ACK "):
+			return out.String(), parseAck(strings.TrimSpace(line))
+		}
+		out.WriteString(line)
+	}
+}
+
+func (c *Client) setDeadline() {
+	if c.timeout != 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -11,8 +11,10 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/nimaaskarian/goje/consensus"
 	"github.com/nimaaskarian/goje/timer"
 )
 
@@ -27,6 +29,12 @@ const (
 	Sessions       = "sessions"
 	ConfigSessions = "config-sessions"
 	Timer          = "timer"
+	Goal           = "goal"
+	Task           = "task"
+	Propose        = "propose"
+	Vote           = "vote"
+	Proposals      = "proposals"
+	Participant    = "participant"
 	Commands       = "commands"
 )
 
@@ -47,10 +55,58 @@ func (e WrongNumberOfArgsError) Error() string {
 }
 
 func ParseInput(timer *timer.PomodoroTimer, input string) (string, string, error) {
+	return (&Session{Timer: timer}).Parse(input)
+}
+
+// Presence is where the participants that clients identify as join and leave.
+// the participants of the http daemon for example
+type Presence interface {
+	// returns an error if the participant is claimed with another secret
+	Join(id, secret, name, task string) error
+	Leave(id string)
+}
+
+// Session is the state of a client, that its commands run in
+type Session struct {
+	Timer *timer.PomodoroTimer
+	// optional. when set, next, prev, reset, init, extending seeks and seeks
+	// past the remaining duration become proposals that are applied after
+	// enough participants approve them
+	Voting *consensus.Voting
+	// optional. the participant that the client identifies as joins it
+	Presence Presence
+	// id of the participant that the client has identified as, with the
+	// participant command
+	Participant string
+	// participant that the session has joined Presence as
+	joined string
+	// the participant can't be changed after its proposed or voted
+	voted bool
+}
+
+// Close leaves the participant that the session has joined as
+func (s *Session) Close() {
+	if s.Presence != nil && s.joined != "" {
+		s.Presence.Leave(s.joined)
+		s.joined = ""
+	}
+}
+
+func (s *Session) Parse(input string) (string, string, error) {
+	timer := s.Timer
 	splited := strings.Split(input, " ")
 	cmd := splited[0]
 	var err error
 	var out string
+	if s.Voting != nil {
+		if proposal, ok, err := s.proposalOf(splited); ok {
+			if err != nil {
+				return cmd, "", err
+			}
+			out, err = s.propose(proposal)
+			return cmd, out, err
+		}
+	}
 	switch splited[0] {
 	case Pause:
 		out, err = pauseCmd(timer, splited)
@@ -70,6 +126,18 @@ func ParseInput(timer *timer.PomodoroTimer, input string) (string, string, error
 		out, err = sessionsCmd(timer, splited)
 	case ConfigSessions:
 		out, err = configSessionsCmd(timer, splited)
+	case Goal:
+		out, err = goalCmd(timer, splited)
+	case Task:
+		out, err = taskCmd(timer, splited)
+	case Propose:
+		out, err = s.proposeCmd(splited)
+	case Vote:
+		out, err = s.voteCmd(splited)
+	case Proposals:
+		out, err = s.proposalsCmd(splited)
+	case Participant:
+		out, err = s.participantCmd(splited)
 	case Commands:
 		out, err = fmt.Sprintf(`command: %s
 command: %s
@@ -82,7 +150,13 @@ command: %s
 command: %s
 command: %s
 command: %s
-`, Pause, Seek, Reset, Init, Prev, Next, Skip, Sessions, Timer, ConfigSessions, Commands), nil
+command: %s
+command: %s
+command: %s
+command: %s
+command: %s
+command: %s
+`, Pause, Seek, Reset, Init, Prev, Next, Skip, Sessions, Timer, ConfigSessions, Goal, Task, Propose, Vote, Proposals, Participant, Commands), nil
 	default:
 		out, err = "", fmt.Errorf("command not found %q", splited[0])
 		cmd = ""
@@ -113,9 +187,7 @@ func sessionsCmd(timer *timer.PomodoroTimer, args []string) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		if !timer.Config.Hooks.OnSet.Run(timer) {
-			timer.Config.Hooks.OnChange.Run(timer)
-		}
+		timer.Changed()
 	default:
 		return "", WrongNumberOfArgsError{args[0]}
 	}
@@ -129,9 +201,7 @@ func configSessionsCmd(timer *timer.PomodoroTimer, args []string) (string, error
 		if err != nil {
 			return "", err
 		}
-		if !timer.Config.Hooks.OnSet.Run(timer) {
-			timer.Config.Hooks.OnChange.Run(timer)
-		}
+		timer.Changed()
 	default:
 		return "", WrongNumberOfArgsError{args[0]}
 	}
@@ -241,6 +311,35 @@ func timerCmd(timer *timer.PomodoroTimer, args []string) (string, error) {
 	}
 }
 
+func goalCmd(timer *timer.PomodoroTimer, args []string) (string, error) {
+	switch len(args) {
+	case 1:
+		daily := timer.State.Daily
+		return fmt.Sprintf(`pomodoros: %d/%d
+focus: %s/%s
+goal-reached: %t
+streak: %d
+`, daily.Pomodoros, timer.Config.GoalPomodoros, daily.Focus, timer.Config.GoalFocus, daily.GoalReached, daily.Streak), nil
+	default:
+		return "", TooManyArgsError{args[0]}
+	}
+}
+
+// prints the current task without arguments, sets the task to the arguments
+// otherwise. "task -" clears the task
+func taskCmd(timer *timer.PomodoroTimer, args []string) (string, error) {
+	if len(args) == 1 {
+		return fmt.Sprintln(timer.State.Task), nil
+	}
+	task := strings.Join(args[1:], " ")
+	if task == "-" {
+		task = ""
+	}
+	timer.State.Task = task
+	timer.Changed()
+	return "", nil
+}
+
 func initCmd(timer *timer.PomodoroTimer, args []string) (string, error) {
 	switch len(args) {
 	case 1:
@@ -251,6 +350,179 @@ func initCmd(timer *timer.PomodoroTimer, args []string) (string, error) {
 	return "", nil
 }
 
+// proposalOf returns the proposal of the commands that need consensus. ok is
+// false for other commands
+func (s *Session) proposalOf(args []string) (proposal consensus.Proposal, ok bool, err error) {
+	switch args[0] {
+	case Next, Skip, Prev, Reset, Init:
+		if len(args) != 1 {
+			return proposal, true, TooManyArgsError{args[0]}
+		}
+		action := args[0]
+		if action == Skip {
+			action = consensus.Next
+		}
+		proposal, err = consensus.NewProposal(action, 0, 0)
+		return proposal, true, err
+	case Seek:
+		if len(args) != 2 || strings.HasPrefix(args[1], "-") {
+			return proposal, false, nil
+		}
+		duration, err := time.ParseDuration(args[1])
+		if err != nil {
+			return proposal, true, err
+		}
+		// seeking forward is extending the mode
+		if strings.HasPrefix(args[1], "+") {
+			proposal, err = consensus.NewProposal(consensus.Extend, duration, 0)
+			return proposal, true, err
+		}
+		// and so is seeking past the remaining duration
+		if duration <= s.Timer.State.Duration {
+			return proposal, false, nil
+		}
+		proposal, err = consensus.NewProposal(consensus.Seek, duration, 0)
+		return proposal, true, err
+	}
+	return proposal, false, nil
+}
+
+func (s *Session) propose(proposal consensus.Proposal) (string, error) {
+	proposal, err := s.Voting.Propose(s.Participant, proposal)
+	if err != nil {
+		return "", err
+	}
+	s.voted = true
+	return formatProposal(proposal), nil
+}
+
+// formatProposal returns "proposal: <id> <action> <argument> <status>
+// <approvals>/<needed>". argument is "-" for actions without one
+func formatProposal(p consensus.Proposal) string {
+	argument := "-"
+	switch p.Action {
+	case consensus.Extend, consensus.Seek:
+		argument = p.Duration.String()
+	case consensus.Mode:
+		argument = strconv.Itoa(int(p.Mode))
+	}
+	return fmt.Sprintf("proposal: %d %s %s %s %d/%d\n", p.Id, p.Action, argument, p.Status, len(p.Approvals), p.Needed)
+}
+
+var errNoConsensus = errors.New("consensus isn't enabled")
+
+// proposes an action: "propose next", "propose extend 5m", "propose seek 30m"
+// or "propose mode 1"
+func (s *Session) proposeCmd(args []string) (string, error) {
+	if s.Voting == nil {
+		return "", errNoConsensus
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return "", WrongNumberOfArgsError{args[0]}
+	}
+	var duration time.Duration
+	var mode int
+	var err error
+	switch args[1] {
+	case consensus.Extend, consensus.Seek:
+		if len(args) != 3 {
+			return "", WrongNumberOfArgsError{args[0]}
+		}
+		duration, err = time.ParseDuration(args[2])
+	case consensus.Mode:
+		if len(args) != 3 {
+			return "", WrongNumberOfArgsError{args[0]}
+		}
+		mode, err = strconv.Atoi(args[2])
+	default:
+		if len(args) != 2 {
+			return "", TooManyArgsError{args[0]}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	proposal, err := consensus.NewProposal(args[1], duration, timer.PomodoroTimerMode(mode))
+	if err != nil {
+		return "", err
+	}
+	return s.propose(proposal)
+}
+
+// votes on a proposal: "vote 3 1" approves, "vote 3 0" rejects
+func (s *Session) voteCmd(args []string) (string, error) {
+	if s.Voting == nil {
+		return "", errNoConsensus
+	}
+	if len(args) != 3 {
+		return "", WrongNumberOfArgsError{args[0]}
+	}
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return "", err
+	}
+	approve, err := parseBool(args[2])
+	if err != nil {
+		return "", err
+	}
+	proposal, err := s.Voting.Vote(id, s.Participant, approve)
+	if err != nil {
+		return "", err
+	}
+	s.voted = true
+	return formatProposal(proposal), nil
+}
+
+// prints the recent proposals, and the open one
+func (s *Session) proposalsCmd(args []string) (string, error) {
+	if s.Voting == nil {
+		return "", errNoConsensus
+	}
+	if len(args) != 1 {
+		return "", TooManyArgsError{args[0]}
+	}
+	var out string
+	for _, proposal := range s.Voting.Proposals() {
+		out += formatProposal(proposal)
+	}
+	return out, nil
+}
+
+var errPinned = errors.New("participant can't be changed after proposing or voting")
+
+// prints the participant that the client has identified as without arguments,
+// identifies as the argument otherwise: "participant alice <secret>". the
+// secret claims the participant, so only the clients with it can act as the
+// participant. the participant is pinned once it has proposed or voted
+func (s *Session) participantCmd(args []string) (string, error) {
+	switch len(args) {
+	case 1:
+		return fmt.Sprintln(s.Participant), nil
+	case 2, 3:
+		if args[1] == s.Participant {
+			return "", nil
+		}
+		if s.voted {
+			return "", errPinned
+		}
+		if s.Presence != nil {
+			var secret string
+			if len(args) == 3 {
+				secret = args[2]
+			}
+			if err := s.Presence.Join(args[1], secret, "", ""); err != nil {
+				return "", err
+			}
+			s.Close()
+			s.joined = args[1]
+		}
+		s.Participant = args[1]
+		return "", nil
+	default:
+		return "", TooManyArgsError{args[0]}
+	}
+}
+
 func parseBool(input string) (bool, error) {
 	if input != "1" && input != "0" {
 		return false, errors.New("boolean (0/1) expected: \"" + input + "\"")
@@ -259,9 +531,23 @@ func parseBool(input string) (bool, error) {
 }
 
 type Daemon struct {
-	Timer    *timer.PomodoroTimer
+	Timer *timer.PomodoroTimer
+	// optional. actions need consensus when set
+	Voting *consensus.Voting
+	// optional. participants that the clients identify as join it
+	Presence Presence
+	// optional. the actions of the timer that a command makes are attributed
+	// to the participant of its client, until the returned function is
+	// called. its called under the timer's State.Mu
+	Act      func(participant string) (done func())
 	Listener net.Listener
 	ctx      context.Context
+	clients  atomic.Int64
+}
+
+// ClientsCount returns count of the connected clients
+func (d *Daemon) ClientsCount() int64 {
+	return d.clients.Load()
 }
 
 func (d *Daemon) InitializeListener(address string) error {
@@ -275,8 +561,12 @@ func (d *Daemon) InitializeListener(address string) error {
 
 func (d *Daemon) handleConnection(conn net.Conn) {
 	conn.Write([]byte("OK goje " + timer.VERSION + "\n"))
+	d.clients.Add(1)
+	defer d.clients.Add(-1)
 	defer conn.Close()
 	reader := bufio.NewReader(conn)
+	session := &Session{Timer: d.Timer, Voting: d.Voting, Presence: d.Presence}
+	defer session.Close()
 	for {
 		buff, err := reader.ReadString('\n')
 		if err != nil && errors.Is(err, io.EOF) {
@@ -284,7 +574,18 @@ func (d *Daemon) handleConnection(conn net.Conn) {
 		}
 		buff = strings.TrimSpace(buff)
 		if buff != "" {
-			cmd, out, err := ParseInput(d.Timer, buff)
+			// the timer ticks under State.Mu. so do the commands, including the
+			// proposals that are applied as they're approved
+			d.Timer.State.Mu.Lock()
+			var done func()
+			if d.Act != nil {
+				done = d.Act(session.Participant)
+			}
+			cmd, out, err := session.Parse(buff)
+			if done != nil {
+				done()
+			}
+			d.Timer.State.Mu.Unlock()
 			if err != nil {
 				slog.Error("command throw error", "err", err)
 				conn.Write(fmt.Appendf(nil, "ACK {%s} %s\n", cmd, err))
@@ -3,12 +3,18 @@ package tcpd
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/nimaaskarian/goje/consensus"
 	"github.com/nimaaskarian/goje/timer"
 )
 
@@ -99,3 +105,197 @@ func TestPrintAllCommands(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionProposals(t *testing.T) {
+	pomodoro_timer := timer.PomodoroTimer{
+		Config: &timer.DefaultConfig,
+	}
+	pomodoro_timer.Init()
+	voting := consensus.NewVoting(&pomodoro_timer, consensus.DEFAULT_QUORUM, time.Minute)
+	voting.Voters = func() []string { return []string{"alice", "bob"} }
+	alice := Session{Timer: &pomodoro_timer, Voting: voting}
+	bob := Session{Timer: &pomodoro_timer, Voting: voting}
+	alice.Parse("participant alice")
+	bob.Parse("participant bob")
+	if _, out, err := alice.Parse("seek +5m"); err != nil || out != "proposal: 1 extend 5m0s open 1/2\n" {
+		t.Fatalf("seeking forward isn't proposed: %q, err: %v", out, err)
+	}
+	if _, _, err := bob.Parse("next"); err != consensus.ErrOpenProposal {
+		t.Fatalf("another proposal is opened while one is open. err: %v", err)
+	}
+	if _, out, err := bob.Parse("vote 1 1"); err != nil || out != "proposal: 1 extend 5m0s approved 2/2\n" {
+		t.Fatalf("vote: %q, err: %v", out, err)
+	}
+	if pomodoro_timer.State.Duration != timer.DefaultConfig.Duration[timer.Pomodoro]+5*time.Minute {
+		t.Fatalf("approved extension isn't applied: %v", pomodoro_timer.State.Duration)
+	}
+	// seeking past the remaining duration and starting a new cycle are
+	// proposed, seeking back isn't
+	if _, out, err := alice.Parse("seek 1h"); err != nil || out != "proposal: 2 seek 1h0m0s open 1/2\n" {
+		t.Fatalf("seeking past the remaining duration isn't proposed: %q, err: %v", out, err)
+	}
+	bob.Parse("vote 2 0")
+	alice.Parse("vote 2 0")
+	if _, out, err := alice.Parse("init"); err != nil || out != "proposal: 3 init - open 1/2\n" {
+		t.Fatalf("init isn't proposed: %q, err: %v", out, err)
+	}
+	bob.Parse("vote 3 0")
+	if _, out, err := alice.Parse("seek 1m"); err != nil || out != "" || pomodoro_timer.State.Duration != time.Minute {
+		t.Fatalf("seeking back is proposed: %q, err: %v", out, err)
+	}
+}
+
+func TestSessionIdentity(t *testing.T) {
+	pomodoro_timer := timer.PomodoroTimer{
+		Config: &timer.DefaultConfig,
+	}
+	pomodoro_timer.Init()
+	voting := consensus.NewVoting(&pomodoro_timer, consensus.DEFAULT_QUORUM, time.Minute)
+	presence := &testPresence{}
+	voting.Voters = func() []string { return presence.ids }
+	presence.Join("carol", "", "", "")
+	mallory := Session{Timer: &pomodoro_timer, Voting: voting, Presence: presence}
+	if _, _, err := mallory.Parse("next"); err != consensus.ErrAnonymous {
+		t.Fatalf("anonymous proposal. err: %v", err)
+	}
+	if _, _, err := mallory.Parse("participant carol guess"); err == nil || mallory.Participant != "" {
+		t.Fatalf("client identified as a participant that is claimed with another secret. err: %v", err)
+	}
+	mallory.Parse("participant a")
+	if _, out, err := mallory.Parse("next"); err != nil || out != "proposal: 1 next - open 1/2\n" {
+		t.Fatalf("next isn't proposed: %q, err: %v", out, err)
+	}
+	// one client can't approve its proposal as another participant
+	if _, _, err := mallory.Parse("participant b"); err != errPinned {
+		t.Fatalf("participant is changed after proposing. err: %v", err)
+	}
+	if _, _, err := mallory.Parse("vote 1 1"); err != nil || pomodoro_timer.State.Mode != timer.Pomodoro {
+		t.Fatalf("proposal is approved by its proposer alone. err: %v", err)
+	}
+	mallory.Close()
+	if !slices.Equal(presence.ids, []string{"carol"}) {
+		t.Fatalf("participants are %q after the client is closed", presence.ids)
+	}
+}
+
+type testPresence struct {
+	ids []string
+}
+
+func (p *testPresence) Join(id, secret, name, task string) error {
+	if id == "carol" && secret != "" {
+		return errors.New("carol is claimed")
+	}
+	p.ids = append(p.ids, id)
+	return nil
+}
+
+func (p *testPresence) Leave(id string) {
+	p.ids = slices.DeleteFunc(p.ids, func(s string) bool { return s == id })
+}
+
+func TestClient(t *testing.T) {
+	pomodoro_timer := timer.PomodoroTimer{
+		Config: &timer.DefaultConfig,
+	}
+	pomodoro_timer.Init()
+	daemon := Daemon{Timer: &pomodoro_timer}
+	if err := daemon.InitializeListener("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go daemon.Run(ctx)
+
+	client, err := Dial(daemon.Listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if client.Version != timer.VERSION {
+		t.Fatalf("version of the greeting: %q", client.Version)
+	}
+	if out, err := client.Command("task writing tests"); err != nil || out != "" {
+		t.Fatalf("task: %q, err: %v", out, err)
+	}
+	if out, err := client.Command("task"); err != nil || out != "writing tests\n" {
+		t.Fatalf("task: %q, err: %v", out, err)
+	}
+	var ack AckError
+	if _, err := client.Command("seek forever"); !errors.As(err, &ack) || ack.Command != Seek {
+		t.Fatalf("invalid seek isn't acknowledged as an error: %#v", err)
+	}
+	if _, err := client.Command("unknown"); !errors.As(err, &ack) || ack.Command != "" || !strings.Contains(ack.Message, "command not found") {
+		t.Fatalf("unknown command isn't acknowledged as an error: %#v", err)
+	}
+	// the connection is still usable after errors
+	if _, err := client.Command("pause 1"); err != nil || !pomodoro_timer.State.Paused {
+		t.Fatalf("pause: %v", err)
+	}
+}
+
+func TestDaemonAct(t *testing.T) {
+	pomodoro_timer := timer.PomodoroTimer{
+		Config: &timer.DefaultConfig,
+	}
+	pomodoro_timer.Init()
+	var acts []string
+	daemon := Daemon{Timer: &pomodoro_timer, Presence: &testPresence{}}
+	daemon.Act = func(participant string) func() {
+		paused := pomodoro_timer.State.Paused
+		return func() {
+			if pomodoro_timer.State.Paused != paused {
+				acts = append(acts, participant)
+			}
+		}
+	}
+	if err := daemon.InitializeListener("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go daemon.Run(ctx)
+
+	client, err := Dial(daemon.Listener.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, command := range []string{"pause 1", "participant alice", "pause 0"} {
+		if _, err := client.Command(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	// Act runs under the timer's lock
+	pomodoro_timer.State.Mu.Lock()
+	defer pomodoro_timer.State.Mu.Unlock()
+	if !slices.Equal(acts, []string{"", "alice"}) {
+		t.Fatalf("actions are attributed to %q", acts)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// greets, and never responds to commands
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, "OK goje "+timer.VERSION)
+		io.Copy(io.Discard, conn)
+	}()
+	client, err := Dial(listener.Addr().String(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Command("status"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("command that isn't responded doesn't time out: %v", err)
+	}
+}
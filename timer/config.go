@@ -14,6 +14,12 @@ type TimerConfigHooks struct {
 	OnPause TimerConfigHook `json:"-"`
 	OnQuit  TimerConfigHook `json:"-"`
 	OnInit  TimerConfigHook `json:"-"`
+	// runs when user skips to the next mode, before skipping
+	OnSkip TimerConfigHook `json:"-"`
+	// runs when user resets the current mode, before resetting
+	OnReset TimerConfigHook `json:"-"`
+	// runs once a day, when daily progress reaches the goal
+	OnGoalReached TimerConfigHook `json:"-"`
 }
 
 type TimerConfig struct {
@@ -22,6 +28,12 @@ type TimerConfig struct {
 	Hooks           TimerConfigHooks        `json:"-"`
 	Paused          bool                    `mapstructure:"paused,omitempty"`
 	DurationPerTick time.Duration           `mapstructure:"duration-per-tick"`
+	// daily goal of finished pomodoros. zero means no goal
+	GoalPomodoros uint `mapstructure:"goal-pomodoros,omitempty"`
+	// daily goal of time spent in pomodoros. zero means no goal
+	GoalFocus time.Duration `mapstructure:"goal-focus,omitempty"`
+	// time after midnight that a new day starts at
+	DayBoundary time.Duration `mapstructure:"day-boundary,omitempty"`
 }
 
 var DefaultConfig = TimerConfig{
@@ -39,15 +51,31 @@ var DefaultConfig = TimerConfig{
 type TimerConfigHook struct {
 	OnEvent     []func(*PomodoroTimer)
 	OnEventOnce []func(*PomodoroTimer)
+	// optional. while it returns false, the hook doesn't run
+	Enabled func() bool
 }
 
 func (e *TimerConfigHook) Append(handler func(*PomodoroTimer)) {
 	e.OnEvent = append(e.OnEvent, func(pt *PomodoroTimer) { go handler(pt) })
 }
 
-// this is non-blocking (goroutine). it iterates through all the events and goroutines them.
+// AppendSync appends a handler that blocks the timer while running. keep it
+// short
+func (e *TimerConfigHook) AppendSync(handler func(*PomodoroTimer)) {
+	e.OnEvent = append(e.OnEvent, handler)
+}
+
+// this is non-blocking, except for the handlers of AppendSync. handlers of
+// Append and OnEventOnce run in goroutines
 func (e *TimerConfigHook) Run(t *PomodoroTimer) (ran bool) {
-	for _, handler := range append(e.OnEvent, e.OnEventOnce...) {
+	if e.Enabled != nil && !e.Enabled() {
+		return false
+	}
+	for _, handler := range e.OnEvent {
+		handler(t)
+		ran = true
+	}
+	for _, handler := range e.OnEventOnce {
 		go handler(t)
 		ran = true
 	}
@@ -57,6 +85,9 @@ func (e *TimerConfigHook) Run(t *PomodoroTimer) (ran bool) {
 
 // blocking version of Run(). uses no goroutines
 func (e *TimerConfigHook) RunSync(t *PomodoroTimer) (ran bool) {
+	if e.Enabled != nil && !e.Enabled() {
+		return false
+	}
 	for _, handler := range append(e.OnEvent, e.OnEventOnce...) {
 		handler(t)
 		ran = true
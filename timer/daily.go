@@ -0,0 +1,69 @@
+package timer
+
+import (
+	"log/slog"
+	"time"
+)
+
+// now is used instead of time.Now across daily progress, so it can be faked
+// in tests
+var now = time.Now
+
+// DailyProgress is the progress toward the daily goal. its a part of the
+// state, so its carried across restarts with the statefile
+type DailyProgress struct {
+	// start of the day that this progress belongs to
+	Day time.Time
+	// count of pomodoros that reached their end on this day (skips don't count)
+	Pomodoros uint
+	// time spent in unpaused pomodoros on this day
+	Focus       time.Duration
+	GoalReached bool
+	// count of consecutive days (including today) that the goal was reached
+	Streak uint
+}
+
+// DayStart returns the start of the day that t is in. days start at boundary
+// after midnight (a boundary of 4h means days start at 04:00)
+func DayStart(t time.Time, boundary time.Duration) time.Time {
+	y, m, d := t.Add(-boundary).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(boundary)
+}
+
+func (config *TimerConfig) HasGoal() bool {
+	return config.GoalPomodoros != 0 || config.GoalFocus != 0
+}
+
+// rollDay resets the daily progress when the day boundary is crossed. the
+// streak only survives if the goal of the day before was reached
+func (pt *PomodoroTimer) rollDay() {
+	daily := &pt.State.Daily
+	day := DayStart(now(), pt.Config.DayBoundary)
+	if daily.Day.Equal(day) {
+		return
+	}
+	// 36 hours after a day's start is always in the next day, even with DST
+	if !daily.GoalReached || !DayStart(daily.Day.Add(36*time.Hour), pt.Config.DayBoundary).Equal(day) {
+		daily.Streak = 0
+	}
+	slog.Info("new day started. resetting daily progress", "day", day)
+	daily.Day = day
+	daily.Pomodoros = 0
+	daily.Focus = 0
+	daily.GoalReached = false
+}
+
+// checkGoal marks the goal as reached and runs OnGoalReached, the first time
+// that daily progress meets the configured goal
+func (pt *PomodoroTimer) checkGoal() {
+	daily := &pt.State.Daily
+	if daily.GoalReached || !pt.Config.HasGoal() {
+		return
+	}
+	if daily.Pomodoros >= pt.Config.GoalPomodoros && daily.Focus >= pt.Config.GoalFocus {
+		daily.GoalReached = true
+		daily.Streak++
+		slog.Info("daily goal reached", "pomodoros", daily.Pomodoros, "focus", daily.Focus, "streak", daily.Streak)
+		pt.Config.Hooks.OnGoalReached.Run(pt)
+	}
+}
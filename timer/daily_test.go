@@ -0,0 +1,90 @@
+package timer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDayStart(t *testing.T) {
+	boundary := 4 * time.Hour
+	for _, item := range []struct {
+		at, expected time.Time
+	}{
+		{time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC), time.Date(2025, 5, 10, 4, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 5, 10, 4, 0, 0, 0, time.UTC), time.Date(2025, 5, 10, 4, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 5, 10, 3, 59, 0, 0, time.UTC), time.Date(2025, 5, 9, 4, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 5, 1, 1, 0, 0, 0, time.UTC), time.Date(2025, 4, 30, 4, 0, 0, 0, time.UTC)},
+	} {
+		if day := DayStart(item.at, boundary); !day.Equal(item.expected) {
+			t.Fatalf("day start of %s is %s. expected %s", item.at, day, item.expected)
+		}
+	}
+}
+
+func TestDailyGoal(t *testing.T) {
+	var config = DefaultConfig
+	config.DurationPerTick = time.Millisecond * 10
+	config.Duration[Pomodoro] = 2 * config.DurationPerTick
+	config.Duration[ShortBreak] = config.DurationPerTick
+	config.GoalPomodoros = 2
+	config.GoalFocus = 4 * config.DurationPerTick
+	reached := make(chan uint, 1)
+	config.Hooks.OnGoalReached.Append(func(pt *PomodoroTimer) {
+		reached <- pt.State.Daily.Streak
+	})
+
+	timer := PomodoroTimer{
+		Config: &config,
+	}
+	timer.Init()
+	for timer.State.Daily.Pomodoros < 2 {
+		timer.beforeTick()
+		if timer.State.Daily.GoalReached && timer.State.Daily.Pomodoros < 2 {
+			t.Fatal("goal reached before finishing enough pomodoros")
+		}
+		timer.tick()
+	}
+	if timer.State.Daily.Focus != config.GoalFocus {
+		t.Fatalf("focus %s != %s", timer.State.Daily.Focus, config.GoalFocus)
+	}
+	select {
+	case streak := <-reached:
+		if streak != 1 {
+			t.Fatalf("streak %d != 1", streak)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnGoalReached didn't run")
+	}
+}
+
+func TestRollDay(t *testing.T) {
+	defer func() { now = time.Now }()
+	var config = DefaultConfig
+	config.GoalPomodoros = 1
+	timer := PomodoroTimer{
+		Config: &config,
+	}
+	day := time.Date(2025, 5, 10, 12, 0, 0, 0, time.Local)
+	now = func() time.Time { return day }
+	timer.rollDay()
+	timer.State.Daily.Pomodoros = 1
+	timer.checkGoal()
+	if timer.State.Daily.Streak != 1 {
+		t.Fatalf("streak %d != 1", timer.State.Daily.Streak)
+	}
+
+	now = func() time.Time { return day.AddDate(0, 0, 1) }
+	timer.rollDay()
+	if timer.State.Daily.Pomodoros != 0 || timer.State.Daily.GoalReached {
+		t.Fatal("daily progress isn't reset on a new day", timer.State.Daily)
+	}
+	if timer.State.Daily.Streak != 1 {
+		t.Fatalf("streak %d != 1 on the day after reaching the goal", timer.State.Daily.Streak)
+	}
+
+	now = func() time.Time { return day.AddDate(0, 0, 3) }
+	timer.rollDay()
+	if timer.State.Daily.Streak != 0 {
+		t.Fatalf("streak %d != 0 after a day without reaching the goal", timer.State.Daily.Streak)
+	}
+}
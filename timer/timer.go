@@ -25,7 +25,13 @@ type PomodoroTimerState struct {
 	Mode             PomodoroTimerMode
 	FinishedSessions uint
 	Paused           bool
-	Mu               sync.Mutex `json:"-"`
+	Daily            DailyProgress
+	// what is being worked on. shows up in history
+	Task string
+	// incremented on every change, except for ticks. used for optimistic
+	// concurrency of clients
+	Version uint64
+	Mu      sync.Mutex `json:"-"`
 }
 
 func (state *PomodoroTimerState) IsZero() bool {
@@ -40,7 +46,20 @@ type PomodoroTimer struct {
 	State  PomodoroTimerState
 }
 
+// Reset resets the current mode on user's request. use SetMode for resetting
+// the timer as a part of setting its mode
 func (pt *PomodoroTimer) Reset() {
+	pt.Config.Hooks.OnReset.Run(pt)
+	pt.reset()
+}
+
+// SetMode sets the mode of timer, and resets it to the mode's duration
+func (pt *PomodoroTimer) SetMode(mode PomodoroTimerMode) {
+	pt.State.Mode = mode
+	pt.reset()
+}
+
+func (pt *PomodoroTimer) reset() {
 	slog.Info("timer reseted.", "new time", pt.Config.Duration[pt.State.Mode].String())
 	pt.SeekTo(pt.Config.Duration[pt.State.Mode])
 	if !pt.Config.Hooks.OnSet.Run(pt) {
@@ -48,12 +67,14 @@ func (pt *PomodoroTimer) Reset() {
 	}
 	if pt.State.Paused {
 		pt.Config.Hooks.OnPause.OnEventOnce = []func(*PomodoroTimer){func(pt *PomodoroTimer) {
+			pt.State.Mu.Lock()
+			defer pt.State.Mu.Unlock()
 			if !pt.State.Paused && !pt.Config.Hooks.OnSet.Run(pt) {
-				pt.Config.Hooks.OnModeStart.Run(pt)
+				pt.Config.Hooks.OnModeStart.RunSync(pt)
 			}
 		}}
 	} else if !pt.Config.Hooks.OnSet.Run(pt) {
-		pt.Config.Hooks.OnModeStart.Run(pt)
+		pt.Config.Hooks.OnModeStart.RunSync(pt)
 	}
 }
 
@@ -61,12 +82,13 @@ func (pt *PomodoroTimer) Init() {
 	pt.State.Mode = Pomodoro
 	pt.State.FinishedSessions = 0
 	pt.State.Paused = pt.Config.Paused
-	pt.Reset()
+	pt.reset()
 	pt.Config.Hooks.OnInit.Run(pt)
 }
 
 func (pt *PomodoroTimer) Pause(pauseValue bool) {
 	pt.State.Paused = pauseValue
+	pt.State.Version++
 	if !pt.Config.Hooks.OnSet.Run(pt) {
 		pt.Config.Hooks.OnPause.Run(pt)
 	}
@@ -78,6 +100,13 @@ func (pt *PomodoroTimer) TogglePause() {
 
 func (pt *PomodoroTimer) SeekTo(duration time.Duration) {
 	pt.State.Duration = duration
+	pt.Changed()
+}
+
+// Changed bumps the state's version and runs the change hooks. use it after
+// changing the timer directly, instead of using its methods
+func (pt *PomodoroTimer) Changed() {
+	pt.State.Version++
 	if !pt.Config.Hooks.OnSet.Run(pt) {
 		pt.Config.Hooks.OnChange.Run(pt)
 	}
@@ -93,12 +122,33 @@ func (pt *PomodoroTimer) SeekAdd(duration time.Duration) {
 }
 
 func (pt *PomodoroTimer) beforeTick() {
+	pt.rollDay()
 	if pt.State.Duration <= 0 {
+		if pt.State.Mode == Pomodoro {
+			pt.State.Daily.Pomodoros++
+			pt.checkGoal()
+		}
 		// timer before executing OnModeRun, so SwitchNextMode wouldn'pt
 		// change the timer reference during the call.
-		t_copy := *pt
-		pt.Config.Hooks.OnModeEnd.Run(&t_copy)
-		pt.SwitchNextMode()
+		pt.Config.Hooks.OnModeEnd.RunSync(pt.copy())
+		pt.switchNextMode()
+	}
+}
+
+// copy returns a copy of the timer, with a mutex of its own. pt.State.Mu is
+// held while copying, so copying it would leave the copy locked
+func (pt *PomodoroTimer) copy() *PomodoroTimer {
+	return &PomodoroTimer{
+		Config: pt.Config,
+		State: PomodoroTimerState{
+			Duration:         pt.State.Duration,
+			Mode:             pt.State.Mode,
+			FinishedSessions: pt.State.FinishedSessions,
+			Paused:           pt.State.Paused,
+			Daily:            pt.State.Daily,
+			Task:             pt.State.Task,
+			Version:          pt.State.Version,
+		},
 	}
 }
 
@@ -107,26 +157,41 @@ func (pt *PomodoroTimer) tick() {
 		return
 	}
 	pt.State.Duration -= pt.Config.DurationPerTick
+	if pt.State.Mode == Pomodoro {
+		pt.State.Daily.Focus += pt.Config.DurationPerTick
+		pt.checkGoal()
+	}
 	pt.Config.Hooks.OnChange.Run(pt)
 }
 
-// Halts the current thread until ctx is Done. Use in a goroutine.
+// Halts the current thread until ctx is Done. Use in a goroutine. ticks hold
+// State.Mu, so lock it to change the timer from other goroutines
 func (pt *PomodoroTimer) Loop(ctx context.Context) {
 	slog.Info("timer loop started")
 	timer := time.NewTimer(pt.Config.DurationPerTick)
 	for {
+		pt.State.Mu.Lock()
 		pt.beforeTick()
+		pt.State.Mu.Unlock()
 		select {
 		case <-ctx.Done():
 			return
 		case <-timer.C:
+			pt.State.Mu.Lock()
 			pt.tick()
+			pt.State.Mu.Unlock()
 			timer.Reset(pt.Config.DurationPerTick)
 		}
 	}
 }
 
+// SwitchNextMode skips to the next mode on user's request
 func (pt *PomodoroTimer) SwitchNextMode() {
+	pt.Config.Hooks.OnSkip.Run(pt)
+	pt.switchNextMode()
+}
+
+func (pt *PomodoroTimer) switchNextMode() {
 	switch pt.State.Mode {
 	case Pomodoro:
 		pt.State.FinishedSessions++
@@ -141,7 +206,7 @@ func (pt *PomodoroTimer) SwitchNextMode() {
 	case ShortBreak:
 		pt.State.Mode = Pomodoro
 	}
-	pt.Reset()
+	pt.reset()
 }
 
 func (pt *PomodoroTimer) SwitchPrevMode() {
@@ -164,7 +229,7 @@ func (pt *PomodoroTimer) SwitchPrevMode() {
 		}
 		pt.State.Mode = Pomodoro
 	}
-	pt.Reset()
+	pt.reset()
 }
 
 func (pt *PomodoroTimer) String() string {
@@ -88,6 +88,34 @@ func TestTimer(t *testing.T) {
 	}
 }
 
+func TestModeEnd(t *testing.T) {
+	var config = DefaultConfig
+	config.DurationPerTick = time.Millisecond * 10
+	config.Duration[Pomodoro] = 2 * config.DurationPerTick
+	ended := make(chan PomodoroTimerMode, 1)
+	// end hooks lock the timer they're given, like the hooks of the daemons
+	config.Hooks.OnModeEnd.Append(func(pt *PomodoroTimer) {
+		pt.State.Mu.Lock()
+		defer pt.State.Mu.Unlock()
+		ended <- pt.State.Mode
+	})
+	timer := PomodoroTimer{
+		Config: &config,
+	}
+	timer.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go timer.Loop(ctx)
+	select {
+	case mode := <-ended:
+		if mode != Pomodoro {
+			t.Fatalf("end hook got the timer in %s", mode)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("end hook didn't run")
+	}
+}
+
 func ExamplePomodoroTimer_String() {
 	timer := PomodoroTimer{
 		Config: &DefaultConfig,
@@ -105,3 +133,28 @@ func ExamplePomodoroTimer_String() {
 	// 3h8m10s
 	// 50s
 }
+
+func TestHookEnabled(t *testing.T) {
+	var config = DefaultConfig
+	enabled := false
+	config.Hooks.OnSet.Enabled = func() bool { return enabled }
+	config.Hooks.OnSet.OnEvent = []func(*PomodoroTimer){func(*PomodoroTimer) {}}
+	changed := make(chan struct{}, 2)
+	config.Hooks.OnChange.OnEvent = []func(*PomodoroTimer){func(*PomodoroTimer) { changed <- struct{}{} }}
+	timer := PomodoroTimer{
+		Config: &config,
+	}
+	timer.Changed()
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("change hooks didn't run while set hook is disabled")
+	}
+	enabled = true
+	timer.Changed()
+	select {
+	case <-changed:
+		t.Fatal("change hooks ran while set hook is enabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nimaaskarian/goje/history"
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/r3labs/sse/v2"
+	"golang.org/x/term"
+)
+
+const (
+	// switches to the alternate screen and hides the cursor
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	// time between redraws without events, that also picks up resizes
+	redrawInterval = 500 * time.Millisecond
+)
+
+// client sends requests to the http daemon at address
+type client struct {
+	address string
+	http    http.Client
+}
+
+// do sends the action, and decodes the response into res if its not nil. the
+// error of an error response is the error that the daemon has responded with
+func (c *client) do(action Action, res any) (status int, err error) {
+	var body io.Reader
+	if action.Body != nil {
+		content, err := json.Marshal(action.Body)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(action.Method, c.address+action.Route, body)
+	if err != nil {
+		return 0, err
+	}
+	if action.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var res httpd.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil || res.Error == "" {
+			return resp.StatusCode, errors.New(resp.Status)
+		}
+		return resp.StatusCode, errors.New(res.Error)
+	}
+	if res != nil {
+		err = json.NewDecoder(resp.Body).Decode(res)
+	}
+	return resp.StatusCode, err
+}
+
+// apply sends the action to the v1 api, and shows its error or proposal
+func (c *client) apply(m *Model, action Action) {
+	action.Route = "/api/v1" + action.Route
+	var proposal httpd.ProposalResponse
+	status, err := c.do(action, &proposal)
+	switch {
+	case err != nil:
+		m.Message = err.Error()
+	case status == http.StatusAccepted:
+		m.Message = fmt.Sprintf("proposed %s. %d/%d approvals", proposal.Action, len(proposal.Approvals), proposal.Needed)
+	}
+}
+
+// history returns the finished modes. nil if the daemon doesn't keep them
+func (c *client) history() []history.Session {
+	var sessions []history.Session
+	if _, err := c.do(Action{Method: http.MethodGet, Route: "/api/history"}, &sessions); err != nil {
+		return nil
+	}
+	return sessions
+}
+
+// Run shows the tui of the daemon at address (its http url, with the base
+// path) on the terminal, until its quit or ctx is done
+func Run(ctx context.Context, address string) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("tui requires a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	os.Stdout.WriteString(enterScreen)
+	defer os.Stdout.WriteString(leaveScreen)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := &client{address: strings.TrimSuffix(address, "/"), http: http.Client{Timeout: 5 * time.Second}}
+	m := &Model{Address: c.address}
+
+	events := make(chan *sse.Event)
+	// nil when the stream is connected, the error when its disconnected
+	connection := make(chan error)
+	notify := func(err error) {
+		select {
+		case connection <- err:
+		case <-ctx.Done():
+		}
+	}
+	stream := sse.NewClient(c.address + "/api/v1/timer/stream")
+	stream.OnConnect(func(*sse.Client) { notify(nil) })
+	stream.OnDisconnect(func(*sse.Client) { notify(errors.New("stream is disconnected")) })
+	stream.ReconnectNotify = func(err error, next time.Duration) { notify(err) }
+	stream_err := make(chan error, 1)
+	go func() {
+		stream_err <- stream.SubscribeRawWithContext(ctx, func(msg *sse.Event) {
+			select {
+			case events <- msg:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case keys <- string(buf[:n]):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	for {
+		draw(os.Stdout, fd, m)
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-stream_err:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case err := <-connection:
+			m.Connected = err == nil
+			if m.Connected {
+				m.History = c.history()
+			}
+		case msg := <-events:
+			switch string(msg.Event) {
+			case "change", "start", "end", "pause", "goal":
+				json.Unmarshal(msg.Data, &m.Timer)
+			}
+			if string(msg.Event) == "end" {
+				m.History = c.history()
+			}
+		case key := <-keys:
+			action, quit := m.Key(key)
+			if quit {
+				return nil
+			}
+			if action != nil {
+				c.apply(m, *action)
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw draws the model on the whole terminal
+func draw(w io.Writer, fd int, m *Model) {
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		width, height = 80, 24
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range m.Render(width, height) {
+		if i != 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		// clears the rest of the line
+		b.WriteString("\x1b[K")
+	}
+	// clears the rest of the screen
+	b.WriteString("\x1b[J")
+	io.WriteString(w, b.String())
+}
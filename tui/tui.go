@@ -0,0 +1,285 @@
+// Package tui is a full-screen terminal client of the http daemon
+package tui
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nimaaskarian/goje/history"
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+// duration that the arrow keys seek by
+const SEEK_STEP = time.Minute
+
+// ansi escape sequences
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	dim    = "\x1b[2m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	blue   = "\x1b[34m"
+)
+
+// colors of the modes, by their snake_case names
+var modeColors = map[string]string{
+	timer.Pomodoro.SnakeCase():   red,
+	timer.ShortBreak.SnakeCase(): green,
+	timer.LongBreak.SnakeCase():  blue,
+}
+
+// font of the countdown. each glyph is 3 cells wide and 5 rows high
+var font = map[rune][5]string{
+	'0': {"###", "# #", "# #", "# #", "###"},
+	'1': {"  #", "  #", "  #", "  #", "  #"},
+	'2': {"###", "  #", "###", "#  ", "###"},
+	'3': {"###", "  #", "###", "  #", "###"},
+	'4': {"# #", "# #", "###", "  #", "  #"},
+	'5': {"###", "#  ", "###", "  #", "###"},
+	'6': {"###", "#  ", "###", "# #", "###"},
+	'7': {"###", "  #", "  #", "  #", "  #"},
+	'8': {"###", "# #", "###", "# #", "###"},
+	'9': {"###", "# #", "###", "  #", "###"},
+	':': {" ", "#", " ", "#", " "},
+}
+
+// Action is a request to the v1 api, that a key is bound to
+type Action struct {
+	Method, Route string
+	// nil if the request has no body
+	Body any
+}
+
+// Model is what the tui shows
+type Model struct {
+	// http url of the daemon
+	Address   string
+	Timer     httpd.TimerResponse
+	History   []history.Session
+	Connected bool
+	// shown under the timer, until the next key. errors of the daemon for
+	// example
+	Message string
+	// the task is being edited. Input is the text that's typed
+	Editing bool
+	Input   string
+}
+
+// Key handles a key press (the bytes that are read from the terminal at once).
+// it returns the action of the key if it has one, and quit if the tui should
+// be closed
+func (m *Model) Key(key string) (action *Action, quit bool) {
+	if m.Editing {
+		return m.editKey(key), false
+	}
+	m.Message = ""
+	switch key {
+	case "q", "\x03":
+		return nil, true
+	case " ", "p":
+		paused := !m.Timer.Paused
+		return &Action{http.MethodPost, "/timer/pause", httpd.PauseRequest{Paused: &paused}}, false
+	case "n":
+		return &Action{http.MethodPost, "/timer/next", nil}, false
+	case "b", "N":
+		return &Action{http.MethodPost, "/timer/prev", nil}, false
+	case "r":
+		return &Action{http.MethodPost, "/timer/reset", nil}, false
+	case "l", "+", "\x1b[C":
+		return seekAction(SEEK_STEP), false
+	case "h", "-", "\x1b[D":
+		return seekAction(-SEEK_STEP), false
+	case "t":
+		m.Editing = true
+		m.Input = m.Timer.Task
+	}
+	return nil, false
+}
+
+func seekAction(duration time.Duration) *Action {
+	return &Action{http.MethodPost, "/timer/seek", httpd.SeekRequest{Duration: (*httpd.Duration)(&duration), Relative: true}}
+}
+
+// editKey handles a key while the task is being edited. enter sets the task,
+// escape cancels editing
+func (m *Model) editKey(key string) *Action {
+	switch key {
+	case "\r", "\n":
+		m.Editing = false
+		return &Action{http.MethodPut, "/timer/task", httpd.TaskRequest{Task: m.Input}}
+	case "\x1b", "\x03":
+		m.Editing = false
+	case "\x7f", "\b":
+		if _, size := utf8.DecodeLastRuneInString(m.Input); size > 0 {
+			m.Input = m.Input[:len(m.Input)-size]
+		}
+	default:
+		// escape sequences of the other keys are ignored
+		if strings.HasPrefix(key, "\x1b") {
+			return nil
+		}
+		m.Input += strings.Map(func(r rune) rune {
+			if unicode.IsPrint(r) {
+				return r
+			}
+			return -1
+		}, key)
+	}
+	return nil
+}
+
+// Render returns the lines of the screen, for a terminal of width and height
+func (m *Model) Render(width, height int) []string {
+	var lines []string
+	add := func(line string) {
+		lines = append(lines, line)
+	}
+	color := modeColors[m.Timer.Mode]
+
+	if !m.Connected {
+		add(center(yellow, "disconnected from "+m.Address+". reconnecting", width))
+	} else {
+		add("")
+	}
+	title := m.Timer.ModeName
+	if m.Timer.Paused {
+		title += " (paused)"
+	}
+	add(center(bold+color, title, width))
+	add("")
+	for _, row := range bigText(countdown(time.Duration(m.Timer.Remaining))) {
+		add(center(color, row, width))
+	}
+	add("")
+
+	bar_width := max(min(width-10, 50), 10)
+	add(center(color, progressBar(m.progress(), bar_width), width))
+	add(center(dim, m.sessions(), width))
+	add("")
+
+	switch {
+	case m.Editing:
+		add(center(bold, "task: "+m.Input+"_", width))
+	case m.Timer.Task != "":
+		add(center("", "task: "+m.Timer.Task, width))
+	default:
+		add(center(dim, "no task", width))
+	}
+	if m.Message != "" {
+		add(center(red, m.Message, width))
+	} else {
+		add("")
+	}
+
+	help := "space pause  n next  b prev  ←/→ seek 1m  r reset  t task  q quit"
+	if m.Editing {
+		help = "enter set task  esc cancel"
+	}
+	// history takes what's left of the height, above the help
+	rows := height - len(lines) - 3
+	if rows > 0 && len(m.History) != 0 {
+		add("")
+		add(center(bold, "history", width))
+		for i := len(m.History) - 1; i >= 0 && rows > 0; i-- {
+			add(center("", formatSession(m.History[i]), width))
+			rows--
+		}
+	}
+	for len(lines) < height-1 {
+		add("")
+	}
+	add(center(dim, help, width))
+	return lines[:min(len(lines), max(height, 0))]
+}
+
+// progress returns the fraction of the current mode that has passed
+func (m *Model) progress() float64 {
+	total := m.Timer.Durations[m.Timer.Mode]
+	if total <= 0 {
+		return 0
+	}
+	return min(max(1-float64(m.Timer.Remaining)/float64(total), 0), 1)
+}
+
+// sessions returns the finished sessions of the cycle as dots
+func (m *Model) sessions() string {
+	var b strings.Builder
+	for i := range m.Timer.Sessions {
+		if i != 0 {
+			b.WriteRune(' ')
+		}
+		if i < m.Timer.FinishedSessions {
+			b.WriteRune('●')
+		} else {
+			b.WriteRune('○')
+		}
+	}
+	return fmt.Sprintf("%s  %d/%d", b.String(), m.Timer.FinishedSessions, m.Timer.Sessions)
+}
+
+func formatSession(s history.Session) string {
+	line := fmt.Sprintf("%s %s-%s  %-11s", s.Start.Format("Jan 02"), s.Start.Format("15:04"), s.End.Format("15:04"), s.Mode)
+	if s.Task != "" {
+		line += "  " + s.Task
+	}
+	return line
+}
+
+// countdown formats the duration as mm:ss, or h:mm:ss if its an hour or more
+func countdown(d time.Duration) string {
+	seconds := max(int(d.Seconds()), 0)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// bigText returns the rows of text in the font. each cell of the font is
+// drawn two columns wide, so the digits are about square
+func bigText(text string) [5]string {
+	var rows [5]string
+	for i, r := range text {
+		glyph, ok := font[r]
+		if !ok {
+			continue
+		}
+		for row := range rows {
+			if i != 0 {
+				rows[row] += "  "
+			}
+			for _, cell := range glyph[row] {
+				if cell == '#' {
+					rows[row] += "██"
+				} else {
+					rows[row] += "  "
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func progressBar(fraction float64, width int) string {
+	filled := int(fraction * float64(width))
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + fmt.Sprintf(" %3d%%", int(fraction*100))
+}
+
+// center pads line to the center of width, in the style (an ansi sequence).
+// lines wider than width are cut
+func center(style, line string, width int) string {
+	if runes := []rune(line); len(runes) > width {
+		line = string(runes[:max(width, 0)])
+	}
+	padding := max((width-utf8.RuneCountInString(line))/2, 0)
+	if style == "" {
+		return strings.Repeat(" ", padding) + line
+	}
+	return strings.Repeat(" ", padding) + style + line + reset
+}
@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nimaaskarian/goje/history"
+	"github.com/nimaaskarian/goje/httpd"
+	"github.com/nimaaskarian/goje/timer"
+)
+
+func newModel() *Model {
+	return &Model{
+		Connected: true,
+		Timer: httpd.TimerResponse{
+			Mode:             timer.Pomodoro.SnakeCase(),
+			ModeName:         timer.Pomodoro.String(),
+			Remaining:        httpd.Duration(12*time.Minute + 34*time.Second),
+			Sessions:         4,
+			FinishedSessions: 1,
+			Durations:        map[string]httpd.Duration{timer.Pomodoro.SnakeCase(): httpd.Duration(25 * time.Minute)},
+			Task:             "writing tests",
+		},
+	}
+}
+
+func TestKeys(t *testing.T) {
+	m := newModel()
+	action, _ := m.Key(" ")
+	if action == nil || action.Route != "/timer/pause" || !*action.Body.(httpd.PauseRequest).Paused {
+		t.Fatalf("space doesn't pause the running timer: %+v", action)
+	}
+	action, _ = m.Key("\x1b[D")
+	if seek := action.Body.(httpd.SeekRequest); time.Duration(*seek.Duration) != -SEEK_STEP || !seek.Relative {
+		t.Fatalf("left arrow doesn't seek backward: %+v", seek)
+	}
+	if action, _ = m.Key("n"); action.Method != http.MethodPost || action.Route != "/timer/next" {
+		t.Fatalf("n doesn't skip: %+v", action)
+	}
+	if _, quit := m.Key("q"); !quit {
+		t.Fatal("q doesn't quit")
+	}
+}
+
+func TestEditTask(t *testing.T) {
+	m := newModel()
+	m.Key("t")
+	if !m.Editing || m.Input != "writing tests" {
+		t.Fatalf("t doesn't edit the task: %+v", m)
+	}
+	for range len(" tests") {
+		m.Key("\x7f")
+	}
+	// keys of the timer are typed while editing, and escape sequences are
+	// ignored
+	m.Key(" docs")
+	m.Key("q")
+	m.Key("\x1b[C")
+	action, quit := m.Key("\r")
+	if quit || action == nil || action.Method != http.MethodPut || action.Body.(httpd.TaskRequest).Task != "writing docsq" {
+		t.Fatalf("task isn't set on enter: %+v", action)
+	}
+	if m.Editing {
+		t.Fatal("still editing after enter")
+	}
+	m.Key("t")
+	m.Key("\x1b")
+	if m.Editing {
+		t.Fatal("escape doesn't cancel editing")
+	}
+}
+
+func TestRender(t *testing.T) {
+	m := newModel()
+	m.History = []history.Session{
+		{Mode: timer.Pomodoro, Start: time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC), End: time.Date(2025, 1, 2, 9, 25, 0, 0, time.UTC), Task: "reading"},
+	}
+	lines := m.Render(80, 30)
+	if len(lines) != 30 {
+		t.Fatalf("rendered %d lines for a height of 30", len(lines))
+	}
+	screen := strings.Join(lines, "\n")
+	countdown := bigText("12:34")
+	for _, want := range []string{"Pomodoro", countdown[0], countdown[4], "task: writing tests", "09:00-09:25", "reading", "q quit", "● ○ ○ ○  1/4", " 49%"} {
+		if !strings.Contains(screen, want) {
+			t.Fatalf("screen doesn't contain %q:\n%s", want, screen)
+		}
+	}
+	if lines := m.Render(80, 10); len(lines) != 10 {
+		t.Fatalf("rendered %d lines for a height of 10", len(lines))
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		25 * time.Minute:                          "25:00",
+		59*time.Second + 900*time.Millisecond:     "00:59",
+		time.Hour + 2*time.Minute + 3*time.Second: "1:02:03",
+		-time.Second:                              "00:00",
+	} {
+		if got := countdown(d); got != want {
+			t.Fatalf("countdown of %v: %q, want %q", d, got, want)
+		}
+	}
+}